@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/notifier"
+)
+
+const (
+	// DryRunEndPoint serves the announcements recorded instead of sent during a dry run
+	DryRunEndPoint string = "admin/dry-run"
+
+	// BearerPrefix prefixes the token in an Authorization header
+	BearerPrefix string = "Bearer "
+)
+
+// dryRunRecording keeps the announcements recorded during a dry run, across reloads
+var dryRunRecording = notifier.NewRecording(notifier.DefaultRecordingLimit)
+
+// dryRunReport is the JSON body of the dry run end point
+type dryRunReport struct {
+	DryRun   bool                       `json:"dry_run"`
+	Messages []notifier.RecordedMessage `json:"messages"`
+}
+
+// RequireAdmin wraps the handler so it's only run for requests with the admin token. Admin
+// end points don't exist when no token is configured.
+func RequireAdmin(handler http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, request *http.Request) {
+		token := currentAnnouncer().Config().Admin.Token
+		if "" == token {
+			http.NotFound(rw, request)
+			return
+		}
+
+		authorization := request.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, BearerPrefix) ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authorization, BearerPrefix)), []byte(token)) != 1 {
+			rw.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(rw, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		handler(rw, request)
+	}
+}
+
+// OnDryRun serves the announcements recorded during a dry run, oldest first
+func OnDryRun(rw http.ResponseWriter, request *http.Request) {
+	if http.MethodGet != request.Method && http.MethodHead != request.Method {
+		rw.Header().Set("Allow", "GET, HEAD")
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	report := dryRunReport{
+		DryRun:   currentAnnouncer().Config().DryRun,
+		Messages: dryRunRecording.Messages(),
+	}
+
+	writeJson(rw, http.StatusOK, report)
+}
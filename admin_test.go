@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/settings"
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+)
+
+// withAdminToken configures the bot's admin token
+func withAdminToken(config *settings.Config) {
+	config.Admin.Token = "admin-token"
+}
+
+// adminRequest sends a request to the admin end point with the authorization header,
+// returning the response
+func adminRequest(t *testing.T, bot *testBot, method string, endPoint string, authorization string) *http.Response {
+	request, err := http.NewRequest(method, bot.server.URL+"/"+endPoint, nil)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if "" != authorization {
+		request.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := http.DefaultClient.Do(request)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return resp
+}
+
+func TestRequireAdmin(t *testing.T) {
+	bot := startTestBot(t, withAdminToken)
+	defer bot.Close()
+
+	cases := map[string]int{
+		"":                     http.StatusUnauthorized,
+		"admin-token":          http.StatusUnauthorized,
+		"Basic admin-token":    http.StatusUnauthorized,
+		"Bearer wrong-token":   http.StatusUnauthorized,
+		"Bearer admin-token-2": http.StatusUnauthorized,
+		"Bearer admin-token":   http.StatusOK,
+	}
+
+	for authorization, expected := range cases {
+		resp := adminRequest(t, bot, http.MethodGet, DryRunEndPoint, authorization)
+		resp.Body.Close()
+
+		if expected != resp.StatusCode {
+			t.Errorf("%q: expected %d, got %d", authorization, expected, resp.StatusCode)
+		}
+
+		if http.StatusUnauthorized == resp.StatusCode && "Bearer" != resp.Header.Get("WWW-Authenticate") {
+			t.Errorf("%q: expected a WWW-Authenticate challenge, got %q", authorization, resp.Header.Get("WWW-Authenticate"))
+		}
+	}
+}
+
+func TestAdminEndPointsDontExistWithoutToken(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	for _, endPoint := range []string{DryRunEndPoint, DeliveriesEndPoint, ReplayEndPoint} {
+		resp := adminRequest(t, bot, http.MethodGet, endPoint, "Bearer ")
+		resp.Body.Close()
+
+		if http.StatusNotFound != resp.StatusCode {
+			t.Errorf("%s: expected 404, got %d", endPoint, resp.StatusCode)
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	bot := startTestBot(t, func(config *settings.Config) {
+		withAdminToken(config)
+		config.DryRun = true
+	})
+	defer bot.Close()
+
+	recorded := len(dryRunRecording.Messages())
+
+	bot.twitch.GoLive(twitch.TwitchNotification{Id: "1", UserId: "42", Type: "live", StartedAt: "2020-01-01T00:00:00Z"})
+	expectAnnouncements(t, bot)
+
+	resp := adminRequest(t, bot, http.MethodGet, DryRunEndPoint, "Bearer admin-token")
+	defer resp.Body.Close()
+
+	var report dryRunReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); nil != err {
+		t.Fatal(err)
+	}
+
+	if !report.DryRun || recorded+1 != len(report.Messages) {
+		t.Fatalf("expected the announcement to be recorded, got %+v", report)
+	}
+
+	message := report.Messages[len(report.Messages)-1]
+	if settings.DefaultDestinationName != message.Destination || `{"content":"Streamer is now live! http://twitch.tv/streamer"}` != string(message.Body) {
+		t.Fatalf("got %s: %s", message.Destination, message.Body)
+	}
+
+	if time.Since(message.RecordedAt) > time.Minute {
+		t.Fatalf("expected a recent recording, got %s", message.RecordedAt)
+	}
+
+	post := adminRequest(t, bot, http.MethodPost, DryRunEndPoint, "Bearer admin-token")
+	post.Body.Close()
+
+	if http.StatusMethodNotAllowed != post.StatusCode || "GET, HEAD" != post.Header.Get("Allow") {
+		t.Fatalf("got %d, Allow: %q", post.StatusCode, post.Header.Get("Allow"))
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/discord"
+	"github.com/mbolt35/multi-twitch-discord-bot/matrix"
+	"github.com/mbolt35/multi-twitch-discord-bot/notifier"
+	"github.com/mbolt35/multi-twitch-discord-bot/settings"
+	"github.com/mbolt35/multi-twitch-discord-bot/slack"
+	"github.com/mbolt35/multi-twitch-discord-bot/telegram"
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+	"github.com/mbolt35/multi-twitch-discord-bot/webhook"
+
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+// GameLookup returns the name of the game with the id
+type GameLookup func(gameId string) (string, error)
+
+// Announcer routes go live notifications for the configured streamers through their
+// filters and templates to their destinations
+type Announcer struct {
+	config       *settings.Config
+	streamers    map[string]*settings.StreamerConfig
+	users        map[string]twitch.TwitchUser
+	destinations map[string]notifier.Notifier
+	templates    map[string]map[string]*template.Template
+	lookupGame   GameLookup
+}
+
+// NewAnnouncer creates an Announcer for the configuration, using the Twitch users looked up
+// for the configured streamers and naming games with the lookup
+func NewAnnouncer(config *settings.Config, users []twitch.TwitchUser, lookupGame GameLookup) (*Announcer, error) {
+	instance := Announcer{
+		config:       config,
+		streamers:    make(map[string]*settings.StreamerConfig),
+		users:        make(map[string]twitch.TwitchUser),
+		destinations: make(map[string]notifier.Notifier),
+		templates:    make(map[string]map[string]*template.Template),
+		lookupGame:   lookupGame,
+	}
+
+	for _, user := range users {
+		streamer := config.Streamer(user.UserName)
+		if nil == streamer {
+			continue
+		}
+
+		instance.streamers[user.UserId] = streamer
+		instance.users[user.UserId] = user
+	}
+
+	for _, streamer := range config.Streamers {
+		if !instance.hasLogin(streamer.Login) {
+			logutil.Warn("No Twitch user found for streamer", "streamer", streamer.Login)
+		}
+	}
+
+	if config.DryRun {
+		logutil.Warn("Dry run, announcements are recorded rather than sent")
+	}
+
+	for _, destination := range config.Destinations {
+		client := newNotifier(config, destination)
+
+		// Each destination escapes what's inserted into its messages in its own way
+		templates, err := newTemplates(config, client)
+		if nil != err {
+			return nil, err
+		}
+		instance.templates[destination.Name] = templates
+
+		if config.DryRun {
+			client = notifier.NewRecorder(destination.Name, client, dryRunRecording)
+		}
+
+		instance.destinations[destination.Name] = client
+	}
+
+	return &instance, nil
+}
+
+// newNotifier creates the client for the destination, by its type
+func newNotifier(config *settings.Config, destination settings.DestinationConfig) notifier.Notifier {
+	switch destination.Type {
+	case settings.SlackDestinationType:
+		return slack.NewSlack(destination.WebHookUrl, config.SlackOptions())
+
+	case settings.MatrixDestinationType:
+		return matrix.NewMatrix(destination.RoomId, destination.AccessToken, config.MatrixOptions(destination))
+
+	case settings.TelegramDestinationType:
+		return telegram.NewTelegram(destination.BotToken, destination.ChatId, config.TelegramOptions(destination))
+
+	case settings.WebHookDestinationType:
+		return webhook.NewWebHook(destination.WebHookUrl, destination.Secret, config.WebHookOptions(destination))
+
+	default:
+		return discord.NewDiscordWithOptions(destination.WebHookId, destination.WebHookToken, config.DiscordOptions(destination))
+	}
+}
+
+// newTemplates parses every configured template, with the client's escape function
+func newTemplates(config *settings.Config, client notifier.Notifier) (map[string]*template.Template, error) {
+	escape := notifier.EscapeFunc(client, settings.EscapeMarkdown)
+
+	templates := make(map[string]*template.Template)
+	for name, text := range config.Templates {
+		t, err := settings.NewTemplateWithEscape(name, text, escape)
+		if nil != err {
+			return nil, err
+		}
+
+		templates[name] = t
+	}
+
+	return templates, nil
+}
+
+// hasLogin determines whether a Twitch user was found for the login
+func (a *Announcer) hasLogin(login string) bool {
+	for _, user := range a.users {
+		if strings.EqualFold(user.UserName, login) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// UserIds returns the Twitch user ids of every streamer being announced
+func (a *Announcer) UserIds() []string {
+	userIds := []string{}
+	for userId := range a.streamers {
+		userIds = append(userIds, userId)
+	}
+
+	return userIds
+}
+
+// Users returns the Twitch users of every streamer being announced
+func (a *Announcer) Users() []twitch.TwitchUser {
+	users := []twitch.TwitchUser{}
+	for _, user := range a.users {
+		users = append(users, user)
+	}
+
+	return users
+}
+
+// Destinations returns the clients of every destination, by name
+func (a *Announcer) Destinations() map[string]notifier.Notifier {
+	destinations := make(map[string]notifier.Notifier)
+	for name, client := range a.destinations {
+		destinations[name] = client
+	}
+
+	return destinations
+}
+
+// Config returns the configuration the announcer was created from
+func (a *Announcer) Config() *settings.Config {
+	return a.config
+}
+
+// templateData returns the template data for a notification
+func (a *Announcer) templateData(logger *logutil.Logger, notification *twitch.TwitchNotification) settings.TemplateData {
+	user := a.users[notification.UserId]
+
+	login := user.UserName
+	if "" == login {
+		login = strings.ToLower(notification.UserName)
+	}
+
+	displayName := user.DisplayName
+	if "" == displayName {
+		displayName = notification.UserName
+	}
+
+	return settings.TemplateData{
+		UserId:       notification.UserId,
+		Login:        login,
+		DisplayName:  displayName,
+		Title:        notification.Title,
+		GameId:       notification.GameId,
+		GameName:     a.gameName(logger, notification.GameId),
+		Language:     notification.Language,
+		StartedAt:    notification.StartedAt,
+		ViewerCount:  notification.ViewerCount,
+		ThumbnailUrl: notification.ThumbnailUrl,
+		Url:          twitch.UserStreamUrl(login),
+	}
+}
+
+// gameName returns the name of the game with the id, or the id when it can't be looked up
+func (a *Announcer) gameName(logger *logutil.Logger, gameId string) string {
+	if "" == gameId {
+		return gameId
+	}
+
+	name, err := a.lookupGame(gameId)
+	if nil != err {
+		logger.Warn("Failed to look up game", "game_id", gameId, logutil.ErrorKey, err)
+		return gameId
+	}
+
+	return name
+}
+
+// offlineGameName names each game by its id, for announcing without contacting Twitch
+func offlineGameName(gameId string) (string, error) {
+	return gameId, nil
+}
+
+// Announce sends the go live announcement for the notification to each of the streamer's
+// destinations, unless the streamer's filter rejects it
+func (a *Announcer) Announce(logger *logutil.Logger, notification *twitch.TwitchNotification) {
+	streamer, ok := a.streamers[notification.UserId]
+	if !ok {
+		logger.Warn("Ignoring notification for unknown user", "user_id", notification.UserId)
+		return
+	}
+
+	logger = logger.With("streamer", streamer.Login)
+
+	if "" != streamer.Filter {
+		filter := a.config.Filters[streamer.Filter]
+		if !filter.Matches(notification.GameId, notification.Language, notification.Title) {
+			logger.Info("Notification rejected by filter", "filter", streamer.Filter)
+			return
+		}
+	}
+
+	data := a.templateData(logger, notification)
+	templateName := a.config.TemplateFor(streamer)
+
+	for _, name := range a.config.DestinationsFor(streamer) {
+		message, err := settings.RenderTemplate(a.templates[name][templateName], data)
+		if nil != err {
+			logger.Error("Failed to render announcement", "destination", name, logutil.ErrorKey, err)
+			continue
+		}
+
+		err = a.destinations[name].Notify(message, notifier.Event(data))
+		status.RecordDelivery(notification.UserId, name, err)
+		if nil != err {
+			logger.Error("Failed to send announcement", "destination", name, logutil.ErrorKey, err)
+			announcements.Inc(name, "failed")
+			continue
+		}
+
+		logger.Info("Sent announcement", "destination", name)
+		announcements.Inc(name, "sent")
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+const (
+	// CaptureKeyPrefix prefixes the storage keys of captured deliveries. Keys continue with
+	// the time received, so they sort oldest first.
+	CaptureKeyPrefix string = "capture:"
+
+	// DeliveriesEndPoint serves the captured deliveries
+	DeliveriesEndPoint string = "admin/deliveries"
+
+	// ReplayEndPoint replays a captured delivery
+	ReplayEndPoint string = "admin/deliveries/replay"
+)
+
+// uncapturedHeaders are never stored with a captured delivery
+var uncapturedHeaders = []string{"Authorization", "Cookie"}
+
+// capturedDelivery is a notification delivery exactly as it was received
+type capturedDelivery struct {
+	Id         string      `json:"id"`
+	ReceivedAt time.Time   `json:"received_at"`
+	Headers    http.Header `json:"headers"`
+	Body       string      `json:"body"`
+	Status     int         `json:"status"`
+}
+
+// statusRecorder remembers the status code written to the response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status code, then writes it
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// captureDelivery stores the delivery's headers, body and response status when capture is
+// enabled. It's only called for deliveries whose signature and payload were accepted, so
+// nothing forged or malformed is ever stored or replayed.
+func captureDelivery(request *http.Request, body []byte, receivedAt time.Time, recorder *statusRecorder) {
+	capture := currentAnnouncer().Config().Capture
+	if capture.Limit <= 0 {
+		return
+	}
+
+	delivery := &capturedDelivery{
+		Id:         logutil.NewCorrelationId(),
+		ReceivedAt: receivedAt,
+		Headers:    request.Header,
+		Body:       string(body),
+		Status:     recorder.status,
+	}
+
+	saveDelivery(delivery, capture.Limit, capture.MaxAge())
+}
+
+// saveDelivery stores the delivery, then removes the oldest deliveries beyond the limit
+func saveDelivery(delivery *capturedDelivery, limit int, maxAge time.Duration) {
+	logger := logutil.With("capture_id", delivery.Id)
+
+	headers := http.Header{}
+	for name, values := range delivery.Headers {
+		headers[name] = values
+	}
+	for _, name := range uncapturedHeaders {
+		headers.Del(name)
+	}
+	delivery.Headers = headers
+
+	deliveryBytes, err := httputil.EncodeJson(delivery)
+	if nil != err {
+		logger.Error("Failed to encode captured delivery", logutil.ErrorKey, err)
+		return
+	}
+
+	key := fmt.Sprintf("%s%020d:%s", CaptureKeyPrefix, delivery.ReceivedAt.UnixNano(), delivery.Id)
+	if err := backingStore.SetWithTTL(key, string(bytes.TrimSpace(deliveryBytes)), maxAge); nil != err {
+		logger.Error("Failed to capture delivery", logutil.ErrorKey, err)
+		return
+	}
+
+	pruneCaptures(limit)
+}
+
+// pruneCaptures removes the oldest captured deliveries beyond the limit
+func pruneCaptures(limit int) {
+	stored, err := backingStore.List(CaptureKeyPrefix)
+	if nil != err {
+		logutil.Error("Failed to list captured deliveries", logutil.ErrorKey, err)
+		return
+	}
+
+	keys := []string{}
+	for key := range stored {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for i := 0; i < len(keys)-limit; i++ {
+		if err := backingStore.Delete(keys[i]); nil != err {
+			logutil.Error("Failed to remove old captured delivery", "key", keys[i], logutil.ErrorKey, err)
+		}
+	}
+}
+
+// capturedDeliveries returns the captured deliveries, newest first
+func capturedDeliveries() ([]*capturedDelivery, error) {
+	stored, err := backingStore.List(CaptureKeyPrefix)
+	if nil != err {
+		return nil, err
+	}
+
+	keys := []string{}
+	for key := range stored {
+		keys = append(keys, key)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+
+	deliveries := []*capturedDelivery{}
+	for _, key := range keys {
+		var delivery capturedDelivery
+		if err := json.Unmarshal([]byte(stored[key]), &delivery); nil != err {
+			logutil.Warn("Skipping unreadable captured delivery", "key", key, logutil.ErrorKey, err)
+			continue
+		}
+
+		deliveries = append(deliveries, &delivery)
+	}
+
+	return deliveries, nil
+}
+
+// replayEvent returns the event which processes a captured delivery again, optionally
+// bypassing the checks which suppress duplicate announcements
+func replayEvent(id string, delivery *capturedDelivery, bypassDedup bool) (*storedEvent, *twitch.TwitchNotificationPayload, error) {
+	var payload twitch.TwitchNotificationPayload
+	if err := httputil.DecodeJson(strings.NewReader(delivery.Body), &payload); nil != err {
+		return nil, nil, err
+	}
+
+	if err := payload.Validate(); nil != err {
+		return nil, nil, err
+	}
+
+	event := &storedEvent{
+		Id:          id,
+		Topic:       twitch.TopicFromLinkHeader(delivery.Headers.Get(twitch.TwitchLinkHeader)),
+		ReceivedAt:  time.Now().UTC(),
+		Body:        json.RawMessage(delivery.Body),
+		BypassDedup: bypassDedup,
+	}
+
+	return event, &payload, nil
+}
+
+// OnDeliveries serves the captured deliveries, newest first
+func OnDeliveries(rw http.ResponseWriter, request *http.Request) {
+	if http.MethodGet != request.Method && http.MethodHead != request.Method {
+		rw.Header().Set("Allow", "GET, HEAD")
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	deliveries, err := capturedDeliveries()
+	if nil != err {
+		logutil.Error("Failed to list captured deliveries", logutil.ErrorKey, err)
+		http.Error(rw, "Failed to list captured deliveries", http.StatusServiceUnavailable)
+		return
+	}
+
+	writeJson(rw, http.StatusOK, deliveries)
+}
+
+// OnReplay queues the captured delivery with the id query parameter to be processed again,
+// responding with 202 Accepted. Duplicate checks are bypassed when bypass_dedup is true.
+func OnReplay(rw http.ResponseWriter, request *http.Request) {
+	if http.MethodPost != request.Method {
+		rw.Header().Set("Allow", http.MethodPost)
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := request.URL.Query().Get("id")
+	bypassDedup := "true" == request.URL.Query().Get("bypass_dedup")
+
+	deliveries, err := capturedDeliveries()
+	if nil != err {
+		logutil.Error("Failed to list captured deliveries", logutil.ErrorKey, err)
+		http.Error(rw, "Failed to list captured deliveries", http.StatusServiceUnavailable)
+		return
+	}
+
+	for _, delivery := range deliveries {
+		if id != delivery.Id {
+			continue
+		}
+
+		correlationId := logutil.NewCorrelationId()
+		logger := logutil.With("correlation_id", correlationId, "capture_id", id)
+		logger.Info("Replaying captured delivery", "bypass_dedup", bypassDedup)
+
+		event, payload, err := replayEvent(correlationId, delivery, bypassDedup)
+		if nil != err {
+			logger.Warn("Failed to replay captured delivery", logutil.ErrorKey, err)
+			http.Error(rw, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		// Replays are queued like deliveries, in order with the streamer's other notifications
+		if err := persistEvent(event); nil != err {
+			logger.Error("Failed to persist replayed delivery", logutil.ErrorKey, err)
+			http.Error(rw, "Failed to persist replayed delivery", http.StatusServiceUnavailable)
+			return
+		}
+
+		if !dispatchEvent(logger, currentAnnouncer(), event, payload) {
+			logger.Warn("Notification queue is full, refusing replay")
+			removeEvent(logger, event)
+			http.Error(rw, "Too many notifications waiting to be processed", http.StatusServiceUnavailable)
+			return
+		}
+
+		writeJson(rw, http.StatusAccepted, map[string]interface{}{
+			"id":            id,
+			"notifications": len(payload.Notifications),
+			"bypass_dedup":  bypassDedup,
+		})
+		return
+	}
+
+	http.Error(rw, "No captured delivery with id "+id, http.StatusNotFound)
+}
+
+// writeJson writes the value as a JSON response with the status code
+func writeJson(rw http.ResponseWriter, statusCode int, value interface{}) {
+	jsonBytes, err := httputil.EncodeJson(value)
+	if nil != err {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set(httputil.HttpContentTypeHeader, httputil.JsonContentType)
+	rw.WriteHeader(statusCode)
+	rw.Write(jsonBytes)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/settings"
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+)
+
+// withCapture enables capturing deliveries and configures the bot's admin token
+func withCapture(config *settings.Config) {
+	withAdminToken(config)
+	config.Capture.Limit = 10
+}
+
+// listDeliveries returns the captured deliveries served by the admin end point
+func listDeliveries(t *testing.T, bot *testBot) []capturedDelivery {
+	resp := adminRequest(t, bot, http.MethodGet, DeliveriesEndPoint, "Bearer admin-token")
+	defer resp.Body.Close()
+
+	if http.StatusOK != resp.StatusCode {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	deliveries := []capturedDelivery{}
+	if err := json.NewDecoder(resp.Body).Decode(&deliveries); nil != err {
+		t.Fatal(err)
+	}
+
+	return deliveries
+}
+
+// replayCapture requests a captured delivery be processed again, returning the status code
+func replayCapture(t *testing.T, bot *testBot, method string, query string) int {
+	resp := adminRequest(t, bot, method, ReplayEndPoint+"?"+query, "Bearer admin-token")
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestDeliveriesAreCaptured(t *testing.T) {
+	bot := startTestBot(t, withCapture)
+	defer bot.Close()
+
+	first := twitch.TwitchNotification{Id: "1", UserId: "42", Type: "live", StartedAt: "2020-01-01T00:00:00Z"}
+	messageId := bot.twitch.NewMessageId()
+	for i := 0; i < 2; i++ {
+		if _, err := bot.twitch.Deliver("42", messageId, []twitch.TwitchNotification{first}); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	deliveries := listDeliveries(t, bot)
+	if 2 != len(deliveries) {
+		t.Fatalf("expected 2 captured deliveries, got %+v", deliveries)
+	}
+
+	// Newest first, with the status the bot responded with, so the duplicate is 200 OK
+	if http.StatusOK != deliveries[0].Status || http.StatusAccepted != deliveries[1].Status {
+		t.Fatalf("expected the statuses 200 then 202, got %d then %d", deliveries[0].Status, deliveries[1].Status)
+	}
+
+	var payload twitch.TwitchNotificationPayload
+	if err := json.Unmarshal([]byte(deliveries[1].Body), &payload); nil != err {
+		t.Fatal(err)
+	}
+	if 1 != len(payload.Notifications) || first.StartedAt != payload.Notifications[0].StartedAt {
+		t.Fatalf("expected the body to be captured, got %q", deliveries[1].Body)
+	}
+
+	if "" == deliveries[1].Headers.Get(twitch.TwitchSignatureHeader) {
+		t.Fatalf("expected the headers to be captured, got %v", deliveries[1].Headers)
+	}
+}
+
+func TestRejectedDeliveriesArentCaptured(t *testing.T) {
+	bot := startTestBot(t, withCapture)
+	defer bot.Close()
+
+	// An invalid payload, and a forged signature
+	bot.twitch.GoLive(twitch.TwitchNotification{Id: "1", UserId: "42", Type: "live", StartedAt: "yesterday"})
+
+	body := []byte(`{"data":[{"id":"2","user_id":"42","type":"live","started_at":"2020-01-01T00:00:00Z"}]}`)
+	if code := postSignedNotification(t, bot.twitch.NewMessageId(), "application/json", body, "sha256=forged"); http.StatusForbidden != code {
+		t.Fatalf("expected 403, got %d", code)
+	}
+
+	if deliveries := listDeliveries(t, bot); 0 != len(deliveries) {
+		t.Fatalf("expected nothing to be captured, got %+v", deliveries)
+	}
+}
+
+func TestCaptureLimitIsEnforcedWhenWriting(t *testing.T) {
+	bot := startTestBot(t, func(config *settings.Config) {
+		withCapture(config)
+		config.Capture.Limit = 2
+	})
+	defer bot.Close()
+
+	for _, id := range []string{"1", "2", "3"} {
+		bot.twitch.GoLive(twitch.TwitchNotification{Id: id, UserId: "42", Type: "live", StartedAt: "2020-01-01T00:00:00Z"})
+	}
+
+	if deliveries := listDeliveries(t, bot); 2 != len(deliveries) {
+		t.Fatalf("expected only the 2 newest deliveries to be kept, got %+v", deliveries)
+	}
+}
+
+func TestDeliveriesArentCapturedWithoutLimit(t *testing.T) {
+	bot := startTestBot(t, withAdminToken)
+	defer bot.Close()
+
+	bot.twitch.GoLive(twitch.TwitchNotification{Id: "1", UserId: "42", Type: "live", StartedAt: "2020-01-01T00:00:00Z"})
+
+	if deliveries := listDeliveries(t, bot); 0 != len(deliveries) {
+		t.Fatalf("expected nothing to be captured, got %+v", deliveries)
+	}
+}
+
+func TestSaveDeliveryOmitsCredentials(t *testing.T) {
+	useMemoryStore(t)
+
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer secret")
+	headers.Set("Cookie", "session=secret")
+	headers.Set("Content-Type", "application/json")
+
+	saveDelivery(&capturedDelivery{Id: "1", ReceivedAt: time.Now(), Headers: headers, Body: "{}"}, 10, time.Hour)
+
+	deliveries, err := capturedDeliveries()
+	if nil != err || 1 != len(deliveries) {
+		t.Fatalf("expected one captured delivery, got %+v, %v", deliveries, err)
+	}
+
+	captured := deliveries[0].Headers
+	if "" != captured.Get("Authorization") || "" != captured.Get("Cookie") || "application/json" != captured.Get("Content-Type") {
+		t.Fatalf("expected only the content type to be captured, got %v", captured)
+	}
+
+	// The request's own headers are left alone
+	if "Bearer secret" != headers.Get("Authorization") {
+		t.Fatal("expected the request's headers to be unchanged")
+	}
+}
+
+func TestSaveDeliveryKeepsTheNewest(t *testing.T) {
+	useMemoryStore(t)
+
+	received := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		saveDelivery(&capturedDelivery{Id: id, ReceivedAt: received, Headers: http.Header{}}, 2, time.Hour)
+		received = received.Add(time.Minute)
+	}
+
+	deliveries, err := capturedDeliveries()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	ids := []string{}
+	for _, delivery := range deliveries {
+		ids = append(ids, delivery.Id)
+	}
+
+	if 2 != len(ids) || "d" != ids[0] || "c" != ids[1] {
+		t.Fatalf("expected d and c to be kept, got %v", ids)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	bot := startTestBot(t, withCapture)
+	defer bot.Close()
+
+	bot.twitch.GoLive(twitch.TwitchNotification{Id: "1", UserId: "42", Type: "live", StartedAt: "2020-01-01T00:00:00Z"})
+
+	deliveries := listDeliveries(t, bot)
+	if 1 != len(deliveries) {
+		t.Fatalf("expected 1 captured delivery, got %+v", deliveries)
+	}
+	id := deliveries[0].Id
+
+	// Replays are queued, and suppressed like any other duplicate unless bypassed
+	if code := replayCapture(t, bot, http.MethodPost, "id="+id); http.StatusAccepted != code {
+		t.Fatalf("expected 202, got %d", code)
+	}
+
+	if code := replayCapture(t, bot, http.MethodPost, "id="+id+"&bypass_dedup=true"); http.StatusAccepted != code {
+		t.Fatalf("expected 202, got %d", code)
+	}
+
+	if code := replayCapture(t, bot, http.MethodPost, "id=unknown"); http.StatusNotFound != code {
+		t.Fatalf("expected 404 for an unknown id, got %d", code)
+	}
+
+	if code := replayCapture(t, bot, http.MethodGet, "id="+id); http.StatusMethodNotAllowed != code {
+		t.Fatalf("expected 405, got %d", code)
+	}
+
+	expectAnnouncements(t, bot,
+		"Streamer is now live! http://twitch.tv/streamer",
+		"Streamer is now live! http://twitch.tv/streamer")
+}
+
+func TestReplayOfInvalidDelivery(t *testing.T) {
+	bot := startTestBot(t, withCapture)
+	defer bot.Close()
+
+	// Captured by an earlier version, which captured deliveries before validating them
+	body := `{"data":[{"id":"1","user_id":"42","type":"live","started_at":"yesterday"}]}`
+	saveDelivery(&capturedDelivery{Id: "1", ReceivedAt: time.Now(), Headers: http.Header{}, Body: body}, 10, time.Hour)
+
+	deliveries := listDeliveries(t, bot)
+	if 1 != len(deliveries) {
+		t.Fatalf("expected 1 captured delivery, got %+v", deliveries)
+	}
+
+	if code := replayCapture(t, bot, http.MethodPost, "id="+deliveries[0].Id); http.StatusUnprocessableEntity != code {
+		t.Fatalf("expected 422, got %d", code)
+	}
+
+	expectAnnouncements(t, bot)
+}
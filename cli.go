@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/notifier"
+	"github.com/mbolt35/multi-twitch-discord-bot/settings"
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+	timeutil "github.com/mbolt35/multi-twitch-discord-bot/util/time"
+)
+
+const (
+	// ServeCommand runs the bot, and is run when no command is given
+	ServeCommand string = "serve"
+
+	// ListRequestTimeout limits how long list-subscriptions waits on the running bot
+	ListRequestTimeout time.Duration = 10 * time.Second
+)
+
+// Command is a subcommand of the bot's command line
+type Command struct {
+	Name        string
+	Args        string
+	Description string
+	Run         func(configPath string, args []string) error
+}
+
+// errUsage is returned by commands given the wrong arguments
+var errUsage = errors.New("Invalid arguments")
+
+// commands are every subcommand, in the order they're listed in the usage
+var commands = []Command{
+	{ServeCommand, "", "Run the bot (the default)", serve},
+	{"subscribe", "<login...>", "Subscribe to go live events for the Twitch users", subscribe},
+	{"unsubscribe", "<login...>", "Unsubscribe from go live events for the Twitch users", unsubscribe},
+	{"list-subscriptions", "", "List the subscriptions of the running bot", listSubscriptions},
+	{"resolve", "<login...>", "Look up the Twitch user ids of the logins", resolve},
+	{"test-discord", "[destination [login]]", "Send a sample announcement to the destination, with the streamer's template", testDiscord},
+	{"replay", "[-bypass-dedup] <payload.json>", "Process a captured notification payload without involving Twitch", replay},
+	{"migrate", "", "Apply pending storage schema migrations", migrate},
+}
+
+// findCommand returns the command with the name, or nil if there is none
+func findCommand(name string) *Command {
+	for i := range commands {
+		if commands[i].Name == name {
+			return &commands[i]
+		}
+	}
+
+	return nil
+}
+
+// printUsage describes the flags and commands
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [-config path] [command] [arguments]\n\nFlags:\n", os.Args[0])
+	flag.PrintDefaults()
+
+	fmt.Fprintf(os.Stderr, "\nCommands:\n")
+	writer := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	for _, command := range commands {
+		fmt.Fprintf(writer, "  %s %s\t%s\n", command.Name, command.Args, command.Description)
+	}
+	writer.Flush()
+}
+
+// subscribe sends subscribe requests for the logins. The running bot receives and answers
+// Twitch's verification of them, and verifies their deliveries with the configured secret.
+func subscribe(configPath string, args []string) error {
+	return sendSubscriptions(configPath, args, func(client twitch.TwitchClient, notifyEndPoint string, userIds []string) error {
+		// A secret generated for this command would be unknown to the running bot
+		if "" == config.Twitch.Secret {
+			return fmt.Errorf("twitch.secret (or $%s) must be set to subscribe from the command line", settings.TwitchSecretEnvVar)
+		}
+
+		return client.SubscribeToStreams(notifyEndPoint, userIds)
+	})
+}
+
+// unsubscribe sends unsubscribe requests for the logins
+func unsubscribe(configPath string, args []string) error {
+	return sendSubscriptions(configPath, args, twitch.TwitchClient.UnsubscribeFromStreams)
+}
+
+// sendSubscriptions resolves the logins, then sends the subscription requests for them
+func sendSubscriptions(configPath string, args []string, send func(client twitch.TwitchClient, notifyEndPoint string, userIds []string) error) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	LoadConfig(configPath)
+
+	userIds, err := twitchClient.UserIdsFor(args)
+	if nil != err {
+		return err
+	}
+
+	if len(userIds) != len(args) {
+		return fmt.Errorf("Found %d of %d Twitch users", len(userIds), len(args))
+	}
+
+	if err := send(twitchClient, notifyUrl(), userIds); nil != err {
+		return err
+	}
+
+	fmt.Printf("Sent requests for %d user(s). Twitch verifies them with the running bot at %s\n", len(userIds), notifyUrl())
+	return nil
+}
+
+// listSubscriptions prints the subscriptions known to the running bot
+func listSubscriptions(configPath string, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	LoadConfig(configPath)
+
+	client := &http.Client{Timeout: ListRequestTimeout}
+	resp, err := client.Get(config.Host.Url + "/" + SubscriptionsEndPoint)
+	if nil != err {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("The running bot returned %s", resp.Status)
+	}
+
+	subscriptions := []twitch.Subscription{}
+	if err := httputil.DecodeJson(resp.Body, &subscriptions); nil != err {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "USER ID\tSTATE\tEXPIRES\tREASON\n")
+	for _, subscription := range subscriptions {
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%s\n", subscription.UserId, subscription.State,
+			formatTime(subscription.ExpiresAt), subscription.Reason)
+	}
+
+	return writer.Flush()
+}
+
+// resolve prints the Twitch users for the logins
+func resolve(configPath string, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	LoadConfig(configPath)
+
+	users, err := twitchClient.UsersFor(args)
+	if nil != err {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(writer, "LOGIN\tUSER ID\tDISPLAY NAME\n")
+	for _, user := range users {
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", user.UserName, user.UserId, user.DisplayName)
+	}
+
+	if err := writer.Flush(); nil != err {
+		return err
+	}
+
+	if len(users) != len(args) {
+		return fmt.Errorf("Found %d of %d Twitch users", len(users), len(args))
+	}
+
+	return nil
+}
+
+// testDiscord sends a sample announcement to a destination of any type, the first one if none is named,
+// rendered with the template of the streamer if one is named
+func testDiscord(configPath string, args []string) error {
+	if len(args) > 2 {
+		return errUsage
+	}
+
+	LoadConfig(configPath)
+
+	destination := &config.Destinations[0]
+	if len(args) > 0 {
+		destination = config.Destination(args[0])
+		if nil == destination {
+			return fmt.Errorf("Unknown destination %q", args[0])
+		}
+	}
+
+	data := settings.SampleTemplateData
+	templateName := settings.DefaultTemplateName
+	if len(args) > 1 {
+		streamer := config.Streamer(args[1])
+		if nil == streamer {
+			return fmt.Errorf("Unknown streamer %q", args[1])
+		}
+
+		templateName = config.TemplateFor(streamer)
+		data.Login = strings.ToLower(streamer.Login)
+		data.DisplayName = streamer.Login
+		data.Url = twitch.UserStreamUrl(data.Login)
+	}
+
+	client := newNotifier(config, *destination)
+	t, err := settings.NewTemplateWithEscape(templateName, config.Templates[templateName], notifier.EscapeFunc(client, settings.EscapeMarkdown))
+	if nil != err {
+		return err
+	}
+
+	message, err := settings.RenderTemplate(t, data)
+	if nil != err {
+		return err
+	}
+
+	if err := client.Notify(message, notifier.Event(data)); nil != err {
+		return err
+	}
+
+	fmt.Printf("Sent to %s: %s\n", destination.Name, message)
+	return nil
+}
+
+// replay processes a captured notification payload as if it had just been delivered. Its
+// streamers' Twitch users are taken from the payload, so Twitch is never contacted, while
+// deduplication, unless bypassed, and announcements run as they would when serving.
+func replay(configPath string, args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	bypassDedup := flags.Bool("bypass-dedup", false, "Announce even if the stream was already announced")
+	if nil != flags.Parse(args) || flags.NArg() != 1 {
+		return errUsage
+	}
+
+	path := flags.Arg(0)
+	LoadConfig(configPath)
+
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		return err
+	}
+
+	var payload twitch.TwitchNotificationPayload
+	if err := json.Unmarshal(data, &payload); nil != err {
+		return fmt.Errorf("Failed to parse %s: %s", path, err)
+	}
+
+	if err := payload.Validate(); nil != err {
+		return err
+	}
+
+	backingStore = InitializeStorage()
+	liveStartTimes = timeutil.NewTimeMap(backingStore, time.RFC3339)
+
+	// Flushes the announcements recorded, so the bot doesn't repeat them
+	defer closeStorage(backingStore)
+
+	replayAnnouncer, err := NewAnnouncer(replayConfig(payload.Notifications), replayUsers(payload.Notifications), offlineGameName)
+	if nil != err {
+		return err
+	}
+
+	logger := logutil.With("correlation_id", logutil.NewCorrelationId())
+	if len(payload.Notifications) == 0 {
+		logger.Info("Payload has no notifications, which means a stream went offline")
+	}
+
+	for i := range payload.Notifications {
+		processNotification(logger, replayAnnouncer, &payload.Notifications[i], *bypassDedup)
+	}
+
+	return nil
+}
+
+// replayConfig returns a copy of the configuration with only the streamers the notifications
+// are for
+func replayConfig(notifications []twitch.TwitchNotification) *settings.Config {
+	replayed := *config
+	replayed.Streamers = []settings.StreamerConfig{}
+
+	for _, notification := range notifications {
+		streamer := config.Streamer(notification.UserName)
+		if nil != streamer && nil == replayed.Streamer(streamer.Login) {
+			replayed.Streamers = append(replayed.Streamers, *streamer)
+		}
+	}
+
+	return &replayed
+}
+
+// replayUsers returns the Twitch users the notifications are for
+func replayUsers(notifications []twitch.TwitchNotification) []twitch.TwitchUser {
+	users := []twitch.TwitchUser{}
+	for _, notification := range notifications {
+		users = append(users, twitch.TwitchUser{
+			UserId:      notification.UserId,
+			UserName:    strings.ToLower(notification.UserName),
+			DisplayName: notification.UserName,
+		})
+	}
+
+	return users
+}
+
+// migrate initializes the configured storage, which applies any pending schema migrations
+func migrate(configPath string, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	LoadConfig(configPath)
+
+	if "" == config.Storage.Url {
+		fmt.Println("In-memory storage has no schema to migrate")
+		return nil
+	}
+
+	// Falling back to memory would report success without migrating anything
+	config.Storage.FallbackToMemory = false
+	closeStorage(InitializeStorage())
+
+	fmt.Println("Storage is migrated and ready")
+	return nil
+}
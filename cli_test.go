@@ -0,0 +1,305 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// captureStdout runs the command, returning what it printed and its error
+func captureStdout(t *testing.T, run func() error) (string, error) {
+	reader, writer, err := os.Pipe()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	original := os.Stdout
+	os.Stdout = writer
+
+	output := make(chan string)
+	go func() {
+		data, _ := ioutil.ReadAll(reader)
+		output <- string(data)
+	}()
+
+	runErr := run()
+
+	os.Stdout = original
+	writer.Close()
+
+	return <-output, runErr
+}
+
+// expectOutput fails unless the output has a line with exactly the fields
+func expectOutput(t *testing.T, output string, fields ...string) {
+	for _, line := range strings.Split(output, "\n") {
+		if strings.Join(fields, " ") == strings.Join(strings.Fields(line), " ") {
+			return
+		}
+	}
+
+	t.Fatalf("expected a line with %v, got:\n%s", fields, output)
+}
+
+func TestFindCommand(t *testing.T) {
+	for _, command := range commands {
+		if found := findCommand(command.Name); nil == found || command.Name != found.Name {
+			t.Errorf("expected to find %s, got %v", command.Name, found)
+		}
+	}
+
+	if nil != findCommand("publish") {
+		t.Error("expected an unknown command not to be found")
+	}
+}
+
+func TestCommandsRejectWrongArguments(t *testing.T) {
+	cases := map[string][]string{
+		"subscribe":          nil,
+		"unsubscribe":        nil,
+		"list-subscriptions": {"extra"},
+		"resolve":            nil,
+		"test-discord":       {"default", "streamer", "extra"},
+		"replay":             nil,
+		"migrate":            {"extra"},
+	}
+
+	for name, args := range cases {
+		if err := findCommand(name).Run("", args); errUsage != err {
+			t.Errorf("%s %v: expected errUsage, got %v", name, args, err)
+		}
+	}
+
+	if err := replay("", []string{"-unknown", "payload.json"}); errUsage != err {
+		t.Errorf("expected an unknown replay flag to be rejected, got %v", err)
+	}
+}
+
+func TestResolveCommand(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	path, remove := writeTestConfig(t, bot.config())
+	defer remove()
+
+	output, err := captureStdout(t, func() error { return resolve(path, []string{"Streamer"}) })
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	expectOutput(t, output, "streamer", "42", "Streamer")
+
+	if _, err := captureStdout(t, func() error { return resolve(path, []string{"streamer", "missing"}) }); nil == err || "Found 1 of 2 Twitch users" != err.Error() {
+		t.Fatalf("expected the missing user to be reported, got %v", err)
+	}
+}
+
+func TestSubscribeCommand(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	bot.twitch.AddUser("7", "other", "Other")
+
+	path, remove := writeTestConfig(t, bot.config())
+	defer remove()
+
+	if _, err := captureStdout(t, func() error { return subscribe(path, []string{"other"}) }); nil != err {
+		t.Fatal(err)
+	}
+	bot.twitch.WaitForCallbacks()
+
+	// The running bot verifies the deliveries with the configured secret
+	subscription, ok := bot.twitch.Subscription("7")
+	if !ok || "secret" != subscription.Secret {
+		t.Fatalf("expected a verified subscription with the secret, got %+v", subscription)
+	}
+
+	if _, err := captureStdout(t, func() error { return unsubscribe(path, []string{"other"}) }); nil != err {
+		t.Fatal(err)
+	}
+	bot.twitch.WaitForCallbacks()
+
+	if _, ok := bot.twitch.Subscription("7"); ok {
+		t.Fatal("expected the subscription to be removed")
+	}
+}
+
+func TestSubscribeCommandRequiresSecret(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	unsigned := bot.config()
+	unsigned.Twitch.Secret = ""
+
+	path, remove := writeTestConfig(t, unsigned)
+	defer remove()
+
+	if _, err := captureStdout(t, func() error { return subscribe(path, []string{"streamer"}) }); nil == err || !strings.Contains(err.Error(), "twitch.secret") {
+		t.Fatalf("expected the missing secret to be reported, got %v", err)
+	}
+}
+
+func TestListSubscriptionsCommand(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	// The command runs in its own process, so it asks a running bot rather than this one
+	running := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		if "/"+SubscriptionsEndPoint != request.URL.Path {
+			http.NotFound(rw, request)
+			return
+		}
+
+		rw.Write([]byte(`[
+			{"user_id": "42", "state": "verified", "expires_at": "2020-01-11T00:00:00Z"},
+			{"user_id": "7", "state": "denied", "reason": "unauthorized"}
+		]`))
+	}))
+	defer running.Close()
+
+	listed := bot.config()
+	listed.Host.Url = running.URL
+
+	path, remove := writeTestConfig(t, listed)
+	defer remove()
+
+	output, err := captureStdout(t, func() error { return listSubscriptions(path, nil) })
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	expectOutput(t, output, "USER", "ID", "STATE", "EXPIRES", "REASON")
+	expectOutput(t, output, "42", "verified", "2020-01-11", "00:00:00", "UTC")
+	expectOutput(t, output, "7", "denied", "-", "unauthorized")
+
+	listed.Host.Url = running.URL + "/missing"
+	rewriteTestConfig(path, listed)
+
+	if _, err := captureStdout(t, func() error { return listSubscriptions(path, nil) }); nil == err {
+		t.Fatal("expected the failed request to be reported")
+	}
+}
+
+func TestTestDiscordCommand(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	path, remove := writeTestConfig(t, bot.config())
+	defer remove()
+
+	output, err := captureStdout(t, func() error { return testDiscord(path, nil) })
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if "Sent to default: Sample\\_Streamer is now live! http://twitch.tv/sample_streamer\n" != output {
+		t.Fatalf("got %q", output)
+	}
+
+	if _, err := captureStdout(t, func() error { return testDiscord(path, []string{"default", "Streamer"}) }); nil != err {
+		t.Fatal(err)
+	}
+
+	expectAnnouncements(t, bot,
+		"Sample\\_Streamer is now live! http://twitch.tv/sample_streamer",
+		"streamer is now live! http://twitch.tv/streamer")
+
+	if err := testDiscord(path, []string{"missing"}); nil == err || `Unknown destination "missing"` != err.Error() {
+		t.Fatalf("expected the unknown destination to be reported, got %v", err)
+	}
+
+	if err := testDiscord(path, []string{"default", "missing"}); nil == err || `Unknown streamer "missing"` != err.Error() {
+		t.Fatalf("expected the unknown streamer to be reported, got %v", err)
+	}
+}
+
+func TestReplayCommand(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	dir, err := ioutil.TempDir("", "replay-test")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Replays run as separate processes, so what they record must be persisted
+	stored := bot.config()
+	stored.Storage.Url = "file://" + filepath.Join(dir, "bot.json")
+
+	path, remove := writeTestConfig(t, stored)
+	defer remove()
+
+	payloadPath := filepath.Join(dir, "payload.json")
+	payload := `{"data": [{"id": "1", "user_id": "42", "user_name": "Streamer", "type": "live", "started_at": "2020-01-01T00:00:00Z"}]}`
+	if err := ioutil.WriteFile(payloadPath, []byte(payload), 0600); nil != err {
+		t.Fatal(err)
+	}
+
+	for _, args := range [][]string{{payloadPath}, {payloadPath}, {"-bypass-dedup", payloadPath}} {
+		if err := replay(path, args); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	// Games are named by their id rather than looked up
+	bot.twitch.RefuseGameLookups()
+	gamePayload := `{"data": [{"id": "2", "user_id": "42", "user_name": "Streamer", "game_id": "509658", "type": "live", "started_at": "2020-01-02T00:00:00Z"}]}`
+	if err := ioutil.WriteFile(payloadPath, []byte(gamePayload), 0600); nil != err {
+		t.Fatal(err)
+	}
+
+	if err := replay(path, []string{payloadPath}); nil != err {
+		t.Fatal(err)
+	}
+
+	if lookups := bot.twitch.GameLookups(); 0 != lookups {
+		t.Fatalf("expected Twitch not to be contacted, got %d games lookups", lookups)
+	}
+
+	expectAnnouncements(t, bot,
+		"Streamer is now live! http://twitch.tv/streamer",
+		"Streamer is now live! http://twitch.tv/streamer",
+		"Streamer is now live! http://twitch.tv/streamer")
+
+	if err := ioutil.WriteFile(payloadPath, []byte(`{"data": [{}]}`), 0600); nil != err {
+		t.Fatal(err)
+	}
+
+	if err := replay(path, []string{payloadPath}); nil == err {
+		t.Fatal("expected the invalid payload to be rejected")
+	}
+}
+
+func TestMigrateCommand(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	dir, err := ioutil.TempDir("", "migrate-test")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cases := map[string]string{
+		"": "In-memory storage has no schema to migrate\n",
+		"file://" + filepath.Join(dir, "bot.json"): "Storage is migrated and ready\n",
+	}
+
+	for url, expected := range cases {
+		migrated := bot.config()
+		migrated.Storage.Url = url
+
+		path, remove := writeTestConfig(t, migrated)
+		output, err := captureStdout(t, func() error { return migrate(path, nil) })
+		remove()
+
+		if nil != err || expected != output {
+			t.Errorf("%q: expected %q, got %q, %v", url, expected, output, err)
+		}
+	}
+}
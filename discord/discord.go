@@ -2,14 +2,28 @@ package discord
 
 import (
 	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
 	"net/http"
 	"strings"
 
+	"github.com/mbolt35/multi-twitch-discord-bot/notifier"
+
 	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
 )
 
-// Discord WebHook Base Url
-const DiscordWebHookUrl string = "https://discordapp.com/api/webhooks"
+const (
+	// Discord API Base Url
+	DiscordApiUrl string = "https://discordapp.com/api"
+
+	// Discord WebHooks API Path
+	DiscordWebHooksPath string = "/webhooks"
+
+	// Discord WebHook Base Url
+	DiscordWebHookUrl string = DiscordApiUrl + DiscordWebHooksPath
+)
 
 // Discord WebHook Request Payload
 type DiscordWebHookMessage struct {
@@ -20,45 +34,122 @@ type DiscordWebHookMessage struct {
 type discord struct {
 	webHookId    string
 	webHookToken string
+	apiUrl       string
+	userAgent    string
+	httpClient   *http.Client
 }
 
 // Interface representing a Discord client
 type DiscordClient interface {
+	notifier.Notifier
+
 	SendDiscordMessage(message string) error
+	CheckWebHook() error
 }
 
-// Discord Client Factory
+// Discord Client Factory using the default options
 func NewDiscord(webHookId string, webHookToken string) DiscordClient {
+	return NewDiscordWithOptions(webHookId, webHookToken, DefaultOptions)
+}
+
+// Discord Client Factory communicating with the Discord API as configured by the options
+func NewDiscordWithOptions(webHookId string, webHookToken string, options Options) DiscordClient {
+	options = options.withDefaults()
+
 	instance := discord{
 		webHookId:    webHookId,
 		webHookToken: webHookToken,
+		apiUrl:       options.ApiUrl,
+		userAgent:    options.UserAgent,
+		httpClient:   options.NewClient(),
 	}
 
 	return &instance
 }
 
 // Gets the discord webbhook base url
-func getDiscordWebHookUrl(hookId string, hookToken string) string {
-	return strings.Join([]string{DiscordWebHookUrl, hookId, hookToken}, "/")
+func getDiscordWebHookUrl(apiUrl string, hookId string, hookToken string) string {
+	return strings.Join([]string{httputil.JoinUrl(apiUrl, DiscordWebHooksPath), hookId, hookToken}, "/")
+}
+
+// send sends a request to the web hook with the user agent set
+func (d *discord) send(method string, contentType string, body io.Reader) (*http.Response, error) {
+	request, err := http.NewRequest(method, getDiscordWebHookUrl(d.apiUrl, d.webHookId, d.webHookToken), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if "" != contentType {
+		request.Header.Set(httputil.HttpContentTypeHeader, contentType)
+	}
+	request.Header.Set(httputil.HttpUserAgentHeader, d.userAgent)
+
+	return requests.Do(d.httpClient, request)
+}
+
+// Payload returns the web hook request body announcing the message. Discord messages are
+// the rendered template alone.
+func (d *discord) Payload(message string, event notifier.Event) (json.RawMessage, error) {
+	jsonBytes, err := httputil.EncodeJson(DiscordWebHookMessage{
+		Message: message,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return json.RawMessage(bytes.TrimSpace(jsonBytes)), nil
+}
+
+// Notify sends the message to the web hook
+func (d *discord) Notify(message string, event notifier.Event) error {
+	return d.SendDiscordMessage(message)
+}
+
+// Check verifies the web hook
+func (d *discord) Check() error {
+	return d.CheckWebHook()
 }
 
 // Sends a message to the discord server/channel using the webhook
 func (d *discord) SendDiscordMessage(message string) error {
-	discordMessage := DiscordWebHookMessage{
-		Message: message,
+	jsonBytes, err := d.Payload(message, notifier.Event{})
+	if err != nil {
+		return err
 	}
 
-	jsonBytes, err := httputil.EncodeJson(discordMessage)
+	resp, err := d.send(http.MethodPost, httputil.JsonContentType, bytes.NewBuffer(jsonBytes))
 	if err != nil {
 		return err
 	}
 
-	webHookUrl := getDiscordWebHookUrl(d.webHookId, d.webHookToken)
-	resp, err := http.Post(webHookUrl, httputil.JsonContentType, bytes.NewBuffer(jsonBytes))
+	defer resp.Body.Close()
+
+	if http.StatusTooManyRequests == resp.StatusCode {
+		rateLimited.Inc()
+		return fmt.Errorf("Discord rate limited the web hook, retry after %s seconds", resp.Header.Get("Retry-After"))
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("Discord web hook returned %s", resp.Status)
+	}
+
+	logutil.Debug("Sent Discord message", "webhook_id", d.webHookId, "status", resp.StatusCode)
+	return nil
+}
+
+// CheckWebHook verifies the web hook exists and the token is accepted, without posting
+// a message
+func (d *discord) CheckWebHook() error {
+	resp, err := d.send(http.MethodGet, "", nil)
 	if err != nil {
 		return err
 	}
 
 	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("Discord web hook returned %s", resp.Status)
+	}
+
 	return nil
 }
@@ -0,0 +1,131 @@
+package discord_test
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/discord"
+	"github.com/mbolt35/multi-twitch-discord-bot/discord/discordtest"
+	"github.com/mbolt35/multi-twitch-discord-bot/notifier"
+)
+
+// recordingTransport sends requests with the default transport, recording each of them
+type recordingTransport struct {
+	lock     sync.Mutex
+	requests []*http.Request
+}
+
+func (r *recordingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	r.lock.Lock()
+	r.requests = append(r.requests, request)
+	r.lock.Unlock()
+
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func TestSendDiscordMessage(t *testing.T) {
+	server := discordtest.NewServer()
+	defer server.Close()
+
+	server.AddWebHook("1", "token")
+
+	client := discord.NewDiscordWithOptions("1", "token", server.Options())
+	if err := client.SendDiscordMessage("Streamer is now live!"); nil != err {
+		t.Fatal(err)
+	}
+
+	messages := server.Messages()
+	if 1 != len(messages) || "1" != messages[0].WebHookId || "Streamer is now live!" != messages[0].Content {
+		t.Fatalf("got %+v", messages)
+	}
+}
+
+func TestSendDiscordMessageFailures(t *testing.T) {
+	server := discordtest.NewServer()
+	defer server.Close()
+
+	server.AddWebHook("1", "token")
+
+	cases := map[string]struct {
+		client   discord.DiscordClient
+		failWith int
+		expected string
+	}{
+		"rate limited": {discord.NewDiscordWithOptions("1", "token", server.Options()), http.StatusTooManyRequests, "retry after 1 seconds"},
+		"server error": {discord.NewDiscordWithOptions("1", "token", server.Options()), http.StatusBadGateway, "502 Bad Gateway"},
+		"unknown":      {discord.NewDiscordWithOptions("2", "token", server.Options()), 0, "404 Not Found"},
+		"wrong token":  {discord.NewDiscordWithOptions("1", "wrong", server.Options()), 0, "401 Unauthorized"},
+		"unreachable":  {discord.NewDiscordWithOptions("1", "token", discord.Options{ApiUrl: "http://127.0.0.1:1"}), 0, "connection refused"},
+	}
+
+	for name, c := range cases {
+		if 0 != c.failWith {
+			server.FailNext(c.failWith, 1)
+		}
+
+		if err := c.client.SendDiscordMessage("message"); nil == err || !strings.Contains(err.Error(), c.expected) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, c.expected, err)
+		}
+	}
+
+	if 0 != len(server.Messages()) {
+		t.Fatalf("expected no messages, got %+v", server.Messages())
+	}
+}
+
+func TestCheckWebHook(t *testing.T) {
+	server := discordtest.NewServer()
+	defer server.Close()
+
+	server.AddWebHook("1", "token")
+
+	if err := discord.NewDiscordWithOptions("1", "token", server.Options()).Check(); nil != err {
+		t.Fatal(err)
+	}
+
+	if err := discord.NewDiscordWithOptions("1", "wrong", server.Options()).Check(); nil == err {
+		t.Fatal("expected the wrong token to be reported")
+	}
+
+	if 0 != len(server.Messages()) {
+		t.Fatalf("expected checks not to post messages, got %+v", server.Messages())
+	}
+}
+
+func TestOptions(t *testing.T) {
+	server := discordtest.NewServer()
+	defer server.Close()
+
+	transport := &recordingTransport{}
+	options := server.Options()
+	options.Transport = transport
+	options.UserAgent = "test-agent"
+
+	if err := discord.NewDiscordWithOptions("1", "token", options).SendDiscordMessage("message"); nil != err {
+		t.Fatal(err)
+	}
+
+	if 1 != len(transport.requests) {
+		t.Fatalf("expected the request to be sent with the transport, got %d requests", len(transport.requests))
+	}
+
+	request := transport.requests[0]
+	if server.Url()+"/webhooks/1/token" != request.URL.String() || "test-agent" != request.Header.Get("User-Agent") {
+		t.Fatalf("got %s with headers %v", request.URL, request.Header)
+	}
+}
+
+func TestPayload(t *testing.T) {
+	client := discord.NewDiscord("1", "token")
+
+	payload, err := client.Payload("<b>Streamer</b> is live & playing", notifier.Event{})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if `{"content":"<b>Streamer</b> is live & playing"}` != string(payload) {
+		t.Fatalf("expected the message unescaped, got %s", payload)
+	}
+}
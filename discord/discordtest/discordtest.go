@@ -0,0 +1,243 @@
+// Package discordtest provides an in-process stand-in for the Discord web hook API used by
+// discord.DiscordClient, which records the messages posted and can be told to fail.
+package discordtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/discord"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+const (
+	// ApiPath is the path of the API on the server, in place of the path of discord.DiscordApiUrl
+	ApiPath string = "/api"
+
+	// RetryAfterSeconds is sent with injected 429 Too Many Requests responses
+	RetryAfterSeconds int = 1
+)
+
+// Message is a message posted to a web hook
+type Message struct {
+	WebHookId  string
+	Content    string
+	ReceivedAt time.Time
+}
+
+// failure is a response injected in place of the next requests
+type failure struct {
+	statusCode int
+	remaining  int
+}
+
+// Server is an in-process Discord API listening on a local port
+type Server struct {
+	server   *httptest.Server
+	lock     sync.Mutex
+	webHooks map[string]string
+	messages []Message
+	failures []*failure
+	received chan struct{}
+}
+
+// NewServer starts a new Server on a random local port. Every web hook is accepted until
+// one is added with AddWebHook.
+func NewServer() *Server {
+	instance := &Server{
+		webHooks: make(map[string]string),
+		received: make(chan struct{}, 1),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(ApiPath+discord.DiscordWebHooksPath+"/", instance.onWebHook)
+	instance.server = httptest.NewServer(mux)
+
+	return instance
+}
+
+// Url returns the base url of the server's API, in place of discord.DiscordApiUrl
+func (s *Server) Url() string {
+	return s.server.URL + ApiPath
+}
+
+// Options returns the options for a discord.DiscordClient which communicates with the server
+func (s *Server) Options() discord.Options {
+	options := discord.DefaultOptions
+	options.ApiUrl = s.Url()
+
+	return options
+}
+
+// Close stops the server
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// AddWebHook adds a web hook, after which requests to unknown web hooks or with the wrong
+// token fail with 404 Not Found and 401 Unauthorized
+func (s *Server) AddWebHook(webHookId string, webHookToken string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.webHooks[webHookId] = webHookToken
+}
+
+// FailNext responds to the next count requests with the status code, without recording any
+// messages. 429 Too Many Requests responses include a Retry-After header.
+func (s *Server) FailNext(statusCode int, count int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.failures = append(s.failures, &failure{
+		statusCode: statusCode,
+		remaining:  count,
+	})
+}
+
+// Messages returns every message posted, in the order they were received
+func (s *Server) Messages() []Message {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]Message{}, s.messages...)
+}
+
+// Reset forgets the messages posted and any failures still to be injected
+func (s *Server) Reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.messages = nil
+	s.failures = nil
+}
+
+// WaitForMessages waits until at least count messages have been posted, returning the
+// messages and whether there were enough before the timeout
+func (s *Server) WaitForMessages(count int, timeout time.Duration) ([]Message, bool) {
+	deadline := time.After(timeout)
+
+	for {
+		messages := s.Messages()
+		if len(messages) >= count {
+			return messages, true
+		}
+
+		select {
+		case <-s.received:
+		case <-deadline:
+			return messages, false
+		}
+	}
+}
+
+// onWebHook handles a request to /api/webhooks/{id}/{token}
+func (s *Server) onWebHook(rw http.ResponseWriter, request *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(request.URL.Path, ApiPath+discord.DiscordWebHooksPath+"/"), "/")
+	if len(parts) != 2 || "" == parts[0] || "" == parts[1] {
+		writeError(rw, http.StatusNotFound, "404: Not Found")
+		return
+	}
+
+	webHookId, webHookToken := parts[0], parts[1]
+
+	s.lock.Lock()
+	statusCode := s.nextFailure()
+	token, known := s.webHooks[webHookId]
+	checked := len(s.webHooks) > 0
+	s.lock.Unlock()
+
+	switch {
+	case 0 != statusCode:
+		if http.StatusTooManyRequests == statusCode {
+			rw.Header().Set("Retry-After", strconv.Itoa(RetryAfterSeconds))
+		}
+		writeError(rw, statusCode, http.StatusText(statusCode))
+		return
+
+	case checked && !known:
+		writeError(rw, http.StatusNotFound, "Unknown Webhook")
+		return
+
+	case checked && token != webHookToken:
+		writeError(rw, http.StatusUnauthorized, "Invalid Webhook Token")
+		return
+	}
+
+	switch request.Method {
+	case http.MethodGet:
+		writeJson(rw, http.StatusOK, map[string]string{
+			"id":    webHookId,
+			"token": webHookToken,
+		})
+
+	case http.MethodPost:
+		var message discord.DiscordWebHookMessage
+		if err := json.NewDecoder(request.Body).Decode(&message); nil != err || "" == message.Message {
+			writeError(rw, http.StatusBadRequest, "Cannot send an empty message")
+			return
+		}
+
+		s.lock.Lock()
+		s.messages = append(s.messages, Message{
+			WebHookId:  webHookId,
+			Content:    message.Message,
+			ReceivedAt: time.Now(),
+		})
+		s.lock.Unlock()
+
+		// Wake anything waiting for messages, without blocking if nothing is
+		select {
+		case s.received <- struct{}{}:
+		default:
+		}
+
+		rw.WriteHeader(http.StatusNoContent)
+
+	default:
+		writeError(rw, http.StatusMethodNotAllowed, http.StatusText(http.StatusMethodNotAllowed))
+	}
+}
+
+// nextFailure returns the status code of the next injected failure, or 0 if there is none.
+// The lock must be held.
+func (s *Server) nextFailure() int {
+	for len(s.failures) > 0 {
+		next := s.failures[0]
+		if next.remaining > 0 {
+			next.remaining--
+			return next.statusCode
+		}
+
+		s.failures = s.failures[1:]
+	}
+
+	return 0
+}
+
+// writeError writes a Discord style JSON error
+func writeError(rw http.ResponseWriter, statusCode int, message string) {
+	writeJson(rw, statusCode, map[string]interface{}{
+		"message": message,
+		"code":    0,
+	})
+}
+
+// writeJson writes the value as a JSON response with the status code
+func writeJson(rw http.ResponseWriter, statusCode int, value interface{}) {
+	body, err := httputil.EncodeJson(value)
+	if nil != err {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set(httputil.HttpContentTypeHeader, httputil.JsonContentType)
+	rw.WriteHeader(statusCode)
+	rw.Write(body)
+}
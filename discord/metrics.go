@@ -0,0 +1,15 @@
+package discord
+
+import (
+	"github.com/mbolt35/multi-twitch-discord-bot/metrics"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+var (
+	requests = httputil.NewRequestMetrics("discord", "Discord web hook")
+
+	rateLimited = metrics.NewCounter(
+		"discord_rate_limited_total",
+		"Discord web hook requests rejected with 429 Too Many Requests.")
+)
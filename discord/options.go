@@ -0,0 +1,31 @@
+package discord
+
+import (
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+// Options configures how a DiscordClient communicates with the Discord API
+type Options struct {
+	// ApiUrl is the base url of the Discord API
+	ApiUrl string
+
+	// ClientOptions configure the http client and user agent
+	httputil.ClientOptions
+}
+
+// DefaultOptions communicate with the public Discord API
+var DefaultOptions = Options{
+	ApiUrl:        DiscordApiUrl,
+	ClientOptions: httputil.DefaultClientOptions,
+}
+
+// withDefaults returns the options with an empty url or user agent replaced by the defaults
+func (o Options) withDefaults() Options {
+	if "" == o.ApiUrl {
+		o.ApiUrl = DefaultOptions.ApiUrl
+	}
+
+	o.ClientOptions = o.ClientOptions.WithDefaults()
+
+	return o
+}
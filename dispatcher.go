@@ -0,0 +1,127 @@
+package main
+
+import (
+	"hash/fnv"
+	"sync"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/metrics"
+)
+
+// Job is a unit of work for a Dispatcher. Jobs with the same key are run one at a time, in
+// the order they were dispatched.
+type Job struct {
+	Key string
+	Run func()
+}
+
+// Dispatcher runs jobs on a fixed number of workers, with a bounded number of jobs waiting.
+// Each key is always handled by the same worker, so jobs for one key keep their order while
+// jobs for different keys run in parallel.
+type Dispatcher struct {
+	lock     sync.Mutex
+	queues   []chan Job
+	pending  int
+	capacity int
+	closed   bool
+	workers  sync.WaitGroup
+}
+
+// NewDispatcher creates a Dispatcher and starts its workers. At most capacity jobs may be
+// waiting or running at once.
+func NewDispatcher(workers int, capacity int) *Dispatcher {
+	instance := Dispatcher{
+		queues:   make([]chan Job, workers),
+		capacity: capacity,
+	}
+
+	for i := range instance.queues {
+		// Reserving capacity up front guarantees sends never block
+		instance.queues[i] = make(chan Job, capacity)
+
+		instance.workers.Add(1)
+		go instance.work(instance.queues[i])
+	}
+
+	return &instance
+}
+
+// Dispatch queues the jobs as a group, or none of them if there isn't room for all of them.
+// Returns false when the dispatcher is full, so the caller can push back on whoever is
+// producing the work.
+func (d *Dispatcher) Dispatch(jobs ...Job) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.closed || d.pending+len(jobs) > d.capacity {
+		return false
+	}
+
+	d.pending += len(jobs)
+	for _, job := range jobs {
+		d.queues[d.partition(job.Key)] <- job
+	}
+
+	return true
+}
+
+// Pending returns the number of jobs waiting or running
+func (d *Dispatcher) Pending() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.pending
+}
+
+// Close stops accepting jobs and waits for the queued jobs to finish
+func (d *Dispatcher) Close() {
+	d.lock.Lock()
+	if d.closed {
+		d.lock.Unlock()
+		return
+	}
+
+	d.closed = true
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.lock.Unlock()
+
+	d.workers.Wait()
+}
+
+// partition returns the index of the worker handling the key
+func (d *Dispatcher) partition(key string) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(key))
+
+	return int(hash.Sum32() % uint32(len(d.queues)))
+}
+
+// work runs the jobs from the queue until it is closed
+func (d *Dispatcher) work(queue chan Job) {
+	defer d.workers.Done()
+
+	for job := range queue {
+		d.run(job)
+
+		d.lock.Lock()
+		d.pending--
+		d.lock.Unlock()
+	}
+}
+
+// run runs a single job, recovering from panics so one bad job can't stop the worker
+func (d *Dispatcher) run(job Job) {
+	defer func() {
+		if recovered := recover(); nil != recovered {
+			jobPanics.Inc()
+			logPanic("Recovered from panic while running job", recovered, "key", job.Key)
+		}
+	}()
+
+	job.Run()
+}
+
+var jobPanics = metrics.NewCounter(
+	"notification_job_panics_total",
+	"Notification processing jobs which panicked.")
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcherKeepsOrderPerKey(t *testing.T) {
+	d := NewDispatcher(4, 100)
+	defer d.Close()
+
+	var lock sync.Mutex
+	order := map[string][]int{}
+
+	for i := 0; i < 20; i++ {
+		for _, key := range []string{"a", "b", "c"} {
+			key, i := key, i
+			ok := d.Dispatch(Job{Key: key, Run: func() {
+				lock.Lock()
+				defer lock.Unlock()
+
+				order[key] = append(order[key], i)
+			}})
+
+			if !ok {
+				t.Fatalf("expected job %s%d to be dispatched", key, i)
+			}
+		}
+	}
+
+	d.Close()
+
+	for _, key := range []string{"a", "b", "c"} {
+		runs := order[key]
+		if 20 != len(runs) {
+			t.Fatalf("expected %s's 20 jobs to run, got %v", key, runs)
+		}
+
+		for i, run := range runs {
+			if i != run {
+				t.Fatalf("expected %s's jobs to run in order, got %v", key, runs)
+			}
+		}
+	}
+}
+
+func TestDispatcherRunsKeysInParallel(t *testing.T) {
+	d := NewDispatcher(2, 10)
+	defer d.Close()
+
+	// Find a key handled by the other worker, so the jobs can't share one
+	other := ""
+	for i := 0; "" == other; i++ {
+		if d.partition(fmt.Sprint(i)) != d.partition("blocked") {
+			other = fmt.Sprint(i)
+		}
+	}
+
+	release := make(chan bool)
+	ran := make(chan bool)
+	d.Dispatch(Job{Key: "blocked", Run: func() { <-release }})
+	d.Dispatch(Job{Key: other, Run: func() { ran <- true }})
+
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("expected a slow job not to hold up other keys")
+	}
+
+	close(release)
+}
+
+func TestDispatcherRefusesWhenFull(t *testing.T) {
+	d := NewDispatcher(1, 2)
+	defer d.Close()
+
+	release := make(chan bool)
+	block := Job{Key: "a", Run: func() { <-release }}
+
+	if !d.Dispatch(block) {
+		t.Fatal("expected the first job to be dispatched")
+	}
+
+	// The group doesn't fit, so none of it is queued
+	if d.Dispatch(block, block) {
+		t.Fatal("expected the group to be refused")
+	}
+
+	if 1 != d.Pending() {
+		t.Fatalf("expected 1 pending job, got %d", d.Pending())
+	}
+
+	if !d.Dispatch(block) {
+		t.Fatal("expected a job to fit")
+	}
+
+	close(release)
+	d.Close()
+
+	if 0 != d.Pending() {
+		t.Fatalf("expected no pending jobs, got %d", d.Pending())
+	}
+}
+
+func TestDispatcherCloseWaitsForJobs(t *testing.T) {
+	d := NewDispatcher(2, 10)
+
+	var lock sync.Mutex
+	finished := 0
+	for i := 0; i < 5; i++ {
+		d.Dispatch(Job{Key: fmt.Sprint(i), Run: func() {
+			time.Sleep(10 * time.Millisecond)
+
+			lock.Lock()
+			defer lock.Unlock()
+			finished++
+		}})
+	}
+
+	d.Close()
+	d.Close()
+
+	if 5 != finished {
+		t.Fatalf("expected every job to finish, %d did", finished)
+	}
+
+	if d.Dispatch(Job{Key: "late", Run: func() {}}) {
+		t.Fatal("expected a closed dispatcher to refuse jobs")
+	}
+}
+
+func TestDispatcherRecoversFromPanics(t *testing.T) {
+	d := NewDispatcher(1, 10)
+
+	ran := false
+	d.Dispatch(
+		Job{Key: "a", Run: func() { panic("boom") }},
+		Job{Key: "a", Run: func() { ran = true }})
+
+	d.Close()
+
+	if !ran {
+		t.Fatal("expected the worker to keep running after a panic")
+	}
+}
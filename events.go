@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/metrics"
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+const (
+	// EventKeyPrefix prefixes the storage keys of deliveries waiting to be processed
+	EventKeyPrefix string = "event:"
+
+	// EventTTL is how long an unprocessed delivery is kept for processing after a restart
+	EventTTL time.Duration = DeliveryTTL
+)
+
+// storedEvent is a notification delivery persisted until it has been processed, so it
+// survives a restart between being acknowledged and being announced
+type storedEvent struct {
+	Id         string          `json:"id"`
+	MessageId  string          `json:"message_id,omitempty"`
+	Topic      string          `json:"topic,omitempty"`
+	ReceivedAt time.Time       `json:"received_at"`
+	Body       json.RawMessage `json:"body"`
+
+	// BypassDedup announces the notifications even if their streams were already announced,
+	// for replays
+	BypassDedup bool `json:"bypass_dedup,omitempty"`
+}
+
+var (
+	dispatcher *Dispatcher
+
+	deliveriesRejected = metrics.NewCounter(
+		"notification_deliveries_rejected_total",
+		"Notification deliveries refused with 503 so Twitch retries them, by reason.",
+		"reason")
+
+	_ = metrics.NewGaugeFunc(
+		"notification_queue_depth",
+		"Notifications waiting to be processed or being processed.",
+		func() float64 {
+			if nil == dispatcher {
+				return 0
+			}
+
+			return float64(dispatcher.Pending())
+		})
+)
+
+// persistEvent stores the delivery until it has been processed
+func persistEvent(event *storedEvent) error {
+	eventBytes, err := httputil.EncodeJson(event)
+	if nil != err {
+		return err
+	}
+
+	return backingStore.SetWithTTL(EventKeyPrefix+event.Id, string(bytes.TrimSpace(eventBytes)), EventTTL)
+}
+
+// dispatchEvent queues a job for each notification in the delivery, keyed by streamer so
+// each streamer's notifications are processed in order. The stored event is removed once
+// every job has finished. Returns false if the dispatcher had no room for the delivery.
+func dispatchEvent(logger *logutil.Logger, announcer *Announcer, event *storedEvent, payload *twitch.TwitchNotificationPayload) bool {
+	jobs := []Job{}
+
+	// A delivery without notifications means the stream went offline
+	if len(payload.Notifications) == 0 {
+		userId := twitch.UserIdFromTopic(event.Topic)
+		if "" != userId {
+			jobs = append(jobs, Job{
+				Key: userId,
+				Run: func() {
+					logger.Info("Stream went offline", "user_id", userId)
+					status.RecordOffline(userId)
+				},
+			})
+		}
+	}
+
+	for i := range payload.Notifications {
+		notification := payload.Notifications[i]
+		jobs = append(jobs, Job{
+			Key: notification.UserId,
+			Run: func() {
+				processNotification(logger, announcer, &notification, event.BypassDedup)
+			},
+		})
+	}
+
+	if len(jobs) == 0 {
+		removeEvent(logger, event)
+		return true
+	}
+
+	// The last job to finish removes the stored event, so it's done before the dispatcher
+	// finishes closing
+	remaining := int32(len(jobs))
+	for i := range jobs {
+		run := jobs[i].Run
+		jobs[i].Run = func() {
+			defer func() {
+				if 0 == atomic.AddInt32(&remaining, -1) {
+					removeEvent(logger, event)
+				}
+			}()
+
+			run()
+		}
+	}
+
+	return dispatcher.Dispatch(jobs...)
+}
+
+// removeEvent deletes the stored event once it has been processed
+func removeEvent(logger *logutil.Logger, event *storedEvent) {
+	if err := backingStore.Delete(EventKeyPrefix + event.Id); nil != err {
+		logger.Error("Failed to remove processed delivery", logutil.ErrorKey, err)
+	}
+}
+
+// processNotification announces the notification's stream if it just went live, or always
+// when bypassing the duplicate checks
+func processNotification(logger *logutil.Logger, announcer *Announcer, notification *twitch.TwitchNotification, bypassDedup bool) {
+	logNotification(logger, notification)
+	notificationsReceived.Inc(notificationType(notification))
+	status.RecordLive(notification)
+
+	// Don't Send Messages for Duplicates or Title/Game Updates
+	if bypassDedup || isLiveNotification(logger, notification) {
+		announcer.Announce(logger, notification)
+	}
+}
+
+// RecoverEvents dispatches the deliveries which were acknowledged, but not processed, before
+// the bot last stopped
+func RecoverEvents() {
+	stored, err := backingStore.List(EventKeyPrefix)
+	if nil != err {
+		logutil.Error("Failed to list unprocessed deliveries", logutil.ErrorKey, err)
+		return
+	}
+
+	events := []*storedEvent{}
+	for key, value := range stored {
+		var event storedEvent
+		if err := json.Unmarshal([]byte(value), &event); nil != err {
+			logutil.Error("Discarding unreadable delivery", "key", key, logutil.ErrorKey, err)
+			backingStore.Delete(key)
+			continue
+		}
+
+		events = append(events, &event)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].ReceivedAt.Before(events[j].ReceivedAt)
+	})
+
+	announcer := currentAnnouncer()
+	for _, event := range events {
+		logger := logutil.With("correlation_id", event.Id)
+
+		var payload twitch.TwitchNotificationPayload
+		if err := json.Unmarshal(event.Body, &payload); nil != err {
+			logger.Error("Discarding unreadable delivery", logutil.ErrorKey, err)
+			removeEvent(logger, event)
+			continue
+		}
+
+		if !dispatchEvent(logger, announcer, event, &payload) {
+			logger.Warn("No room to process recovered delivery, leaving it for the next start")
+			continue
+		}
+
+		logger.Info("Recovered unprocessed delivery", "received_at", event.ReceivedAt)
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/notifier"
+	"github.com/mbolt35/multi-twitch-discord-bot/settings"
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+const (
+	// HealthEndPoint reports whether the process is alive
+	HealthEndPoint string = "healthz"
+
+	// ReadyEndPoint reports whether the bot is able to announce streams
+	ReadyEndPoint string = "readyz"
+
+	// StatusOk is reported for passing checks
+	StatusOk string = "ok"
+
+	// StatusFailed is reported for failing checks
+	StatusFailed string = "failed"
+
+	// ExternalCheckTTL is how long the results of checks against Twitch and Discord are reused,
+	// so frequent probes don't spend API rate limits
+	ExternalCheckTTL time.Duration = time.Minute
+
+	// LeaseExpiryMargin is how close to expiring a subscription lease may be before the bot
+	// is no longer considered ready
+	LeaseExpiryMargin time.Duration = time.Hour
+)
+
+// CheckResult is the outcome of a single health check
+type CheckResult struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// HealthReport is the JSON body of the health and readiness end points
+type HealthReport struct {
+	Status string                 `json:"status"`
+	Checks map[string]CheckResult `json:"checks,omitempty"`
+}
+
+// cachedCheck reuses the result of a check until it is older than the ttl
+type cachedCheck struct {
+	lock   sync.Mutex
+	ttl    time.Duration
+	check  func() error
+	result CheckResult
+}
+
+// newCachedCheck creates a cachedCheck for the check function
+func newCachedCheck(ttl time.Duration, check func() error) *cachedCheck {
+	instance := cachedCheck{
+		ttl:   ttl,
+		check: check,
+	}
+
+	return &instance
+}
+
+// Result returns the cached result, running the check if it has expired
+func (c *cachedCheck) Result() CheckResult {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.result.CheckedAt.IsZero() || time.Since(c.result.CheckedAt) >= c.ttl {
+		c.result = runCheck(c.check)
+	}
+
+	return c.result
+}
+
+// runCheck runs the check function, converting its error into a result
+func runCheck(check func() error) CheckResult {
+	result := CheckResult{
+		Status:    StatusOk,
+		CheckedAt: time.Now().UTC(),
+	}
+
+	if err := check(); nil != err {
+		result.Status = StatusFailed
+		result.Error = logutil.Scrub(err.Error())
+	}
+
+	return result
+}
+
+var (
+	twitchCheck = newCachedCheck(ExternalCheckTTL, func() error {
+		return twitchClient.CheckCredentials()
+	})
+
+	destinationChecksLock sync.Mutex
+	destinationChecks     = make(map[string]*destinationCheck)
+)
+
+// checkSubscriptions verifies every announced streamer has a verified subscription whose
+// lease isn't about to expire
+func checkSubscriptions(userIds []string) error {
+	subscriptions := twitchClient.Subscriptions()
+
+	problems := []string{}
+	for _, userId := range userIds {
+		subscription, ok := subscriptions.Get(userId)
+		switch {
+		case !ok:
+			problems = append(problems, userId+": not subscribed")
+
+		case twitch.SubscriptionVerified != subscription.State:
+			problems = append(problems, userId+": "+subscription.State)
+
+		case time.Until(subscription.ExpiresAt) < LeaseExpiryMargin:
+			problems = append(problems, userId+": lease expires at "+subscription.ExpiresAt.UTC().Format(time.RFC3339))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return errors.New(strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// destinationCheck is the cached check of a destination's web hook
+type destinationCheck struct {
+	client notifier.Notifier
+	check  *cachedCheck
+}
+
+// webHookCheck returns the cached check of the named destination's web hook
+func webHookCheck(name string, announcer *Announcer) *cachedCheck {
+	destinationChecksLock.Lock()
+	defer destinationChecksLock.Unlock()
+
+	// Destinations are recreated when the configuration is reloaded
+	client := announcer.Destinations()[name]
+	destination, ok := destinationChecks[name]
+	if !ok || destination.client != client {
+		destination = &destinationCheck{
+			client: client,
+			check:  newCachedCheck(ExternalCheckTTL, client.Check),
+		}
+		destinationChecks[name] = destination
+	}
+
+	return destination.check
+}
+
+// lastDeliveryCheck checks the destination passively: its url must be configured, and the
+// last announcement sent to it must not have failed. Every request to a generic web hook is
+// an event its receiver acts on, so readiness probes never ping one.
+func lastDeliveryCheck(destination settings.DestinationConfig) error {
+	if "" == destination.WebHookUrl {
+		return errors.New("no web hook url")
+	}
+
+	if delivery, ok := status.LastDelivery(destination.Name); ok && "" != delivery.Error {
+		return errors.New("last announcement failed: " + delivery.Error)
+	}
+
+	return nil
+}
+
+// Readiness runs every readiness check
+func Readiness() HealthReport {
+	announcer := currentAnnouncer()
+
+	report := HealthReport{
+		Status: StatusOk,
+		Checks: map[string]CheckResult{
+			"storage": runCheck(backingStore.Ping),
+			"twitch":  twitchCheck.Result(),
+			"subscriptions": runCheck(func() error {
+				return checkSubscriptions(announcer.UserIds())
+			}),
+		},
+	}
+
+	for _, destination := range announcer.Config().Destinations {
+		name := destination.Type + ":" + destination.Name
+		if settings.WebHookDestinationType == destination.Type {
+			report.Checks[name] = runCheck(func() error {
+				return lastDeliveryCheck(destination)
+			})
+			continue
+		}
+
+		report.Checks[name] = webHookCheck(destination.Name, announcer).Result()
+	}
+
+	for _, result := range report.Checks {
+		if StatusOk != result.Status {
+			report.Status = StatusFailed
+		}
+	}
+
+	return report
+}
+
+// writeReport writes the report as JSON, with 503 Service Unavailable if it failed
+func writeReport(rw http.ResponseWriter, report HealthReport) {
+	jsonBytes, err := httputil.EncodeJson(report)
+	if nil != err {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set(httputil.HttpContentTypeHeader, httputil.JsonContentType)
+	if StatusOk != report.Status {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	rw.Write(jsonBytes)
+}
+
+// OnHealth reports the process is alive. It never checks dependencies, so a struggling
+// dependency doesn't get the process restarted.
+func OnHealth(rw http.ResponseWriter, request *http.Request) {
+	writeReport(rw, HealthReport{Status: StatusOk})
+}
+
+// OnReady reports whether storage, Twitch, the subscriptions and every Discord web hook
+// are all working
+func OnReady(rw http.ResponseWriter, request *http.Request) {
+	writeReport(rw, Readiness())
+}
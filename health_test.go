@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/settings"
+)
+
+// getReport requests the health or readiness end point, returning the status code and report
+func getReport(t *testing.T, bot *testBot, endPoint string) (int, HealthReport, string) {
+	resp, err := http.Get(bot.server.URL + "/" + endPoint)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	var report HealthReport
+	if err := json.Unmarshal(body, &report); nil != err {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, report, string(body)
+}
+
+func TestHealth(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	code, report, _ := getReport(t, bot, HealthEndPoint)
+	if http.StatusOK != code || StatusOk != report.Status || 0 != len(report.Checks) {
+		t.Fatalf("got %d %+v", code, report)
+	}
+}
+
+func TestReady(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	code, report, _ := getReport(t, bot, ReadyEndPoint)
+	if http.StatusOK != code || StatusOk != report.Status {
+		t.Fatalf("got %d %+v", code, report)
+	}
+
+	for _, name := range []string{"storage", "twitch", "subscriptions", "discord:default"} {
+		if result, ok := report.Checks[name]; !ok || StatusOk != result.Status || result.CheckedAt.IsZero() {
+			t.Errorf("%s: got %+v", name, result)
+		}
+	}
+}
+
+func TestReadyReportsFailures(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	// A streamer whose subscription is denied, and a web hook with the wrong token
+	bot.twitch.AddUser("7", "other", "Other")
+	bot.twitch.Deny("7", "banned")
+	twitchClient.SubscribeToStreams(notifyUrl(), []string{"7"})
+	bot.twitch.WaitForCallbacks()
+
+	next := bot.config()
+	next.Streamers = append(next.Streamers, settings.StreamerConfig{Login: "other"})
+	next.Destinations[0].WebHookToken = "wrong-token"
+
+	users, err := twitchClient.UsersFor(next.Logins())
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	nextAnnouncer, err := NewAnnouncer(next, users, twitchClient.GameName)
+	if nil != err {
+		t.Fatal(err)
+	}
+	setAnnouncer(nextAnnouncer)
+
+	code, report, body := getReport(t, bot, ReadyEndPoint)
+	if http.StatusServiceUnavailable != code || StatusFailed != report.Status {
+		t.Fatalf("got %d %+v", code, report)
+	}
+
+	if StatusOk != report.Checks["storage"].Status || StatusOk != report.Checks["twitch"].Status {
+		t.Errorf("expected storage and twitch to pass, got %+v", report.Checks)
+	}
+
+	if result := report.Checks["subscriptions"]; StatusFailed != result.Status || "7: denied" != result.Error {
+		t.Errorf("subscriptions: got %+v", result)
+	}
+
+	if result := report.Checks["discord:default"]; StatusFailed != result.Status {
+		t.Errorf("discord:default: got %+v", result)
+	}
+
+	// Errors include the web hook url, which must not leak its token
+	if strings.Contains(body, "wrong-token") {
+		t.Errorf("expected the web hook token to be scrubbed from %s", body)
+	}
+}
+
+func TestReadyDoesNotPingWebHooks(t *testing.T) {
+	var requests int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		atomic.AddInt32(&requests, 1)
+	}))
+	defer receiver.Close()
+
+	bot := startTestBot(t, func(config *settings.Config) {
+		config.Destinations = append(config.Destinations, settings.DestinationConfig{
+			Name:       "hooks",
+			Type:       settings.WebHookDestinationType,
+			WebHookUrl: receiver.URL,
+		})
+	})
+	defer bot.Close()
+
+	code, report, _ := getReport(t, bot, ReadyEndPoint)
+	if http.StatusOK != code || StatusOk != report.Checks["webhook:hooks"].Status {
+		t.Fatalf("got %d %+v", code, report)
+	}
+
+	if count := atomic.LoadInt32(&requests); 0 != count {
+		t.Fatalf("expected the web hook not to be contacted, got %d requests", count)
+	}
+
+	// The last announcement's result is reported instead
+	status.RecordDelivery("42", "hooks", errors.New("503 Service Unavailable"))
+
+	code, report, _ = getReport(t, bot, ReadyEndPoint)
+	if result := report.Checks["webhook:hooks"]; http.StatusServiceUnavailable != code || StatusFailed != result.Status ||
+		!strings.Contains(result.Error, "503 Service Unavailable") {
+		t.Fatalf("got %d %+v", code, result)
+	}
+
+	if count := atomic.LoadInt32(&requests); 0 != count {
+		t.Fatalf("expected the web hook not to be contacted, got %d requests", count)
+	}
+}
+
+func TestCachedCheckReusesResults(t *testing.T) {
+	calls := 0
+	check := newCachedCheck(ExternalCheckTTL, func() error {
+		calls++
+		return nil
+	})
+
+	first := check.Result()
+	second := check.Result()
+
+	if 1 != calls || first != second {
+		t.Fatalf("expected one call and the same result, got %d calls", calls)
+	}
+
+	expired := newCachedCheck(0, func() error {
+		calls++
+		return nil
+	})
+	expired.Result()
+	expired.Result()
+
+	if 3 != calls {
+		t.Fatalf("expected an expired result to be checked again, got %d calls", calls)
+	}
+}
@@ -0,0 +1,173 @@
+// Package matrix announces go live events to Matrix rooms through the client-server API, as
+// m.room.message events with an HTML body.
+package matrix
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/notifier"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+const (
+	// MatrixApiUrl is the base url of the matrix.org homeserver
+	MatrixApiUrl string = "https://matrix-client.matrix.org"
+
+	// MatrixRoomsPath is the path of the client-server API's rooms
+	MatrixRoomsPath string = "/_matrix/client/r0/rooms"
+
+	// MessageEventType is the type of the events announcements are sent as
+	MessageEventType string = "m.room.message"
+
+	// HtmlFormat is the format of formatted message bodies
+	HtmlFormat string = "org.matrix.custom.html"
+)
+
+// Message is the content of an m.room.message event. Body is shown by clients which can't
+// show the formatted body.
+type Message struct {
+	MsgType       string `json:"msgtype"`
+	Body          string `json:"body"`
+	Format        string `json:"format,omitempty"`
+	FormattedBody string `json:"formatted_body,omitempty"`
+}
+
+// matrix is a notifier.Notifier for a Matrix room
+type matrix struct {
+	roomId      string
+	accessToken string
+	apiUrl      string
+	userAgent   string
+	httpClient  *http.Client
+}
+
+var _ notifier.Notifier = &matrix{}
+var _ notifier.Escaper = &matrix{}
+
+// NewMatrix creates a Notifier which sends messages to the room as the user with the access
+// token. The user must have joined the room.
+func NewMatrix(roomId string, accessToken string, options Options) notifier.Notifier {
+	options = options.withDefaults()
+
+	instance := matrix{
+		roomId:      roomId,
+		accessToken: accessToken,
+		apiUrl:      options.ApiUrl,
+		userAgent:   options.UserAgent,
+		httpClient:  options.NewClient(),
+	}
+
+	return &instance
+}
+
+// Escape leaves what templates insert into the message alone, since the plain body has no
+// markup
+func (m *matrix) Escape(text string) string {
+	return text
+}
+
+// NewMessage renders the event as HTML, with the message as its plain body
+func NewMessage(message string, event notifier.Event) Message {
+	formatted := fmt.Sprintf(`<p><strong><a href="%s">%s</a></strong> is now live!</p>`,
+		html.EscapeString(event.Url), html.EscapeString(event.DisplayName))
+
+	if "" != event.Title {
+		formatted += "<p>" + html.EscapeString(event.Title) + "</p>"
+	}
+
+	if game := event.Game(); "" != game {
+		formatted += "<p><em>Playing " + html.EscapeString(game) + "</em></p>"
+	}
+
+	return Message{
+		MsgType:       "m.text",
+		Body:          message,
+		Format:        HtmlFormat,
+		FormattedBody: formatted,
+	}
+}
+
+// getRoomUrl returns the url of the room's path in the client-server API
+func getRoomUrl(apiUrl string, roomId string, path string) string {
+	return httputil.JoinUrl(apiUrl, MatrixRoomsPath) + "/" + url.PathEscape(roomId) + path
+}
+
+// Payload returns the content of the message event announcing the event
+func (m *matrix) Payload(message string, event notifier.Event) (json.RawMessage, error) {
+	jsonBytes, err := httputil.EncodeJson(NewMessage(message, event))
+	if nil != err {
+		return nil, err
+	}
+
+	return json.RawMessage(bytes.TrimSpace(jsonBytes)), nil
+}
+
+// Notify sends the message event announcing the event to the room
+func (m *matrix) Notify(message string, event notifier.Event) error {
+	body, err := m.Payload(message, event)
+	if nil != err {
+		return err
+	}
+
+	// Each announcement is a new transaction, which is never retried, so the transaction id
+	// only has to be unique
+	path := "/send/" + MessageEventType + "/" + logutil.NewCorrelationId()
+	if err := m.send(http.MethodPut, path, bytes.NewReader(body)); nil != err {
+		return err
+	}
+
+	logutil.Debug("Sent Matrix message", "room_id", m.roomId)
+	return nil
+}
+
+// Check verifies the access token is accepted and the user has joined the room, without
+// sending a message
+func (m *matrix) Check() error {
+	return m.send(http.MethodGet, "/joined_members", nil)
+}
+
+// send sends an authenticated request to the room's path, failing on error responses
+func (m *matrix) send(method string, path string, body io.Reader) error {
+	request, err := http.NewRequest(method, getRoomUrl(m.apiUrl, m.roomId, path), body)
+	if nil != err {
+		return err
+	}
+
+	if nil != body {
+		request.Header.Set(httputil.HttpContentTypeHeader, httputil.JsonContentType)
+	}
+	request.Header.Set("Authorization", "Bearer "+m.accessToken)
+	request.Header.Set(httputil.HttpUserAgentHeader, m.userAgent)
+
+	resp, err := requests.Do(m.httpClient, request)
+	if nil != err {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		var matrixError struct {
+			ErrCode string `json:"errcode"`
+			Error   string `json:"error"`
+		}
+
+		response, _ := ioutil.ReadAll(resp.Body)
+		if nil == json.Unmarshal(response, &matrixError) && "" != matrixError.ErrCode {
+			return fmt.Errorf("Matrix returned %s: %s %s", resp.Status, matrixError.ErrCode, matrixError.Error)
+		}
+
+		return fmt.Errorf("Matrix returned %s", resp.Status)
+	}
+
+	return nil
+}
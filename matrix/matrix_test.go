@@ -0,0 +1,154 @@
+package matrix_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/matrix"
+	"github.com/mbolt35/multi-twitch-discord-bot/notifier"
+)
+
+// homeserver is a stand-in client-server API, recording the requests made to it
+type homeserver struct {
+	*httptest.Server
+	lock     sync.Mutex
+	requests []*http.Request
+	bodies   []string
+}
+
+// newHomeserver starts a homeserver which accepts the access token
+func newHomeserver(accessToken string) *homeserver {
+	instance := &homeserver{}
+	instance.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+
+		instance.lock.Lock()
+		instance.requests = append(instance.requests, request)
+		instance.bodies = append(instance.bodies, string(body))
+		instance.lock.Unlock()
+
+		if "Bearer "+accessToken != request.Header.Get("Authorization") {
+			rw.WriteHeader(http.StatusUnauthorized)
+			rw.Write([]byte(`{"errcode":"M_UNKNOWN_TOKEN","error":"Invalid access token"}`))
+			return
+		}
+
+		rw.Write([]byte(`{}`))
+	}))
+
+	return instance
+}
+
+// Request returns the request and its body
+func (h *homeserver) Request(i int) (*http.Request, string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	return h.requests[i], h.bodies[i]
+}
+
+// options communicate with the homeserver
+func (h *homeserver) options() matrix.Options {
+	options := matrix.DefaultOptions
+	options.ApiUrl = h.URL
+
+	return options
+}
+
+func TestNewMessage(t *testing.T) {
+	event := notifier.Event{DisplayName: "A<B", Title: "Tips & tricks", GameId: "509658", GameName: "Just Chatting", Url: "http://twitch.tv/ab"}
+
+	message := matrix.NewMessage("A<B is now live!", event)
+	if "m.text" != message.MsgType || "A<B is now live!" != message.Body || matrix.HtmlFormat != message.Format {
+		t.Fatalf("got %+v", message)
+	}
+
+	expected := `<p><strong><a href="http://twitch.tv/ab">A&lt;B</a></strong> is now live!</p>` +
+		`<p>Tips &amp; tricks</p><p><em>Playing Just Chatting</em></p>`
+	if expected != message.FormattedBody {
+		t.Fatalf("expected %q, got %q", expected, message.FormattedBody)
+	}
+
+	// The game's id is shown when its name wasn't looked up
+	event.GameName = ""
+	if !strings.HasSuffix(matrix.NewMessage("live", event).FormattedBody, "<p><em>Playing 509658</em></p>") {
+		t.Fatalf("got %q", matrix.NewMessage("live", event).FormattedBody)
+	}
+}
+
+func TestNewMessageBodyIsUnescaped(t *testing.T) {
+	message := matrix.NewMessage("A_B *is* now live!", notifier.Event{DisplayName: "A_B"})
+	if "A_B *is* now live!" != message.Body {
+		t.Fatalf("expected the body to be the message exactly, got %q", message.Body)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	server := newHomeserver("token")
+	defer server.Close()
+
+	client := matrix.NewMatrix("!room:example.org", "token", server.options())
+	event := notifier.Event{DisplayName: "Streamer", Url: "http://twitch.tv/streamer"}
+	for i := 0; i < 2; i++ {
+		if err := client.Notify("live", event); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	first, body := server.Request(0)
+	second, _ := server.Request(1)
+
+	prefix := "/_matrix/client/r0/rooms/%21room:example.org/send/m.room.message/"
+	if http.MethodPut != first.Method || !strings.HasPrefix(first.URL.EscapedPath(), prefix) {
+		t.Fatalf("got %s %s", first.Method, first.URL.EscapedPath())
+	}
+
+	// Each announcement is its own transaction
+	if first.URL.Path == second.URL.Path {
+		t.Fatalf("expected a new transaction id for each announcement, got %s twice", first.URL.Path)
+	}
+
+	payload, _ := client.Payload("live", event)
+	if string(payload) != body {
+		t.Fatalf("expected the payload to be sent, got %s", body)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	server := newHomeserver("token")
+	defer server.Close()
+
+	if err := matrix.NewMatrix("!room:example.org", "token", server.options()).Check(); nil != err {
+		t.Fatal(err)
+	}
+
+	if request, _ := server.Request(0); http.MethodGet != request.Method || !strings.HasSuffix(request.URL.Path, "/joined_members") {
+		t.Fatalf("expected the room's members to be looked up, got %s %s", request.Method, request.URL.Path)
+	}
+
+	err := matrix.NewMatrix("!room:example.org", "wrong", server.options()).Check()
+	if nil == err || !strings.Contains(err.Error(), "M_UNKNOWN_TOKEN") {
+		t.Fatalf("expected the Matrix error to be reported, got %v", err)
+	}
+}
+
+func TestPayload(t *testing.T) {
+	payload, err := matrix.NewMatrix("!room:example.org", "token", matrix.DefaultOptions).Payload("live", notifier.Event{Url: "http://twitch.tv/ab"})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]string
+	if err := json.Unmarshal(payload, &decoded); nil != err {
+		t.Fatal(err)
+	}
+
+	if "live" != decoded["body"] || matrix.HtmlFormat != decoded["format"] || "" == decoded["formatted_body"] {
+		t.Fatalf("got %v", decoded)
+	}
+}
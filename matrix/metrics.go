@@ -0,0 +1,7 @@
+package matrix
+
+import (
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+var requests = httputil.NewRequestMetrics("matrix", "Matrix client-server API")
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/metrics"
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+)
+
+const (
+	// DuplicateDelivery labels deliveries suppressed because Twitch retried them
+	DuplicateDelivery string = "delivery"
+
+	// DuplicateStartTime labels notifications suppressed because the stream start time was unchanged
+	DuplicateStartTime string = "start_time"
+
+	// DuplicateStream labels notifications suppressed because the stream was already announced
+	DuplicateStream string = "stream"
+)
+
+var (
+	notificationsReceived = metrics.NewCounter(
+		"notifications_received_total",
+		"Twitch stream notifications received, by notification type.",
+		"type")
+
+	duplicatesSuppressed = metrics.NewCounter(
+		"notifications_duplicates_suppressed_total",
+		"Deliveries and notifications that weren't announced because they were duplicates, by reason.",
+		"reason")
+
+	announcements = metrics.NewCounter(
+		"announcements_total",
+		"Announcements sent to destinations, by destination and result.",
+		"destination", "result")
+
+	_ = metrics.NewGaugeVecFunc(
+		"twitch_subscriptions",
+		"Twitch web hook subscriptions, by state.",
+		"state",
+		func() map[string]float64 {
+			counts := map[string]float64{}
+			if nil == twitchClient {
+				return counts
+			}
+
+			for state, count := range twitchClient.Subscriptions().CountByState() {
+				counts[state] = float64(count)
+			}
+
+			return counts
+		})
+
+	_ = metrics.NewGaugeFunc(
+		"twitch_subscription_next_expiry_seconds",
+		"Seconds until the next verified subscription lease expires, or -1 if none are verified.",
+		func() float64 {
+			if nil == twitchClient {
+				return -1
+			}
+
+			next, ok := twitchClient.Subscriptions().NextExpiry()
+			if !ok {
+				return -1
+			}
+
+			return time.Until(next).Seconds()
+		})
+)
+
+// notificationType returns the type label for a notification
+func notificationType(notification *twitch.TwitchNotification) string {
+	if "" == notification.Type {
+		return "unknown"
+	}
+
+	return notification.Type
+}
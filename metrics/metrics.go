@@ -0,0 +1,400 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// ContentType is the Prometheus text exposition format content type
+	ContentType string = "text/plain; version=0.0.4; charset=utf-8"
+
+	// labelSeparator joins label values into a single map key
+	labelSeparator string = "\xff"
+)
+
+// DefaultBuckets are the histogram buckets for request latencies, in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// collector is a metric family which can write itself in the text exposition format
+type collector interface {
+	Name() string
+	write(w *bufio.Writer)
+}
+
+// Registry holds the metric families exposed by a metrics endpoint
+type Registry struct {
+	lock       sync.Mutex
+	collectors map[string]collector
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	instance := Registry{
+		collectors: make(map[string]collector),
+	}
+
+	return &instance
+}
+
+// Default is the registry metrics are registered with when created
+var Default = NewRegistry()
+
+// Register adds the metric family to the registry. Registering two families with the same
+// name is a programming error, so it panics.
+func (r *Registry) Register(c collector) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, exists := r.collectors[c.Name()]; exists {
+		panic("metrics: duplicate metric " + c.Name())
+	}
+
+	r.collectors[c.Name()] = c
+}
+
+// ServeHTTP writes every metric family in the text exposition format
+func (r *Registry) ServeHTTP(rw http.ResponseWriter, request *http.Request) {
+	r.lock.Lock()
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+
+	collectors := make([]collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		collectors = append(collectors, r.collectors[name])
+	}
+	r.lock.Unlock()
+
+	rw.Header().Set("Content-Type", ContentType)
+
+	writer := bufio.NewWriter(rw)
+	for _, c := range collectors {
+		c.write(writer)
+	}
+
+	writer.Flush()
+}
+
+// desc describes a metric family
+type desc struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+}
+
+// Name returns the name of the metric family
+func (d *desc) Name() string {
+	return d.name
+}
+
+// writeHeader writes the HELP and TYPE lines of the family
+func (d *desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.metricType)
+}
+
+// key joins the label values into a map key, checking they match the label names
+func (d *desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labelNames) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labelNames), len(labelValues)))
+	}
+
+	return strings.Join(labelValues, labelSeparator)
+}
+
+// labels formats the label names and values, plus any extra label, for a sample line
+func (d *desc) labels(key string, extraName string, extraValue string) string {
+	pairs := []string{}
+	if len(d.labelNames) > 0 {
+		for i, value := range strings.Split(key, labelSeparator) {
+			pairs = append(pairs, d.labelNames[i]+"=\""+escapeLabel(value)+"\"")
+		}
+	}
+
+	if "" != extraName {
+		pairs = append(pairs, extraName+"=\""+escapeLabel(extraValue)+"\"")
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter is a family of monotonically increasing values, one per combination of labels
+type Counter struct {
+	desc
+	lock   sync.Mutex
+	values map[string]float64
+}
+
+// NewCounter creates a Counter and registers it with the Default registry
+func NewCounter(name string, help string, labelNames ...string) *Counter {
+	instance := Counter{
+		desc:   desc{name: name, help: help, metricType: "counter", labelNames: labelNames},
+		values: make(map[string]float64),
+	}
+
+	// Metrics without labels are reported from the start
+	if len(labelNames) == 0 {
+		instance.values[""] = 0
+	}
+
+	Default.Register(&instance)
+	return &instance
+}
+
+// Inc adds one to the counter with the label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds the non-negative delta to the counter with the label values
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		panic("metrics: counter " + c.name + " cannot decrease")
+	}
+
+	key := c.key(labelValues)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.values[key] += delta
+}
+
+// write writes the counter's samples
+func (c *Counter) write(w *bufio.Writer) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.writeHeader(w)
+	for _, key := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, c.labels(key, "", ""), formatFloat(c.values[key]))
+	}
+}
+
+// Gauge is a family of values which may go up and down, one per combination of labels
+type Gauge struct {
+	desc
+	lock   sync.Mutex
+	values map[string]float64
+}
+
+// NewGauge creates a Gauge and registers it with the Default registry
+func NewGauge(name string, help string, labelNames ...string) *Gauge {
+	instance := Gauge{
+		desc:   desc{name: name, help: help, metricType: "gauge", labelNames: labelNames},
+		values: make(map[string]float64),
+	}
+
+	if len(labelNames) == 0 {
+		instance.values[""] = 0
+	}
+
+	Default.Register(&instance)
+	return &instance
+}
+
+// Set sets the gauge with the label values
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	key := g.key(labelValues)
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.values[key] = value
+}
+
+// Add adds the delta to the gauge with the label values
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	key := g.key(labelValues)
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.values[key] += delta
+}
+
+// write writes the gauge's samples
+func (g *Gauge) write(w *bufio.Writer) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.writeHeader(w)
+	for _, key := range sortedKeys(g.values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labels(key, "", ""), formatFloat(g.values[key]))
+	}
+}
+
+// GaugeFunc is a gauge whose values are computed when scraped
+type GaugeFunc struct {
+	desc
+	collect func() map[string]float64
+}
+
+// NewGaugeFunc creates a GaugeFunc with a single value and registers it with the Default
+// registry. The function is called on every scrape, so it must be cheap and safe to call
+// concurrently.
+func NewGaugeFunc(name string, help string, collect func() float64) *GaugeFunc {
+	instance := GaugeFunc{
+		desc: desc{name: name, help: help, metricType: "gauge"},
+		collect: func() map[string]float64 {
+			return map[string]float64{"": collect()}
+		},
+	}
+
+	Default.Register(&instance)
+	return &instance
+}
+
+// NewGaugeVecFunc creates a GaugeFunc with one value per value of the label, and registers
+// it with the Default registry
+func NewGaugeVecFunc(name string, help string, labelName string, collect func() map[string]float64) *GaugeFunc {
+	instance := GaugeFunc{
+		desc:    desc{name: name, help: help, metricType: "gauge", labelNames: []string{labelName}},
+		collect: collect,
+	}
+
+	Default.Register(&instance)
+	return &instance
+}
+
+// write writes the gauge's samples
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	values := g.collect()
+
+	g.writeHeader(w)
+	for _, key := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s%s %s\n", g.name, g.labels(key, "", ""), formatFloat(values[key]))
+	}
+}
+
+// histogramValue holds the observations of a single histogram
+type histogramValue struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// Histogram is a family of distributions of observed values, one per combination of labels
+type Histogram struct {
+	desc
+	buckets []float64
+	lock    sync.Mutex
+	values  map[string]*histogramValue
+}
+
+// NewHistogram creates a Histogram with the upper bucket bounds and registers it with the
+// Default registry
+func NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	sorted := append([]float64{}, buckets...)
+	sort.Float64s(sorted)
+
+	instance := Histogram{
+		desc:    desc{name: name, help: help, metricType: "histogram", labelNames: labelNames},
+		buckets: sorted,
+		values:  make(map[string]*histogramValue),
+	}
+
+	if len(labelNames) == 0 {
+		instance.values[""] = &histogramValue{counts: make([]uint64, len(sorted))}
+	}
+
+	Default.Register(&instance)
+	return &instance
+}
+
+// Observe records a value in the histogram with the label values
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	v, ok := h.values[key]
+	if !ok {
+		v = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = v
+	}
+
+	for i, bound := range h.buckets {
+		if value <= bound {
+			v.counts[i]++
+		}
+	}
+
+	v.count++
+	v.sum += value
+}
+
+// write writes the histogram's cumulative buckets, sum and count
+func (h *Histogram) write(w *bufio.Writer) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.writeHeader(w)
+	for _, key := range sortedKeys(h.values) {
+		v := h.values[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(key, "le", formatFloat(bound)), v.counts[i])
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(key, "le", "+Inf"), v.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labels(key, "", ""), formatFloat(v.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labels(key, "", ""), v.count)
+	}
+}
+
+// sortedKeys returns the keys of the map in order, so output is stable between scrapes
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	switch values := m.(type) {
+	case map[string]float64:
+		for key := range values {
+			keys = append(keys, key)
+		}
+	case map[string]*histogramValue:
+		for key := range values {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys
+}
+
+// formatFloat formats a sample value
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// escapeHelp escapes a help string
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+// escapeLabel escapes a label value
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
@@ -0,0 +1,153 @@
+package metrics_test
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/metrics"
+)
+
+// scrape returns the lines of the Default registry's exposition for the metric family
+func scrape(t *testing.T, name string) []string {
+	rec := httptest.NewRecorder()
+	metrics.Default.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if metrics.ContentType != rec.Header().Get("Content-Type") {
+		t.Fatalf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+
+	lines := []string{}
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if belongsTo(line, name) {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+// belongsTo determines whether an exposition line belongs to the metric family
+func belongsTo(line string, name string) bool {
+	if strings.HasPrefix(line, "# HELP "+name+" ") || strings.HasPrefix(line, "# TYPE "+name+" ") {
+		return true
+	}
+
+	sample := strings.FieldsFunc(line, func(r rune) bool { return ' ' == r || '{' == r })
+	if len(sample) == 0 {
+		return false
+	}
+
+	for _, suffix := range []string{"", "_bucket", "_sum", "_count"} {
+		if name+suffix == sample[0] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// expectLines fails unless the lines are exactly those expected
+func expectLines(t *testing.T, lines []string, expected ...string) {
+	if strings.Join(expected, "\n") != strings.Join(lines, "\n") {
+		t.Fatalf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+}
+
+// expectPanic fails unless the function panics
+func expectPanic(t *testing.T, description string, fn func()) {
+	defer func() {
+		if nil == recover() {
+			t.Errorf("expected %s to panic", description)
+		}
+	}()
+
+	fn()
+}
+
+func TestCounter(t *testing.T) {
+	counter := metrics.NewCounter("test_counter_total", "A counter\nwith a \\ in its help.", "destination", "result")
+	counter.Inc("default", "success")
+	counter.Add(2, "default", "success")
+	counter.Inc(`say "hi"`+"\n", "failure")
+
+	expectLines(t, scrape(t, "test_counter_total"),
+		`# HELP test_counter_total A counter\nwith a \\ in its help.`,
+		`# TYPE test_counter_total counter`,
+		`test_counter_total{destination="default",result="success"} 3`,
+		`test_counter_total{destination="say \"hi\"\n",result="failure"} 1`)
+
+	expectPanic(t, "decreasing a counter", func() { counter.Add(-1, "default", "success") })
+	expectPanic(t, "missing label values", func() { counter.Inc("default") })
+}
+
+func TestCounterWithoutLabelsIsReportedFromTheStart(t *testing.T) {
+	metrics.NewCounter("test_unlabelled_total", "An unlabelled counter.")
+
+	expectLines(t, scrape(t, "test_unlabelled_total"),
+		`# HELP test_unlabelled_total An unlabelled counter.`,
+		`# TYPE test_unlabelled_total counter`,
+		`test_unlabelled_total 0`)
+}
+
+func TestGauge(t *testing.T) {
+	gauge := metrics.NewGauge("test_gauge", "A gauge.", "state")
+	gauge.Set(5, "verified")
+	gauge.Add(-2, "verified")
+	gauge.Set(math.Inf(1), "pending")
+
+	expectLines(t, scrape(t, "test_gauge"),
+		`# HELP test_gauge A gauge.`,
+		`# TYPE test_gauge gauge`,
+		`test_gauge{state="pending"} +Inf`,
+		`test_gauge{state="verified"} 3`)
+}
+
+func TestGaugeFuncs(t *testing.T) {
+	value := 1.5
+	metrics.NewGaugeFunc("test_gauge_func", "A computed gauge.", func() float64 {
+		return value
+	})
+	metrics.NewGaugeVecFunc("test_gauge_vec_func", "Computed gauges.", "state", func() map[string]float64 {
+		return map[string]float64{"verified": 2, "denied": 1}
+	})
+
+	// Computed when scraped
+	value = 2.5
+
+	expectLines(t, scrape(t, "test_gauge_func"),
+		`# HELP test_gauge_func A computed gauge.`,
+		`# TYPE test_gauge_func gauge`,
+		`test_gauge_func 2.5`)
+
+	expectLines(t, scrape(t, "test_gauge_vec_func"),
+		`# HELP test_gauge_vec_func Computed gauges.`,
+		`# TYPE test_gauge_vec_func gauge`,
+		`test_gauge_vec_func{state="denied"} 1`,
+		`test_gauge_vec_func{state="verified"} 2`)
+}
+
+func TestHistogram(t *testing.T) {
+	histogram := metrics.NewHistogram("test_seconds", "A histogram.", []float64{1, 0.1}, "code")
+	histogram.Observe(0.05, "200")
+	histogram.Observe(0.5, "200")
+	histogram.Observe(5, "200")
+
+	expectLines(t, scrape(t, "test_seconds"),
+		`# HELP test_seconds A histogram.`,
+		`# TYPE test_seconds histogram`,
+		`test_seconds_bucket{code="200",le="0.1"} 1`,
+		`test_seconds_bucket{code="200",le="1"} 2`,
+		`test_seconds_bucket{code="200",le="+Inf"} 3`,
+		`test_seconds_sum{code="200"} 5.55`,
+		`test_seconds_count{code="200"} 3`)
+}
+
+func TestDuplicateRegistrationPanics(t *testing.T) {
+	metrics.NewCounter("test_duplicate_total", "A counter.")
+
+	expectPanic(t, "registering a duplicate", func() {
+		metrics.NewGauge("test_duplicate_total", "A gauge with the same name.")
+	})
+}
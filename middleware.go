@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"runtime/debug"
+
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+// Recover wraps the handler so a panic while handling one request is logged and answered
+// with 500 Internal Server Error, rather than dropping the connection
+func Recover(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		defer func() {
+			recovered := recover()
+			if nil == recovered {
+				return
+			}
+
+			// The server aborts the response on this sentinel, so let it through
+			if http.ErrAbortHandler == recovered {
+				panic(recovered)
+			}
+
+			logPanic("Recovered from panic while handling request", recovered,
+				"method", request.Method,
+				"path", request.URL.Path)
+
+			http.Error(rw, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}()
+
+		handler.ServeHTTP(rw, request)
+	})
+}
+
+// logPanic logs a recovered panic with the stack of the panicking goroutine
+func logPanic(message string, recovered interface{}, keyvals ...interface{}) {
+	keyvals = append(keyvals, "panic", recovered, "stack", string(debug.Stack()))
+	logutil.Error(message, keyvals...)
+}
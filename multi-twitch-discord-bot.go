@@ -1,223 +1,586 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/mbolt35/multi-twitch-discord-bot/discord"
+	"github.com/mbolt35/multi-twitch-discord-bot/metrics"
 	"github.com/mbolt35/multi-twitch-discord-bot/settings"
 	"github.com/mbolt35/multi-twitch-discord-bot/storage"
 	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
 
 	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
 	timeutil "github.com/mbolt35/multi-twitch-discord-bot/util/time"
 )
 
-// NotifyEndPoint The end point we'll bind to for receiving http requests
-const NotifyEndPoint string = "notify"
+const (
+	// NotifyEndPoint The end point we'll bind to for receiving http requests
+	NotifyEndPoint string = "notify"
+
+	// MetricsEndPoint The end point serving Prometheus metrics
+	MetricsEndPoint string = "metrics"
+
+	// DeliveryKeyPrefix prefixes the storage keys recording handled notification deliveries
+	DeliveryKeyPrefix string = "delivery:"
+
+	// StreamKeyPrefix prefixes the storage keys recording announced stream ids
+	StreamKeyPrefix string = "stream:"
+
+	// DeliveryTTL is how long a handled delivery id is remembered for deduplication
+	DeliveryTTL time.Duration = 24 * time.Hour
+
+	// MaxNotificationBodySize limits the size of notification deliveries, which are normally
+	// well under a kilobyte
+	MaxNotificationBodySize int64 = 1 << 20
+
+	// StoreInitialRetryDelay is the delay before the first storage initialization retry
+	StoreInitialRetryDelay time.Duration = 2 * time.Second
+
+	// StoreMaxRetryDelay caps the delay between storage initialization retries
+	StoreMaxRetryDelay time.Duration = 30 * time.Second
+
+	// StreamTTL is how long an announced stream id is remembered for deduplication
+	StreamTTL time.Duration = 7 * 24 * time.Hour
+
+	// ShutdownTimeout bounds how long shutting down waits for in flight requests to finish
+	ShutdownTimeout time.Duration = 10 * time.Second
+)
 
 var (
+	// config is the configuration loaded at startup. Reloads replace the announcer's
+	// configuration rather than this, so anything running after startup must read
+	// currentAnnouncer().Config() instead.
+	config         *settings.Config
 	twitchClient   twitch.TwitchClient
-	discordClient  discord.DiscordClient
+	announcer      *Announcer
+	backingStore   storage.BackingStore
 	liveStartTimes *timeutil.TimeMap
-	done           chan bool
+
+	// webhookSecret is the secret subscriptions are made with, which deliveries are signed with
+	webhookSecret string
 )
 
-// escapeUnderscore escapes any underscore characters in the string
-func escapeUnderscore(s string) string {
-	return strings.Replace(s, "_", "\\_", -1)
+// logNotification logs the twitch notification
+func logNotification(logger *logutil.Logger, notification *twitch.TwitchNotification) {
+	logger.Info("Received notification",
+		"user_id", notification.UserId,
+		"display_name", twitchClient.FromUserId(notification.UserId),
+		"type", notification.Type,
+		"title", notification.Title,
+		"game_id", notification.GameId,
+		"started_at", notification.StartedAt,
+		"viewer_count", notification.ViewerCount)
 }
 
-// logNotification outputs the twitch notification to stdout
-func logNotification(notification *twitch.TwitchNotification) {
-	log.Printf(
-		"TwitchNotification[\n  UserId: %s,\n  DisplayName: %s\n  Type: %s\n  Title: %s\n  GameId: %s\n  StartedAt: %s\n  ViewerCount: %d\n]\n",
-		notification.UserId,
-		twitchClient.FromUserId(notification.UserId),
-		notification.Type,
-		notification.Title,
-		notification.GameId,
-		notification.StartedAt,
-		notification.ViewerCount)
-}
+// isNewDelivery determines if a notification delivery has not been handled before. Twitch
+// retries deliveries, so the same message may arrive several times, possibly in parallel.
+func isNewDelivery(messageId string) (bool, error) {
+	if "" == messageId {
+		return true, nil
+	}
 
-// print helper
-func println(message string) {
-	log.Printf("%s\n", message)
+	return backingStore.SetIfAbsent(DeliveryKeyPrefix+messageId, time.Now().UTC().Format(time.RFC3339), DeliveryTTL)
 }
 
 // isLiveNotification determines if the notification was actually a stream live update
 // versus title update, or game update.
-func isLiveNotification(notification *twitch.TwitchNotification) bool {
+func isLiveNotification(logger *logutil.Logger, notification *twitch.TwitchNotification) bool {
 	// The Notification Type will always be "live", so to determine whether the stream
 	// notification is actually a "went live" event, we'll compare the time and date of
-	// the Started parameter to the last event for a user
-	userId := notification.UserId
-
-	// If we don't have a previous entry for the user, then this is the initial go live
-	if !liveStartTimes.Exists(userId) {
-		println("Setting first startedAt time: " + notification.StartedAt)
-
-		err := liveStartTimes.Set(userId, notification.StartedAt)
-		if nil != err {
-			println("Failed to Cache Stream Started: " + err.Error())
-		}
-
+	// the Started parameter to the last event for a user. The comparison and update happen
+	// as a single atomic operation, so parallel deliveries can't both be considered new.
+	changed, err := liveStartTimes.SetIfChanged(notification.UserId, notification.StartedAt)
+	if nil != err {
+		logger.Error("Failed to cache stream start time", logutil.ErrorKey, err)
 		return true
 	}
 
-	// Get Last Cached Time
-	lastStart, err := liveStartTimes.Get(userId)
-	if nil != err {
-		println("Failed to Retrieve Last Start Time: " + err.Error())
+	// We can assume that if the times are equal, this is a repeat notification,
+	// a title update, or a game update
+	if !changed {
+		logger.Info("Stream start time unchanged", "started_at", notification.StartedAt)
+		duplicatesSuppressed.Inc(DuplicateStartTime)
+		return false
+	}
 
-		// Try and Set and Return True
-		liveStartTimes.Set(userId, notification.StartedAt)
+	logger.Debug("Stream start time changed", "started_at", notification.StartedAt)
+	if "" == notification.Id {
 		return true
 	}
 
-	// Set new Time
-	err = liveStartTimes.Set(userId, notification.StartedAt)
-	println("Set new started at time to: " + notification.StartedAt)
+	// A stream is only ever announced once, even if its start time is reported differently
+	isNew, err := backingStore.SetIfAbsent(StreamKeyPrefix+notification.Id, notification.StartedAt, StreamTTL)
 	if nil != err {
-		println("Failed to Cache Stream Started: " + err.Error())
+		logger.Error("Failed to cache stream id", logutil.ErrorKey, err)
 		return true
 	}
-	startedAt, _ := liveStartTimes.Get(userId)
 
-	println("lastStartTime: " + lastStart.String() + ", newStartTime: " + startedAt.String())
-
-	// We can assume that if the times are equal, this is a repeat notification,
-	// a title update, or a game update
-	return !lastStart.Equal(startedAt)
-}
+	if !isNew {
+		logger.Info("Stream already announced", "stream_id", notification.Id)
+		duplicatesSuppressed.Inc(DuplicateStream)
+	}
 
-// newTwitchLiveMessage returns the message to send to the discord channel for a user going live.
-func newTwitchLiveMessage(userId string) string {
-	userName := twitchClient.FromUserId(userId)
-	return escapeUnderscore(userName) + " is now live! " + twitch.UserStreamUrl(userName)
+	return isNew
 }
 
 // OnTwitchNotification Handles Incoming Twitch Notifications
 func OnTwitchNotification(rw http.ResponseWriter, request *http.Request) {
+	switch request.Method {
 	// The GET occurs after the subscription to the stream update is made
 	// The main purpose is to provide twitch a way to validate the endpoint
-	if http.MethodGet == request.Method {
-		println("Received GET")
+	case http.MethodGet:
+		onSubscriptionVerification(rw, request)
 
-		q := request.URL.Query()
-		println(fmt.Sprintf("%s", q))
+	// The POST occurs when the actual event of going live occurs
+	case http.MethodPost:
+		onNotificationDelivery(rw, request)
 
-		mode := q.Get(twitch.TwitchHubModeQueryParameter)
-		//topic := q.Get(twitch.TwitchHubTopicQueryParameter)
+	default:
+		rw.Header().Set("Allow", http.MethodGet+", "+http.MethodPost)
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
 
-		if twitch.TwitchModeDenied == mode {
-			reason := q.Get(twitch.TwitchHubReasonQueryParameter)
-			println("Failed to Subscribe to Webhook: " + reason)
-			rw.WriteHeader(http.StatusOK)
+// onSubscriptionVerification answers the hub's verification of a subscribe or unsubscribe
+// request, or records its denial
+func onSubscriptionVerification(rw http.ResponseWriter, request *http.Request) {
+	q := request.URL.Query()
+
+	mode := q.Get(twitch.TwitchHubModeQueryParameter)
+	topic := q.Get(twitch.TwitchHubTopicQueryParameter)
+
+	switch mode {
+	case twitch.TwitchModeDenied:
+		reason := q.Get(twitch.TwitchHubReasonQueryParameter)
+		logutil.Error("Subscription denied", "topic", topic, "reason", reason)
+		twitchClient.Subscriptions().Denied(topic, reason)
+		rw.WriteHeader(http.StatusOK)
+
+	case twitch.TwitchModeSubscribe, twitch.TwitchModeUnsubscribe:
+		challenge := q.Get(twitch.TwitchHubChallengeQueryParameter)
+		if "" == challenge {
+			http.Error(rw, "Missing "+twitch.TwitchHubChallengeQueryParameter, http.StatusBadRequest)
 			return
 		}
 
-		challenge := q.Get(twitch.TwitchHubChallengeQueryParameter)
-		//lease := q.Get(twitch.TwitchHubLeaseQueryParameter)
+		lease := q.Get(twitch.TwitchHubLeaseQueryParameter)
+		leaseSeconds, err := strconv.Atoi(lease)
+		if twitch.TwitchModeSubscribe == mode && (nil != err || leaseSeconds < 0) {
+			http.Error(rw, "Invalid "+twitch.TwitchHubLeaseQueryParameter, http.StatusBadRequest)
+			return
+		}
+
+		logutil.Info("Subscription verified", "mode", mode, "topic", topic, "lease_seconds", lease)
+		twitchClient.Subscriptions().Verified(topic, mode, leaseSeconds)
 
+		rw.Header().Set(httputil.HttpContentTypeHeader, "text/plain")
 		rw.WriteHeader(http.StatusOK)
 		rw.Write([]byte(challenge))
-		return
+
+	default:
+		http.Error(rw, "Invalid "+twitch.TwitchHubModeQueryParameter, http.StatusBadRequest)
 	}
+}
 
-	// The POST occurs when the actual event of going live occurs, we'll need to decode
-	// the payload into notification objects, then send a discord webhook message
-	if http.MethodPost == request.Method {
-		println("Received POST")
+// onNotificationDelivery verifies the delivery's signature, decodes and validates the
+// notifications, persists the delivery and queues it for processing, responding as soon as
+// it's safely queued so slow announcements don't cause Twitch to time out and retry.
+// Forged and malformed deliveries are rejected with 4xx so Twitch doesn't retry them, while
+// failures which may be temporary respond with 5xx so it does.
+func onNotificationDelivery(rw http.ResponseWriter, request *http.Request) {
+	receivedAt := time.Now().UTC()
+
+	// Correlate everything logged for the delivery, using Twitch's id when there is one
+	messageId := request.Header.Get(twitch.TwitchNotificationIdHeader)
+	correlationId := messageId
+	if "" == correlationId {
+		correlationId = logutil.NewCorrelationId()
+	}
 
-		var payload twitch.TwitchNotificationPayload
-		err := httputil.DecodeJson(request.Body, &payload)
-		if err != nil {
-			panic(err)
-		}
+	logger := logutil.With("correlation_id", correlationId)
+	logger.Debug("Received notification delivery")
 
-		// Iterate through all notifications, send discord message for live streams
-		for _, notification := range payload.Notifications {
-			logNotification(&notification)
+	if !httputil.IsJsonContentType(request.Header.Get(httputil.HttpContentTypeHeader)) {
+		logger.Warn("Rejected delivery with unsupported content type", "content_type", request.Header.Get(httputil.HttpContentTypeHeader))
+		http.Error(rw, "Content-Type must be "+httputil.JsonContentType, http.StatusUnsupportedMediaType)
+		return
+	}
 
-			// Don't Send Messages for Duplicates or Title/Game Updates
-			if isLiveNotification(&notification) {
-				discordClient.SendDiscordMessage(newTwitchLiveMessage(notification.UserId))
-			}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(rw, request.Body, MaxNotificationBodySize))
+	if nil != err {
+		if httputil.IsBodyTooLarge(err) {
+			logger.Warn("Rejected oversized delivery", "limit_bytes", MaxNotificationBodySize)
+			http.Error(rw, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+			return
 		}
+
+		logger.Warn("Failed to read delivery", logutil.ErrorKey, err)
+		http.Error(rw, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+
+	// Only the hub knows the secret, so anything else posting here is refused before it's
+	// decoded or recorded
+	if !twitch.VerifySignature(webhookSecret, body, request.Header.Get(twitch.TwitchSignatureHeader)) {
+		logger.Warn("Rejected delivery with an invalid signature")
+		http.Error(rw, "Invalid "+twitch.TwitchSignatureHeader, http.StatusForbidden)
+		return
+	}
+
+	var payload twitch.TwitchNotificationPayload
+	err = httputil.DecodeJson(bytes.NewReader(body), &payload)
+	if nil != err {
+		logger.Warn("Rejected malformed delivery", logutil.ErrorKey, err)
+		http.Error(rw, "Malformed notification payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := payload.Validate(); nil != err {
+		logger.Warn("Rejected invalid delivery", logutil.ErrorKey, err)
+		http.Error(rw, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	// Captured with the status it's answered with, once the hub's signature and the payload
+	// have both been accepted
+	recorder := &statusRecorder{ResponseWriter: rw, status: http.StatusOK}
+	defer captureDelivery(request, body, receivedAt, recorder)
+	rw = recorder
+
+	isNew, err := isNewDelivery(messageId)
+	if nil != err {
+		// Twitch will retry, by which time storage may have recovered
+		logger.Error("Failed to record delivery", logutil.ErrorKey, err)
+		deliveriesRejected.Inc("storage")
+		http.Error(rw, "Failed to record delivery", http.StatusServiceUnavailable)
+		return
+	}
+
+	if !isNew {
+		logger.Info("Ignoring duplicate delivery")
+		duplicatesSuppressed.Inc(DuplicateDelivery)
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+
+	event := &storedEvent{
+		Id:         correlationId,
+		MessageId:  messageId,
+		Topic:      twitch.TopicFromLinkHeader(request.Header.Get(twitch.TwitchLinkHeader)),
+		ReceivedAt: receivedAt,
+		Body:       json.RawMessage(body),
+	}
+
+	err = persistEvent(event)
+	if nil != err {
+		logger.Error("Failed to persist delivery", logutil.ErrorKey, err)
+		forgetDelivery(logger, messageId)
+		deliveriesRejected.Inc("storage")
+		http.Error(rw, "Failed to persist delivery", http.StatusServiceUnavailable)
+		return
+	}
+
+	// Announce with the configuration current when the delivery arrived
+	current := currentAnnouncer()
+	if !dispatchEvent(logger, current, event, &payload) {
+		logger.Warn("Notification queue is full, asking Twitch to retry", "queue_size", current.Config().Processing.QueueSize)
+		removeEvent(logger, event)
+		forgetDelivery(logger, messageId)
+		deliveriesRejected.Inc("queue_full")
+		http.Error(rw, "Too many notifications waiting to be processed", http.StatusServiceUnavailable)
+		return
+	}
+
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+// forgetDelivery removes the record of a delivery which couldn't be accepted, so Twitch's
+// retry isn't mistaken for a duplicate
+func forgetDelivery(logger *logutil.Logger, messageId string) {
+	if "" == messageId {
+		return
+	}
+
+	if err := backingStore.Delete(DeliveryKeyPrefix + messageId); nil != err {
+		logger.Error("Failed to forget delivery", logutil.ErrorKey, err)
 	}
 }
 
 // Initialze
-func Initialize() {
-	settings.DumpEnvironmentVariables()
+func Initialize(configPath string) {
+	LoadConfig(configPath)
 
 	// Initialize Persistence for Start Times
-	backingStore := InitializeStorage()
+	backingStore = InitializeStorage()
 	liveStartTimes = timeutil.NewTimeMap(backingStore, time.RFC3339)
 
-	// Create twitch and discord clients
-	twitchClient = twitch.NewTwitch(settings.GetClientId())
-	discordClient = discord.NewDiscord(settings.GetDiscordHookId(), settings.GetDiscordHookToken())
+	// Process Notifications in the Background
+	dispatcher = NewDispatcher(config.Processing.Workers, config.Processing.QueueSize)
 
 	InitializeEndPoints()
 }
 
+// LoadConfig loads and validates the configuration, configures logging and creates the
+// twitch client
+func LoadConfig(configPath string) {
+	var err error
+	config, err = settings.LoadConfig(configPath)
+	if nil != err {
+		logutil.Fatal("Invalid configuration", logutil.ErrorKey, err)
+	}
+
+	logutil.Configure(config.LogLevel(), config.Logging.Format)
+	settings.DumpEnvironmentVariables()
+	logutil.Debug("Loaded configuration", "config", config)
+
+	// Subscriptions are made with the secret deliveries are verified with, so one is
+	// generated when none is configured
+	webhookSecret = config.Twitch.Secret
+	if "" == webhookSecret {
+		webhookSecret, err = twitch.NewSecret()
+		if nil != err {
+			logutil.Fatal("Failed to generate a web hook secret", logutil.ErrorKey, err)
+		}
+
+		logutil.Debug("Generated a web hook secret for this run")
+	}
+
+	// Create twitch client
+	options := config.TwitchOptions()
+	options.Secret = webhookSecret
+	twitchClient = twitch.NewTwitchWithOptions(config.Twitch.ClientId, options)
+}
+
 // InitializeStorage initializes the backing storage for persisting records
 func InitializeStorage() storage.BackingStore {
-	databaseHost := settings.GetDatabaseHost()
+	databaseHost := config.Storage.Url
 
 	var backingStore storage.BackingStore
-	if "" != databaseHost {
-		println("Using Postgres SQL for Record Persistence.")
-		backingStore = storage.NewPostgresStore(databaseHost)
-	} else {
-		println("Using In-Memory Storage for Record Persistence.")
+	switch {
+	case "" == databaseHost:
+		logutil.Info("Using in-memory storage for record persistence")
 		backingStore = storage.NewMemoryStore()
+
+	case strings.HasPrefix(databaseHost, storage.SqliteScheme):
+		path := databasePath(databaseHost)
+		logutil.Info("Using SQLite for record persistence", "path", path)
+		backingStore = withCache(storage.NewSqliteStore(path), nil)
+
+	case strings.HasPrefix(databaseHost, storage.JsonFileScheme):
+		path := databasePath(databaseHost)
+		logutil.Info("Using JSON file for record persistence", "path", path)
+		backingStore = storage.NewJsonFileStore(path)
+
+	case strings.HasPrefix(databaseHost, storage.RedisScheme),
+		strings.HasPrefix(databaseHost, storage.RedisTlsScheme):
+		logutil.Info("Using Redis for record persistence")
+		backingStore = storage.NewRedisStore(databaseHost)
+
+	default:
+		logutil.Info("Using Postgres SQL for record persistence")
+		postgresStore := storage.NewPostgresStore(databaseHost, config.PoolOptions())
+		backingStore = withCache(postgresStore, storage.NewPostgresInvalidator(databaseHost))
+	}
+
+	err := storage.InitWithRetry(backingStore, config.Storage.InitAttempts, StoreInitialRetryDelay, StoreMaxRetryDelay)
+	if nil == err {
+		return backingStore
+	}
+
+	if !config.Storage.FallbackToMemory {
+		logutil.Fatal("Failed to initialize storage", logutil.ErrorKey, err)
 	}
+
+	logutil.Warn("Failed to initialize storage, falling back to in-memory storage. Records will be lost on restart!", logutil.ErrorKey, err)
+
+	backingStore = storage.NewMemoryStore()
 	backingStore.Init()
 
 	return backingStore
 }
 
+// withCache wraps the backing store with an in memory cache, unless caching is disabled
+func withCache(backingStore storage.BackingStore, invalidator storage.CacheInvalidator) storage.BackingStore {
+	cacheSize := config.Storage.CacheSize
+	if cacheSize <= 0 {
+		return backingStore
+	}
+
+	return storage.NewCachingStore(backingStore, cacheSize, invalidator)
+}
+
+// databasePath returns the file path for a file based database url
+func databasePath(databaseHost string) string {
+	path, err := storage.DatabasePath(databaseHost)
+	if nil != err {
+		logutil.Fatal("Invalid storage url", logutil.ErrorKey, err)
+	}
+
+	return path
+}
+
 // InitializeEndPoints Initializes HTTP End Points
 func InitializeEndPoints() {
-	http.HandleFunc("/"+NotifyEndPoint, OnTwitchNotification)
+	registerEndPoints(http.DefaultServeMux)
 }
 
-// StartWebServer starts running the web server for receiving requests from twitch
-func StartWebServer(port string) {
-	err := http.ListenAndServe(":"+port, nil)
-	if nil != err {
-		log.Fatalln(err)
+// registerEndPoints binds every end point's handler on the mux
+func registerEndPoints(mux *http.ServeMux) {
+	mux.HandleFunc("/"+NotifyEndPoint, OnTwitchNotification)
+	mux.Handle("/"+MetricsEndPoint, metrics.Default)
+	mux.HandleFunc("/"+HealthEndPoint, OnHealth)
+	mux.HandleFunc("/"+ReadyEndPoint, OnReady)
+	mux.HandleFunc("/"+StatusEndPoint, OnStatus)
+	mux.HandleFunc("/"+SubscriptionsEndPoint, OnSubscriptions)
+	mux.HandleFunc("/"+DryRunEndPoint, RequireAdmin(OnDryRun))
+	mux.HandleFunc("/"+DeliveriesEndPoint, RequireAdmin(OnDeliveries))
+	mux.HandleFunc("/"+ReplayEndPoint, RequireAdmin(OnReplay))
+}
+
+// StartWebServer starts running the web server for receiving requests from twitch in the
+// background, returning the server so it can be shut down
+func StartWebServer(port string) *http.Server {
+	logutil.Info("Starting web server", "port", port)
+	server := http.Server{
+		Addr:    ":" + port,
+		Handler: Recover(http.DefaultServeMux),
+	}
+
+	go func() {
+		err := server.ListenAndServe()
+		if http.ErrServerClosed != err {
+			logutil.Fatal("Web server failed", logutil.ErrorKey, err)
+		}
+	}()
+
+	return &server
+}
+
+// Shutdown stops the web server, waits for the queued notifications to be announced, then
+// closes the backing store. The order matters: nothing may be queued once the dispatcher is
+// closed, and nothing may be stored once the backing store is.
+func Shutdown(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); nil != err {
+		logutil.Error("Failed to stop web server", logutil.ErrorKey, err)
+	}
+
+	logutil.Info("Waiting for queued notifications", "pending", dispatcher.Pending())
+	dispatcher.Close()
+
+	closeStorage(backingStore)
+
+	logutil.Info("Shut down")
+}
+
+// closeStorage closes the backing store if it holds connections or buffers writes
+func closeStorage(store storage.BackingStore) {
+	if closer, ok := store.(io.Closer); ok {
+		if err := closer.Close(); nil != err {
+			logutil.Error("Failed to close storage", logutil.ErrorKey, err)
+		}
 	}
-	done <- true
 }
 
 // main Entry Point
 func main() {
-	Initialize()
+	configFlag := flag.String("config", "", "Path to the JSON configuration file (or $"+settings.ConfigFileEnvVar+")")
+	flag.Usage = printUsage
+	flag.Parse()
+
+	// Keep web hook tokens and database passwords out of anything logged by the standard logger
+	log.SetOutput(logutil.NewScrubbingWriter(os.Stderr))
+
+	// Serve when no command is given, as before there were commands
+	name := ServeCommand
+	args := flag.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+
+	command := findCommand(name)
+	if nil == command {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+		printUsage()
+		os.Exit(2)
+	}
+
+	err := command.Run(settings.ConfigPath(*configFlag), args)
+	if errUsage == err {
+		fmt.Fprintf(os.Stderr, "Usage: %s [-config path] %s %s\n", os.Args[0], command.Name, command.Args)
+		os.Exit(2)
+	}
+
+	if nil != err {
+		logutil.Fatal("Command failed", "command", command.Name, logutil.ErrorKey, err)
+	}
+}
 
-	// Acquire Host URL and Twitch Users to Watch for Live Events
-	hostUrl := settings.GetHostUrl() + "/" + NotifyEndPoint
-	users := settings.GetUserNames()
+// serve runs the bot until the process is interrupted or terminated
+func serve(configPath string, args []string) error {
+	if len(args) > 0 {
+		return errUsage
+	}
+
+	// Show Recent Problems on the Status Page
+	logutil.AddHook(logutil.LevelWarn, status.RecordError)
+
+	Initialize(configPath)
 
-	// Convert Twitch User Names to User Ids
-	userIds, err := twitchClient.UserIdsFor(users)
+	// Look up the Twitch Users for the Configured Streamers
+	users, err := twitchClient.UsersFor(config.Logins())
 	if nil != err {
-		log.Fatalln(err)
+		logutil.Fatal("Failed to look up Twitch users", logutil.ErrorKey, err)
 	}
 
+	initialAnnouncer, err := NewAnnouncer(config, users, twitchClient.GameName)
+	if nil != err {
+		logutil.Fatal("Failed to create announcer", logutil.ErrorKey, err)
+	}
+
+	setAnnouncer(initialAnnouncer)
+
+	// Process Deliveries Acknowledged Before the Last Shutdown
+	RecoverEvents()
+
 	// Start Web Server...
-	go StartWebServer(settings.GetHostPort())
+	server := StartWebServer(config.Host.Port)
 
 	// Subscribe to Stream Live Events
-	twitchClient.SubscribeToStreams(hostUrl, userIds)
+	err = twitchClient.SubscribeToStreams(notifyUrl(), initialAnnouncer.UserIds())
+	if nil != err {
+		logutil.Error("Failed to subscribe to streams", logutil.ErrorKey, err)
+	}
+
+	// Apply Configuration File Changes Without Restarting
+	if "" != configPath {
+		go WatchConfig(configPath)
+	}
+
+	// Blocks until asked to stop
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	received := <-stop
+	logutil.Info("Received signal, shutting down", "signal", received.String())
+	signal.Stop(stop)
 
-	// Blocks until http service shuts down
-	<-done
+	Shutdown(server)
+	return nil
 }
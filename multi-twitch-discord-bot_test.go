@@ -0,0 +1,484 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/discord/discordtest"
+	"github.com/mbolt35/multi-twitch-discord-bot/settings"
+	"github.com/mbolt35/multi-twitch-discord-bot/storage"
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch/twitchtest"
+
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+	timeutil "github.com/mbolt35/multi-twitch-discord-bot/util/time"
+)
+
+// useMemoryStore replaces the global storage with an empty in memory store
+func useMemoryStore(t *testing.T) {
+	store := storage.NewMemoryStore()
+	if err := store.Init(); nil != err {
+		t.Fatal(err)
+	}
+
+	backingStore = store
+	liveStartTimes = timeutil.NewTimeMap(store, time.RFC3339)
+}
+
+// testBot is the bot serving every end point, communicating with stand-in Twitch and
+// Discord servers
+type testBot struct {
+	twitch  *twitchtest.Server
+	discord *discordtest.Server
+	server  *httptest.Server
+}
+
+// startTestBot replaces the globals with a bot using in memory storage, announcing the go live
+// events of the streamer with user id 42 to a Discord web hook, and subscribes to them. The
+// configuration may be changed before the announcer is created.
+func startTestBot(t *testing.T, configure func(config *settings.Config)) *testBot {
+	bot := &testBot{
+		twitch:  twitchtest.NewServer(),
+		discord: discordtest.NewServer(),
+	}
+
+	mux := http.NewServeMux()
+	registerEndPoints(mux)
+	bot.server = httptest.NewServer(Recover(mux))
+
+	bot.twitch.AddUser("42", "streamer", "Streamer")
+	bot.discord.AddWebHook("1", "token")
+
+	config = bot.config()
+	if nil != configure {
+		configure(config)
+	}
+
+	if err := config.Validate(); nil != err {
+		bot.Close()
+		t.Fatal(err)
+	}
+
+	// Results cached and recorded by an earlier test's bot would be reported otherwise
+	twitchCheck = newCachedCheck(ExternalCheckTTL, twitchCheck.check)
+	status = newStatusTracker()
+
+	useMemoryStore(t)
+	dispatcher = NewDispatcher(config.Processing.Workers, config.Processing.QueueSize)
+	webhookSecret = config.Twitch.Secret
+	twitchClient = twitch.NewTwitchWithOptions(config.Twitch.ClientId, config.TwitchOptions())
+
+	users, err := twitchClient.UsersFor(config.Logins())
+	if nil != err {
+		bot.Close()
+		t.Fatal(err)
+	}
+
+	initialAnnouncer, err := NewAnnouncer(config, users, twitchClient.GameName)
+	if nil != err {
+		bot.Close()
+		t.Fatal(err)
+	}
+	setAnnouncer(initialAnnouncer)
+
+	if err := twitchClient.SubscribeToStreams(notifyUrl(), initialAnnouncer.UserIds()); nil != err {
+		bot.Close()
+		t.Fatal(err)
+	}
+	bot.twitch.WaitForCallbacks()
+
+	return bot
+}
+
+// config returns the configuration of a bot communicating with the stand-in servers
+func (b *testBot) config() *settings.Config {
+	config := settings.DefaultConfig()
+	config.Host.Url = b.server.URL
+	config.Twitch.ClientId = "client-id"
+	config.Twitch.ApiUrl = b.twitch.Url()
+	config.Twitch.Secret = "secret"
+	config.Streamers = []settings.StreamerConfig{{Login: "streamer"}}
+	config.Destinations = []settings.DestinationConfig{{
+		Name:         settings.DefaultDestinationName,
+		Type:         settings.DiscordDestinationType,
+		WebHookId:    "1",
+		WebHookToken: "token",
+		ApiUrl:       b.discord.Url(),
+	}}
+	config.Templates[settings.DefaultTemplateName] = settings.DefaultTemplate
+
+	return config
+}
+
+// Close waits for queued notifications, then stops the servers
+func (b *testBot) Close() {
+	if nil != dispatcher {
+		dispatcher.Close()
+	}
+
+	b.server.Close()
+	b.twitch.Close()
+	b.discord.Close()
+}
+
+// expectAnnouncements waits for the queued notifications to be processed, then fails unless
+// exactly the messages were posted to Discord
+func expectAnnouncements(t *testing.T, bot *testBot, expected ...string) {
+	dispatcher.Close()
+
+	messages := bot.discord.Messages()
+	if len(expected) != len(messages) {
+		t.Fatalf("expected %d announcements, got %+v", len(expected), messages)
+	}
+
+	for i, message := range messages {
+		if expected[i] != message.Content {
+			t.Errorf("announcement %d: expected %q, got %q", i, expected[i], message.Content)
+		}
+	}
+}
+
+func TestGoLiveIsAnnouncedOnce(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	live := twitch.TwitchNotification{Id: "1", UserId: "42", UserName: "streamer", Type: "live", Title: "Speedruns", StartedAt: "2020-01-01T00:00:00Z"}
+	messageId := bot.twitch.NewMessageId()
+	if code, err := bot.twitch.Deliver("42", messageId, []twitch.TwitchNotification{live}); nil != err || http.StatusAccepted != code {
+		t.Fatalf("got %d, %v", code, err)
+	}
+
+	if _, ok := bot.discord.WaitForMessages(1, time.Second); !ok {
+		t.Fatal("expected the stream to be announced")
+	}
+
+	// Twitch redelivers when it doesn't see a response in time
+	if code, err := bot.twitch.Deliver("42", messageId, []twitch.TwitchNotification{live}); nil != err || http.StatusOK != code {
+		t.Fatalf("expected the redelivery to be acknowledged as a duplicate, got %d, %v", code, err)
+	}
+
+	// and notifies again when the title changes, with the same start time
+	live.Title = "Any% speedruns"
+	if code, err := bot.twitch.GoLive(live); nil != err || http.StatusAccepted != code {
+		t.Fatalf("got %d, %v", code, err)
+	}
+
+	if code, err := bot.twitch.GoOffline("42"); nil != err || http.StatusAccepted != code {
+		t.Fatalf("got %d, %v", code, err)
+	}
+
+	expectAnnouncements(t, bot, "Streamer is now live! http://twitch.tv/streamer")
+}
+
+func TestEachStreamIsAnnounced(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	for _, started := range []string{"2020-01-01T00:00:00Z", "2020-01-02T00:00:00Z"} {
+		bot.twitch.GoLive(twitch.TwitchNotification{Id: started, UserId: "42", Type: "live", StartedAt: started})
+		bot.twitch.GoOffline("42")
+	}
+
+	expectAnnouncements(t, bot,
+		"Streamer is now live! http://twitch.tv/streamer",
+		"Streamer is now live! http://twitch.tv/streamer")
+}
+
+func TestBadDeliveryIsRejected(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	// Twitch doesn't retry a delivery refused with 4xx
+	invalid := twitch.TwitchNotification{Id: "1", UserId: "42", Type: "live", StartedAt: "yesterday"}
+	if code, err := bot.twitch.GoLive(invalid); nil != err || http.StatusUnprocessableEntity != code {
+		t.Fatalf("expected the invalid delivery to be rejected, got %d, %v", code, err)
+	}
+
+	if code := postNotification(t, bot, "application/json", []byte(`{"data": [`)); http.StatusBadRequest != code {
+		t.Fatalf("expected the malformed delivery to be rejected, got %d", code)
+	}
+
+	expectAnnouncements(t, bot)
+
+	if stored, err := backingStore.List(""); nil != err || 0 != len(stored) {
+		t.Fatalf("expected nothing to be recorded, got %v, %v", stored, err)
+	}
+}
+
+func TestRecoverEvents(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	// A delivery acknowledged just before the bot stopped
+	body := `{"data": [{"id": "1", "user_id": "42", "type": "live", "started_at": "2020-01-01T00:00:00Z"}]}`
+	event := &storedEvent{Id: "event-1", MessageId: "message-1", ReceivedAt: time.Now().UTC(), Body: []byte(body)}
+	if err := persistEvent(event); nil != err {
+		t.Fatal(err)
+	}
+
+	RecoverEvents()
+	expectAnnouncements(t, bot, "Streamer is now live! http://twitch.tv/streamer")
+
+	if stored, err := backingStore.List(EventKeyPrefix); nil != err || 0 != len(stored) {
+		t.Fatalf("expected the recovered event to be removed, got %v, %v", stored, err)
+	}
+}
+
+func TestIsNewDelivery(t *testing.T) {
+	useMemoryStore(t)
+
+	for i, expected := range []bool{true, false, false} {
+		isNew, err := isNewDelivery("message-1")
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		if expected != isNew {
+			t.Fatalf("delivery %d: isNew = %v, expected %v", i, isNew, expected)
+		}
+	}
+
+	isNew, err := isNewDelivery("message-2")
+	if nil != err || !isNew {
+		t.Fatalf("expected a different message to be new, got %v, %v", isNew, err)
+	}
+}
+
+func TestIsNewDeliveryWithoutMessageId(t *testing.T) {
+	useMemoryStore(t)
+
+	// Without an id deliveries can't be told apart, so none are considered duplicates
+	for i := 0; i < 2; i++ {
+		isNew, err := isNewDelivery("")
+		if nil != err || !isNew {
+			t.Fatalf("delivery %d: expected new, got %v, %v", i, isNew, err)
+		}
+	}
+
+	keys, err := backingStore.List(DeliveryKeyPrefix)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if 0 != len(keys) {
+		t.Fatalf("expected nothing to be recorded, got %v", keys)
+	}
+}
+
+func TestIsNewDeliveryOnlyOnceInParallel(t *testing.T) {
+	useMemoryStore(t)
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	accepted := 0
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			isNew, err := isNewDelivery("message-1")
+			if nil != err {
+				t.Error(err)
+				return
+			}
+
+			if isNew {
+				lock.Lock()
+				accepted++
+				lock.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if 1 != accepted {
+		t.Fatalf("expected exactly one delivery to be accepted, got %d", accepted)
+	}
+}
+
+func TestForgetDelivery(t *testing.T) {
+	useMemoryStore(t)
+
+	if _, err := isNewDelivery("message-1"); nil != err {
+		t.Fatal(err)
+	}
+
+	forgetDelivery(logutil.With(), "message-1")
+
+	isNew, err := isNewDelivery("message-1")
+	if nil != err || !isNew {
+		t.Fatalf("expected a forgotten delivery to be new again, got %v, %v", isNew, err)
+	}
+}
+
+func TestIsLiveNotification(t *testing.T) {
+	useMemoryStore(t)
+
+	logger := logutil.With()
+	steps := []struct {
+		name         string
+		notification twitch.TwitchNotification
+		live         bool
+	}{
+		{"went live", twitch.TwitchNotification{Id: "s1", UserId: "42", StartedAt: "2020-01-01T00:00:00Z"}, true},
+		{"title update", twitch.TwitchNotification{Id: "s1", UserId: "42", StartedAt: "2020-01-01T00:00:00Z", Title: "renamed"}, false},
+		{"start time reported differently", twitch.TwitchNotification{Id: "s1", UserId: "42", StartedAt: "2020-01-01T00:00:01Z"}, false},
+		{"next stream", twitch.TwitchNotification{Id: "s2", UserId: "42", StartedAt: "2020-01-02T00:00:00Z"}, true},
+		{"another streamer", twitch.TwitchNotification{Id: "s3", UserId: "7", StartedAt: "2020-01-02T00:00:00Z"}, true},
+	}
+
+	for _, step := range steps {
+		notification := step.notification
+		if live := isLiveNotification(logger, &notification); step.live != live {
+			t.Fatalf("%s: isLiveNotification = %v, expected %v", step.name, live, step.live)
+		}
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "shutdown-test")
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Only closing the store writes the file
+	path := filepath.Join(dir, "bot.json")
+	store := storage.NewJsonFileStoreWithDelay(path, time.Hour)
+	if err := store.Init(); nil != err {
+		t.Fatal(err)
+	}
+	backingStore = store
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	server := &http.Server{Handler: http.NotFoundHandler()}
+	go server.Serve(listener)
+
+	// A notification still being processed must finish before the store is closed
+	dispatcher = NewDispatcher(1, 10)
+	dispatcher.Dispatch(Job{Key: "42", Run: func() {
+		time.Sleep(50 * time.Millisecond)
+		backingStore.Set("announced", "42")
+	}})
+
+	Shutdown(server)
+
+	if _, err := http.Get("http://" + listener.Addr().String()); nil == err {
+		t.Fatal("expected the web server to be stopped")
+	}
+
+	if dispatcher.Dispatch(Job{Key: "42", Run: func() {}}) {
+		t.Fatal("expected the dispatcher to be closed")
+	}
+
+	reopened := storage.NewJsonFileStoreWithDelay(path, time.Hour)
+	if err := reopened.Init(); nil != err {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+
+	if value, err := reopened.Get("announced"); nil != err || "42" != value {
+		t.Fatalf("expected the announcement to be stored, got %q, %v", value, err)
+	}
+}
+
+func TestGameNameIsAnnounced(t *testing.T) {
+	bot := startTestBot(t, func(config *settings.Config) {
+		config.Templates[settings.DefaultTemplateName] = "{{.DisplayName}} is playing {{.GameName}}"
+	})
+	defer bot.Close()
+
+	bot.twitch.AddGame("509658", "Just Chatting")
+
+	// Games Twitch can't look up are announced by id
+	for i, gameId := range []string{"509658", "33214"} {
+		started := time.Date(2020, 1, 1+i, 0, 0, 0, 0, time.UTC).Format(time.RFC3339)
+		bot.twitch.GoLive(twitch.TwitchNotification{Id: started, UserId: "42", Type: "live", GameId: gameId, StartedAt: started})
+		bot.twitch.GoOffline("42")
+	}
+
+	expectAnnouncements(t, bot,
+		"Streamer is playing Just Chatting",
+		"Streamer is playing 33214")
+}
+
+// dryRunPayloads announces the streamer as live with the display name to the destinations,
+// in addition to the default, returning the payload recorded for each destination
+func dryRunPayloads(t *testing.T, bot *testBot, displayName string, destinations ...settings.DestinationConfig) map[string]map[string]interface{} {
+	next := bot.config()
+	next.DryRun = true
+	next.Destinations = append(next.Destinations, destinations...)
+	if err := next.Validate(); nil != err {
+		t.Fatal(err)
+	}
+
+	users := []twitch.TwitchUser{{UserId: "42", UserName: "streamer", DisplayName: displayName}}
+	announcer, err := NewAnnouncer(next, users, offlineGameName)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	recorded := len(dryRunRecording.Messages())
+	announcer.Announce(logutil.With(), &twitch.TwitchNotification{Id: "1", UserId: "42", Type: "live"})
+
+	payloads := make(map[string]map[string]interface{})
+	for _, message := range dryRunRecording.Messages()[recorded:] {
+		payload := make(map[string]interface{})
+		if err := json.Unmarshal(message.Body, &payload); nil != err {
+			t.Fatal(err)
+		}
+
+		payloads[message.Destination] = payload
+	}
+
+	return payloads
+}
+
+func TestAnnouncementsAreEscapedForEachDestination(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	payloads := dryRunPayloads(t, bot, "A_<B>",
+		settings.DestinationConfig{Name: "slack", Type: settings.SlackDestinationType, WebHookUrl: "https://hooks.slack.com/services/T/B/X"})
+
+	if content := payloads[settings.DefaultDestinationName]["content"]; `A\_<B> is now live! http://twitch.tv/streamer` != content {
+		t.Errorf("expected discord markdown to be escaped, got %q", content)
+	}
+
+	if text := payloads["slack"]["text"]; "A_&lt;B&gt; is now live! http://twitch.tv/streamer" != text {
+		t.Errorf("expected slack markup to be escaped, got %q", text)
+	}
+}
+
+func TestTelegramAndMatrixAnnouncementsArentMarkdownEscaped(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	payloads := dryRunPayloads(t, bot, "A_B*",
+		settings.DestinationConfig{Name: "telegram", Type: settings.TelegramDestinationType, BotToken: "123456:token", ChatId: "@channel"},
+		settings.DestinationConfig{Name: "matrix", Type: settings.MatrixDestinationType, RoomId: "!room:example.org", AccessToken: "token"})
+
+	// The whole message is escaped for MarkdownV2 once, by the Telegram notifier
+	telegram := payloads["telegram"]
+	if `A\_B\* is now live\! http://twitch\.tv/streamer` != telegram["text"] || "MarkdownV2" != telegram["parse_mode"] {
+		t.Errorf("expected MarkdownV2 escaping, got %v", telegram)
+	}
+
+	if body := payloads["matrix"]["body"]; "A_B* is now live! http://twitch.tv/streamer" != body {
+		t.Errorf("expected the plain body not to be escaped, got %q", body)
+	}
+}
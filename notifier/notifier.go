@@ -0,0 +1,76 @@
+// Package notifier defines how go live announcements are sent to a destination, whatever
+// kind of service the destination is.
+package notifier
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+const (
+	// ThumbnailWidth is the width of the stream thumbnails sent with announcements
+	ThumbnailWidth string = "1280"
+
+	// ThumbnailHeight is the height of the stream thumbnails sent with announcements
+	ThumbnailHeight string = "720"
+)
+
+// Event is a go live event, normalized for every kind of destination
+type Event struct {
+	UserId       string
+	Login        string
+	DisplayName  string
+	Title        string
+	GameId       string
+	GameName     string
+	Language     string
+	StartedAt    string
+	ViewerCount  int
+	ThumbnailUrl string
+	Url          string
+}
+
+// Thumbnail returns the url of the stream's thumbnail at the announced size, or an empty
+// string if there is none
+func (e Event) Thumbnail() string {
+	thumbnail := strings.Replace(e.ThumbnailUrl, "{width}", ThumbnailWidth, -1)
+	return strings.Replace(thumbnail, "{height}", ThumbnailHeight, -1)
+}
+
+// Game returns the name of the stream's game, or its id when the name couldn't be looked up
+func (e Event) Game() string {
+	if "" != e.GameName {
+		return e.GameName
+	}
+
+	return e.GameId
+}
+
+// Notifier sends go live announcements to a single destination
+type Notifier interface {
+	// Payload returns the exact JSON Notify sends for the message and event
+	Payload(message string, event Event) (json.RawMessage, error)
+
+	// Notify announces the event, with the message rendered from the streamer's template
+	Notify(message string, event Event) error
+
+	// Check verifies the destination is reachable and accepts announcements, without
+	// announcing anything
+	Check() error
+}
+
+// Escaper is implemented by notifiers whose destinations don't use Discord's markdown. Their
+// messages are rendered with Escape as the template's escape function.
+type Escaper interface {
+	// Escape escapes the text so the destination shows it exactly as it is
+	Escape(s string) string
+}
+
+// EscapeFunc returns the notifier's escape function, or the default if it has none
+func EscapeFunc(client Notifier, defaultEscape func(s string) string) func(s string) string {
+	if escaper, ok := client.(Escaper); ok {
+		return escaper.Escape
+	}
+
+	return defaultEscape
+}
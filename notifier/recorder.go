@@ -0,0 +1,106 @@
+package notifier
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+// DefaultRecordingLimit is the number of recent messages a Recording keeps
+const DefaultRecordingLimit int = 100
+
+// RecordedMessage is a message a recorder would have sent to a destination
+type RecordedMessage struct {
+	Destination string          `json:"destination"`
+	Body        json.RawMessage `json:"body"`
+	RecordedAt  time.Time       `json:"recorded_at"`
+}
+
+// Recording keeps the most recent messages recorded by recorders
+type Recording struct {
+	lock     sync.RWMutex
+	limit    int
+	messages []RecordedMessage
+}
+
+// NewRecording creates an empty Recording which keeps up to limit messages
+func NewRecording(limit int) *Recording {
+	instance := Recording{
+		limit: limit,
+	}
+
+	return &instance
+}
+
+// Messages returns the recorded messages, oldest first
+func (r *Recording) Messages() []RecordedMessage {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return append([]RecordedMessage{}, r.messages...)
+}
+
+// add records a message, forgetting the oldest once the limit is reached
+func (r *Recording) add(message RecordedMessage) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.messages = append(r.messages, message)
+	if len(r.messages) > r.limit {
+		r.messages = r.messages[len(r.messages)-r.limit:]
+	}
+}
+
+// recorder is a Notifier which records and logs what the wrapped Notifier would send,
+// without ever sending it
+type recorder struct {
+	destination string
+	notifier    Notifier
+	recording   *Recording
+}
+
+var _ Notifier = &recorder{}
+
+// NewRecorder creates a Notifier for dry runs, which records the payloads the notifier would
+// send to the destination
+func NewRecorder(destination string, notifier Notifier, recording *Recording) Notifier {
+	instance := recorder{
+		destination: destination,
+		notifier:    notifier,
+		recording:   recording,
+	}
+
+	return &instance
+}
+
+// Payload returns the payload of the wrapped Notifier
+func (r *recorder) Payload(message string, event Event) (json.RawMessage, error) {
+	return r.notifier.Payload(message, event)
+}
+
+// Notify records and logs the exact JSON which would have been sent
+func (r *recorder) Notify(message string, event Event) error {
+	body, err := r.notifier.Payload(message, event)
+	if nil != err {
+		return err
+	}
+
+	r.recording.add(RecordedMessage{
+		Destination: r.destination,
+		Body:        body,
+		RecordedAt:  time.Now(),
+	})
+
+	logutil.Info("Dry run, recorded message instead of sending it",
+		"destination", r.destination,
+		"body", string(body))
+
+	return nil
+}
+
+// Check always succeeds, since a dry run never contacts the destination
+func (r *recorder) Check() error {
+	return nil
+}
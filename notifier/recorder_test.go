@@ -0,0 +1,87 @@
+package notifier_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/notifier"
+)
+
+// fakeNotifier renders the message as its payload, counting the messages it's asked to send
+type fakeNotifier struct {
+	sent int
+}
+
+func (f *fakeNotifier) Payload(message string, event notifier.Event) (json.RawMessage, error) {
+	if "" == message {
+		return nil, errors.New("empty message")
+	}
+
+	return json.Marshal(map[string]string{"message": message, "user_id": event.UserId})
+}
+
+func (f *fakeNotifier) Notify(message string, event notifier.Event) error {
+	f.sent++
+	return nil
+}
+
+func (f *fakeNotifier) Check() error {
+	return errors.New("unreachable")
+}
+
+func TestRecorder(t *testing.T) {
+	fake := &fakeNotifier{}
+	recording := notifier.NewRecording(notifier.DefaultRecordingLimit)
+	recorder := notifier.NewRecorder("default", fake, recording)
+
+	if err := recorder.Notify("live", notifier.Event{UserId: "42"}); nil != err {
+		t.Fatal(err)
+	}
+
+	if 0 != fake.sent {
+		t.Fatal("expected nothing to be sent")
+	}
+
+	messages := recording.Messages()
+	if 1 != len(messages) || "default" != messages[0].Destination || `{"message":"live","user_id":"42"}` != string(messages[0].Body) {
+		t.Fatalf("got %+v", messages)
+	}
+
+	if messages[0].RecordedAt.IsZero() {
+		t.Fatal("expected the time to be recorded")
+	}
+
+	if err := recorder.Notify("", notifier.Event{}); nil == err {
+		t.Fatal("expected the payload error to be returned")
+	}
+
+	if err := recorder.Check(); nil != err {
+		t.Fatalf("expected the destination not to be checked, got %v", err)
+	}
+}
+
+func TestRecordingLimit(t *testing.T) {
+	recording := notifier.NewRecording(2)
+	recorder := notifier.NewRecorder("default", &fakeNotifier{}, recording)
+
+	for _, message := range []string{"first", "second", "third"} {
+		recorder.Notify(message, notifier.Event{})
+	}
+
+	messages := recording.Messages()
+	if 2 != len(messages) || `{"message":"second","user_id":""}` != string(messages[0].Body) || `{"message":"third","user_id":""}` != string(messages[1].Body) {
+		t.Fatalf("expected the oldest message to be forgotten, got %+v", messages)
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	event := notifier.Event{ThumbnailUrl: "https://static-cdn.jtvnw.net/previews-ttv/live_user_streamer-{width}x{height}.jpg"}
+	if "https://static-cdn.jtvnw.net/previews-ttv/live_user_streamer-1280x720.jpg" != event.Thumbnail() {
+		t.Fatalf("got %q", event.Thumbnail())
+	}
+
+	if "" != (notifier.Event{}).Thumbnail() {
+		t.Fatal("expected no thumbnail")
+	}
+}
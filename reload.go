@@ -0,0 +1,171 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/settings"
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+const (
+	// ConfigPollInterval is how often the configuration file is checked for changes
+	ConfigPollInterval time.Duration = 10 * time.Second
+)
+
+var (
+	announcerLock sync.RWMutex
+	reloadLock    sync.Mutex
+)
+
+// currentAnnouncer returns the announcer for the running configuration. Notifications hold on
+// to the announcer they started with, so a reload never interrupts one in flight.
+func currentAnnouncer() *Announcer {
+	announcerLock.RLock()
+	defer announcerLock.RUnlock()
+
+	return announcer
+}
+
+// setAnnouncer replaces the announcer for the running configuration
+func setAnnouncer(next *Announcer) {
+	announcerLock.Lock()
+	defer announcerLock.Unlock()
+
+	announcer = next
+}
+
+// notifyUrl returns the callback url Twitch delivers notifications to. The host is bound at
+// startup, so the startup configuration is always current.
+func notifyUrl() string {
+	return config.Host.Url + "/" + NotifyEndPoint
+}
+
+// WatchConfig reloads the configuration file whenever the process receives SIGHUP or the
+// file is modified
+func WatchConfig(configPath string) {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+
+	ticker := time.NewTicker(ConfigPollInterval)
+	defer ticker.Stop()
+
+	lastModified := configModified(configPath)
+	for {
+		select {
+		case <-hangups:
+			logutil.Info("Received SIGHUP, reloading configuration", "path", configPath)
+
+		case <-ticker.C:
+			modified := configModified(configPath)
+			if modified.Equal(lastModified) {
+				continue
+			}
+
+			lastModified = modified
+			logutil.Info("Configuration file changed, reloading", "path", configPath)
+		}
+
+		ReloadConfig(configPath)
+	}
+}
+
+// configModified returns the modification time of the configuration file, or the zero time
+// if it can't be read
+func configModified(configPath string) time.Time {
+	info, err := os.Stat(configPath)
+	if nil != err {
+		return time.Time{}
+	}
+
+	return info.ModTime()
+}
+
+// ReloadConfig loads the configuration file and applies it to the running bot. If the new
+// configuration fails to load or validate, the running configuration is kept.
+func ReloadConfig(configPath string) error {
+	reloadLock.Lock()
+	defer reloadLock.Unlock()
+
+	previous := currentAnnouncer()
+
+	next, err := settings.LoadConfig(configPath)
+	if nil != err {
+		logutil.Error("Rejected configuration reload, keeping previous configuration", logutil.ErrorKey, err)
+		return err
+	}
+
+	diff := settings.Diff(previous.Config(), next)
+	if diff.IsEmpty() {
+		logutil.Info("Configuration reloaded, no changes")
+		return nil
+	}
+
+	// Storage, Twitch, Http, Host and Processing settings are bound at startup
+	if len(diff.RestartRequired) > 0 {
+		logutil.Warn("Changes require a restart to take effect", "sections", strings.Join(diff.RestartRequired, ","))
+		next.Host = previous.Config().Host
+		next.Twitch = previous.Config().Twitch
+		next.Http = previous.Config().Http
+		next.Storage = previous.Config().Storage
+		next.Processing = previous.Config().Processing
+	}
+
+	// Keep the users of streamers that remain, and look up those that were added
+	users := []twitch.TwitchUser{}
+	removed := []string{}
+	for _, user := range previous.Users() {
+		if nil == next.Streamer(user.UserName) {
+			removed = append(removed, user.UserId)
+			continue
+		}
+
+		users = append(users, user)
+	}
+
+	added := []string{}
+	if len(diff.AddedStreamers) > 0 {
+		addedUsers, err := twitchClient.UsersFor(diff.AddedStreamers)
+		if nil != err {
+			logutil.Error("Rejected configuration reload, keeping previous configuration", logutil.ErrorKey, err)
+			return err
+		}
+
+		for _, user := range addedUsers {
+			users = append(users, user)
+			added = append(added, user.UserId)
+		}
+	}
+
+	nextAnnouncer, err := NewAnnouncer(next, users, twitchClient.GameName)
+	if nil != err {
+		logutil.Error("Rejected configuration reload, keeping previous configuration", logutil.ErrorKey, err)
+		return err
+	}
+
+	setAnnouncer(nextAnnouncer)
+	logutil.Configure(next.LogLevel(), next.Logging.Format)
+	logutil.Info("Configuration reloaded", "changes", diff.String())
+
+	if len(added) > 0 {
+		err := twitchClient.SubscribeToStreams(notifyUrl(), added)
+		if nil != err {
+			logutil.Error("Failed to subscribe to added streamers", logutil.ErrorKey, err)
+		}
+	}
+
+	if len(removed) > 0 {
+		err := twitchClient.UnsubscribeFromStreams(notifyUrl(), removed)
+		if nil != err {
+			logutil.Error("Failed to unsubscribe from removed streamers", logutil.ErrorKey, err)
+		}
+	}
+
+	return nil
+}
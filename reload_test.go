@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/settings"
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+)
+
+// writeTestConfig writes the configuration to a file in a new temporary directory, returning
+// its path and a function which removes it
+func writeTestConfig(t *testing.T, config *settings.Config) (string, func()) {
+	dir, err := ioutil.TempDir("", "reload-test")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "config.json")
+	remove := func() { os.RemoveAll(dir) }
+
+	if err := rewriteTestConfig(path, config); nil != err {
+		remove()
+		t.Fatal(err)
+	}
+
+	return path, remove
+}
+
+// rewriteTestConfig replaces the configuration file's contents
+func rewriteTestConfig(path string, config *settings.Config) error {
+	data, err := json.Marshal(config)
+	if nil != err {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+func TestReloadConfigAppliesChanges(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	next := bot.config()
+	next.Templates[settings.DefaultTemplateName] = "{{.DisplayName}} went live"
+	next.DryRun = true
+
+	path, remove := writeTestConfig(t, next)
+	defer remove()
+
+	previous := currentAnnouncer()
+	if err := ReloadConfig(path); nil != err {
+		t.Fatal(err)
+	}
+
+	reloaded := currentAnnouncer()
+	if previous == reloaded {
+		t.Fatal("expected the announcer to be replaced")
+	}
+
+	if !reloaded.Config().DryRun || "{{.DisplayName}} went live" != reloaded.Config().Templates[settings.DefaultTemplateName] {
+		t.Fatalf("expected the changes to be applied, got %+v", reloaded.Config())
+	}
+
+	if 1 != len(reloaded.UserIds()) {
+		t.Fatalf("expected the streamer's user to be kept, got %v", reloaded.UserIds())
+	}
+
+	if config.DryRun {
+		t.Fatal("expected the startup configuration to be left alone")
+	}
+}
+
+func TestReloadConfigKeepsStartupSettings(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	next := bot.config()
+	next.Host.Port = "4000"
+	next.Http.UserAgent = "changed"
+	next.Processing.Workers = 16
+	next.Capture.Limit = 10
+
+	path, remove := writeTestConfig(t, next)
+	defer remove()
+
+	if err := ReloadConfig(path); nil != err {
+		t.Fatal(err)
+	}
+
+	reloaded := currentAnnouncer().Config()
+	if settings.DefaultPort != reloaded.Host.Port || settings.DefaultWorkers != reloaded.Processing.Workers {
+		t.Fatalf("expected the startup host and processing settings to be kept, got %+v and %+v", reloaded.Host, reloaded.Processing)
+	}
+
+	if "multi-twitch-discord-bot" != reloaded.Http.UserAgent {
+		t.Fatalf("expected the startup http settings to be kept, got %+v", reloaded.Http)
+	}
+
+	if 10 != reloaded.Capture.Limit {
+		t.Fatalf("expected the capture change to be applied, got %+v", reloaded.Capture)
+	}
+}
+
+func TestReloadConfigRejectsInvalidConfig(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	next := bot.config()
+	next.Destinations[0].WebHookToken = ""
+
+	path, remove := writeTestConfig(t, next)
+	defer remove()
+
+	previous := currentAnnouncer()
+	if err := ReloadConfig(path); nil == err {
+		t.Fatal("expected the invalid configuration to be rejected")
+	}
+
+	if previous != currentAnnouncer() {
+		t.Fatal("expected the running configuration to be kept")
+	}
+}
+
+func TestReloadConfigWhileDelivering(t *testing.T) {
+	bot := startTestBot(t, func(config *settings.Config) {
+		// A tiny queue means some deliveries find it full
+		config.Processing.QueueSize = 1
+	})
+	defer bot.Close()
+
+	path, remove := writeTestConfig(t, bot.config())
+	defer remove()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		for i := 0; i < 10; i++ {
+			next := bot.config()
+			next.DryRun = 0 == i%2
+			if err := rewriteTestConfig(path, next); nil != err {
+				t.Error(err)
+				return
+			}
+
+			ReloadConfig(path)
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			started := time.Date(2020, 1, 1, i, 0, 0, 0, time.UTC).Format(time.RFC3339)
+			bot.twitch.GoLive(twitch.TwitchNotification{Id: started, UserId: "42", Type: "live", StartedAt: started})
+		}(i)
+	}
+
+	wg.Wait()
+}
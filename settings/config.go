@@ -0,0 +1,843 @@
+package settings
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/discord"
+	"github.com/mbolt35/multi-twitch-discord-bot/matrix"
+	"github.com/mbolt35/multi-twitch-discord-bot/slack"
+	"github.com/mbolt35/multi-twitch-discord-bot/storage"
+	"github.com/mbolt35/multi-twitch-discord-bot/telegram"
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+	"github.com/mbolt35/multi-twitch-discord-bot/webhook"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+const (
+	// ConfigFileEnvVar is the path of the configuration file, when not provided by flag
+	ConfigFileEnvVar string = "CONFIG_FILE"
+
+	// DefaultDestinationName is the destination configured by the discord web hook
+	// environment variables
+	DefaultDestinationName string = "default"
+
+	// DefaultTemplateName is the template used by streamers which don't specify one
+	DefaultTemplateName string = "default"
+
+	// DefaultTemplate is the announcement posted when a streamer goes live
+	DefaultTemplate string = "{{escape .DisplayName}} is now live! {{.Url}}"
+
+	// DiscordDestinationType is the destination type for Discord web hooks
+	DiscordDestinationType string = "discord"
+
+	// SlackDestinationType is the destination type for Slack incoming web hooks
+	SlackDestinationType string = "slack"
+
+	// WebHookDestinationType is the destination type for generic outgoing web hooks
+	WebHookDestinationType string = "webhook"
+
+	// MatrixDestinationType is the destination type for Matrix rooms
+	MatrixDestinationType string = "matrix"
+
+	// TelegramDestinationType is the destination type for Telegram chats
+	TelegramDestinationType string = "telegram"
+)
+
+// twitchLoginPattern matches valid Twitch login names
+var twitchLoginPattern = regexp.MustCompile(`^[a-zA-Z0-9_]{1,25}$`)
+
+// Config is the complete configuration of the bot, loaded from a JSON file with
+// environment variables overriding individual fields
+type Config struct {
+	Host         HostConfig              `json:"host"`
+	Twitch       TwitchConfig            `json:"twitch"`
+	Http         HttpConfig              `json:"http"`
+	Storage      StorageConfig           `json:"storage"`
+	Logging      LoggingConfig           `json:"logging"`
+	Processing   ProcessingConfig        `json:"processing"`
+	Admin        AdminConfig             `json:"admin"`
+	Capture      CaptureConfig           `json:"capture"`
+	DryRun       bool                    `json:"dry_run"`
+	Streamers    []StreamerConfig        `json:"streamers"`
+	Destinations []DestinationConfig     `json:"destinations"`
+	Templates    map[string]string       `json:"templates"`
+	Filters      map[string]FilterConfig `json:"filters"`
+}
+
+// HostConfig configures the web server receiving Twitch notifications
+type HostConfig struct {
+	// Url is the public base url of the host for constructing callback urls
+	Url string `json:"url"`
+
+	// Port is the port the web server listens on
+	Port string `json:"port"`
+}
+
+// TwitchConfig configures communication with the Twitch APIs
+type TwitchConfig struct {
+	// ClientId is the Twitch App Client Identifier
+	ClientId string `json:"client_id"`
+
+	// ApiUrl is the base url of the Twitch APIs, replaced to run against a stand-in server
+	ApiUrl string `json:"api_url"`
+
+	// Secret signs the notifications Twitch delivers, or a random secret is generated at
+	// startup if empty
+	Secret string `json:"secret"`
+}
+
+// HttpConfig configures the requests sent to the Twitch and Discord APIs
+type HttpConfig struct {
+	// TimeoutSeconds limits how long any single request may take
+	TimeoutSeconds int `json:"timeout_seconds"`
+
+	// UserAgent identifies the bot in every request
+	UserAgent string `json:"user_agent"`
+}
+
+// StorageConfig configures the backing store for persisting records
+type StorageConfig struct {
+	// Url selects the backing store, or in memory storage if empty
+	Url string `json:"url"`
+
+	// CacheSize is the number of keys cached in memory, or 0 to disable caching
+	CacheSize int `json:"cache_size"`
+
+	// InitAttempts is the number of attempts made to connect at startup
+	InitAttempts int `json:"init_attempts"`
+
+	// FallbackToMemory uses in memory storage if the store never becomes available
+	FallbackToMemory bool `json:"fallback_to_memory"`
+
+	// MaxConnections is the maximum number of open database connections
+	MaxConnections int `json:"max_connections"`
+}
+
+// LoggingConfig configures the bot's log output
+type LoggingConfig struct {
+	// Level is the minimum level logged: debug, info, warn or error
+	Level string `json:"level"`
+
+	// Format is the log entry format: logfmt or json
+	Format string `json:"format"`
+}
+
+// ProcessingConfig configures the workers processing notifications after they have been
+// acknowledged
+type ProcessingConfig struct {
+	// Workers is the number of notifications processed in parallel
+	Workers int `json:"workers"`
+
+	// QueueSize is the number of notifications which may be waiting to be processed before
+	// deliveries are refused, so Twitch retries them later
+	QueueSize int `json:"queue_size"`
+}
+
+// AdminConfig configures the admin end points
+type AdminConfig struct {
+	// Token must be sent as a bearer token to use the admin end points, which are disabled
+	// when it is empty
+	Token string `json:"token"`
+}
+
+// CaptureConfig configures keeping the raw notification deliveries, so they can be
+// inspected and replayed
+type CaptureConfig struct {
+	// Limit is the number of most recent deliveries kept, or 0 to keep none
+	Limit int `json:"limit"`
+
+	// MaxAgeHours is how long a delivery is kept
+	MaxAgeHours int `json:"max_age_hours"`
+}
+
+// StreamerConfig configures a single Twitch streamer to announce
+type StreamerConfig struct {
+	// Login is the Twitch login name of the streamer
+	Login string `json:"login"`
+
+	// Destinations are the names of the destinations to announce to, or every
+	// destination if empty
+	Destinations []string `json:"destinations,omitempty"`
+
+	// Template is the name of the announcement template, or the default if empty
+	Template string `json:"template,omitempty"`
+
+	// Filter is the name of the filter an event must match to be announced, if any
+	Filter string `json:"filter,omitempty"`
+}
+
+// DestinationConfig configures a single destination announcements are sent to
+type DestinationConfig struct {
+	// Name identifies the destination for routing
+	Name string `json:"name"`
+
+	// Type is the kind of destination, "discord", "slack", "webhook", "matrix" or "telegram"
+	Type string `json:"type"`
+
+	// WebHookId is the discord web hook id
+	WebHookId string `json:"webhook_id,omitempty"`
+
+	// WebHookToken is the discord web hook token
+	WebHookToken string `json:"webhook_token,omitempty"`
+
+	// ApiUrl is the base url of the discord API, matrix homeserver or telegram Bot API, or
+	// the public one if empty
+	ApiUrl string `json:"api_url,omitempty"`
+
+	// WebHookUrl is the slack incoming web hook url, or the url generic web hook events
+	// are posted to
+	WebHookUrl string `json:"webhook_url,omitempty"`
+
+	// Secret signs generic web hook events, which are unsigned if it's empty
+	Secret string `json:"secret,omitempty"`
+
+	// Attempts is the number of attempts made to deliver each generic web hook event, or
+	// the default if 0
+	Attempts int `json:"attempts,omitempty"`
+
+	// RoomId is the matrix room id
+	RoomId string `json:"room_id,omitempty"`
+
+	// AccessToken is the access token of the matrix user, who must have joined the room
+	AccessToken string `json:"access_token,omitempty"`
+
+	// ChatId is the telegram chat id, or a channel's @username
+	ChatId string `json:"chat_id,omitempty"`
+
+	// BotToken is the token of the telegram bot, which must be a member of the chat
+	BotToken string `json:"bot_token,omitempty"`
+}
+
+// FilterConfig restricts which go live events are announced. Every non-empty condition
+// must match.
+type FilterConfig struct {
+	// GameIds only announces streams playing one of the game ids
+	GameIds []string `json:"game_ids,omitempty"`
+
+	// Languages only announces streams in one of the languages
+	Languages []string `json:"languages,omitempty"`
+
+	// TitleIncludes only announces streams whose title contains one of the phrases
+	TitleIncludes []string `json:"title_includes,omitempty"`
+
+	// TitleExcludes never announces streams whose title contains one of the phrases
+	TitleExcludes []string `json:"title_excludes,omitempty"`
+}
+
+// ValidationError lists every problem found in a Config
+type ValidationError struct {
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("Invalid configuration, %d problem(s):\n  - %s", len(e.Problems), strings.Join(e.Problems, "\n  - "))
+}
+
+// add records a problem
+func (e *ValidationError) add(format string, args ...interface{}) {
+	e.Problems = append(e.Problems, fmt.Sprintf(format, args...))
+}
+
+// DefaultConfig returns the configuration used before any file or environment variables
+// are applied
+func DefaultConfig() *Config {
+	return &Config{
+		Host: HostConfig{
+			Url:  DefaultHostUrl,
+			Port: DefaultPort,
+		},
+		Twitch: TwitchConfig{
+			ApiUrl: twitch.DefaultOptions.ApiUrl,
+		},
+		Http: HttpConfig{
+			TimeoutSeconds: int(httputil.DefaultTimeout / time.Second),
+			UserAgent:      httputil.DefaultUserAgent,
+		},
+		Storage: StorageConfig{
+			CacheSize:      storage.DefaultCacheSize,
+			InitAttempts:   DefaultStoreInitAttempts,
+			MaxConnections: storage.DefaultPoolOptions.MaxOpenConnections,
+		},
+		Logging: LoggingConfig{
+			Level:  DefaultLogLevel,
+			Format: logutil.FormatLogfmt,
+		},
+		Processing: ProcessingConfig{
+			Workers:   DefaultWorkers,
+			QueueSize: DefaultQueueSize,
+		},
+		Capture: CaptureConfig{
+			MaxAgeHours: DefaultCaptureMaxAgeHours,
+		},
+		Templates: map[string]string{},
+		Filters:   map[string]FilterConfig{},
+	}
+}
+
+// ConfigPath returns the configuration file path from the flag value, falling back to the
+// environment variable. An empty path configures the bot from the environment alone.
+func ConfigPath(flagValue string) string {
+	if "" != flagValue {
+		return flagValue
+	}
+
+	return os.Getenv(ConfigFileEnvVar)
+}
+
+// LoadConfig loads the configuration file at the path, if any, applies environment variable
+// overrides and validates the result
+func LoadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+
+	if "" != path {
+		data, err := ioutil.ReadFile(path)
+		if nil != err {
+			return nil, err
+		}
+
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err = decoder.Decode(config); nil != err {
+			return nil, fmt.Errorf("Failed to parse %s: %s", path, err)
+		}
+	}
+
+	problems := &ValidationError{}
+	config.applyEnvironment(problems)
+	config.applyDefaults()
+	config.validate(problems)
+
+	if len(problems.Problems) > 0 {
+		return nil, problems
+	}
+
+	return config, nil
+}
+
+// applyEnvironment overrides individual fields with any environment variables that are set
+func (c *Config) applyEnvironment(problems *ValidationError) {
+	overrideString(&c.Host.Url, HostUrlEnvVar)
+	overrideString(&c.Host.Port, HostPortEnvVar)
+	overrideString(&c.Storage.Url, DatabaseHostEnvVar)
+	overrideString(&c.Twitch.ClientId, ClientIdEnvVar)
+	overrideString(&c.Twitch.ApiUrl, TwitchApiUrlEnvVar)
+	overrideString(&c.Twitch.Secret, TwitchSecretEnvVar)
+	overrideString(&c.Http.UserAgent, UserAgentEnvVar)
+	overrideString(&c.Admin.Token, AdminTokenEnvVar)
+	overrideString(&c.Logging.Level, LogLevelEnvVar)
+	overrideString(&c.Logging.Format, LogFormatEnvVar)
+	overrideInt(&c.Storage.CacheSize, StoreCacheSizeEnvVar, problems)
+	overrideInt(&c.Storage.InitAttempts, StoreInitAttemptsEnvVar, problems)
+	overrideInt(&c.Storage.MaxConnections, DatabaseMaxConnectionsEnvVar, problems)
+	overrideInt(&c.Processing.Workers, WorkersEnvVar, problems)
+	overrideInt(&c.Processing.QueueSize, QueueSizeEnvVar, problems)
+	overrideInt(&c.Http.TimeoutSeconds, HttpTimeoutEnvVar, problems)
+	overrideInt(&c.Capture.Limit, CaptureLimitEnvVar, problems)
+
+	overrideBool(&c.Storage.FallbackToMemory, StoreFallbackEnvVar, problems)
+	overrideBool(&c.DryRun, DryRunEnvVar, problems)
+
+	// A list of users in the environment replaces the configured streamers
+	if userNames := os.Getenv(UsersEnvVar); "" != userNames {
+		c.Streamers = []StreamerConfig{}
+		for _, login := range strings.Split(userNames, ",") {
+			c.Streamers = append(c.Streamers, StreamerConfig{Login: strings.TrimSpace(login)})
+		}
+	}
+
+	hookId := os.Getenv(DiscordWebHookIdEnvVar)
+	hookToken := os.Getenv(DiscordWebHookTokenEnvVar)
+	if "" != hookId || "" != hookToken {
+		destination := c.Destination(DefaultDestinationName)
+		if nil == destination {
+			c.Destinations = append(c.Destinations, DestinationConfig{
+				Name: DefaultDestinationName,
+				Type: DiscordDestinationType,
+			})
+			destination = &c.Destinations[len(c.Destinations)-1]
+		}
+
+		overrideString(&destination.WebHookId, DiscordWebHookIdEnvVar)
+		overrideString(&destination.WebHookToken, DiscordWebHookTokenEnvVar)
+	}
+}
+
+// overrideString replaces the field with the environment variable, if set
+func overrideString(field *string, name string) {
+	if value := os.Getenv(name); "" != value {
+		*field = value
+	}
+}
+
+// overrideInt replaces the field with the environment variable, if set
+func overrideInt(field *int, name string, problems *ValidationError) {
+	value := os.Getenv(name)
+	if "" == value {
+		return
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if nil != err {
+		problems.add("$%s: %q is not an integer", name, value)
+		return
+	}
+
+	*field = parsed
+}
+
+// overrideBool replaces the field with the environment variable, if set
+func overrideBool(field *bool, name string, problems *ValidationError) {
+	value := os.Getenv(name)
+	if "" == value {
+		return
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if nil != err {
+		problems.add("$%s: %q is not a boolean", name, value)
+		return
+	}
+
+	*field = parsed
+}
+
+// applyDefaults fills in fields which may be omitted
+func (c *Config) applyDefaults() {
+	if nil == c.Templates {
+		c.Templates = map[string]string{}
+	}
+
+	if _, ok := c.Templates[DefaultTemplateName]; !ok {
+		c.Templates[DefaultTemplateName] = DefaultTemplate
+	}
+
+	if nil == c.Filters {
+		c.Filters = map[string]FilterConfig{}
+	}
+
+	for i := range c.Destinations {
+		if "" == c.Destinations[i].Type {
+			c.Destinations[i].Type = DiscordDestinationType
+		}
+	}
+
+	c.Host.Url = strings.TrimRight(c.Host.Url, "/")
+	c.Twitch.ApiUrl = strings.TrimRight(c.Twitch.ApiUrl, "/")
+}
+
+// Validate checks the configuration, reporting every problem found at once
+func (c *Config) Validate() error {
+	problems := &ValidationError{}
+	c.validate(problems)
+
+	if len(problems.Problems) > 0 {
+		return problems
+	}
+
+	return nil
+}
+
+// validate records every problem with the configuration
+func (c *Config) validate(problems *ValidationError) {
+	if "" == c.Host.Url {
+		problems.add("host.url: required")
+	} else if !isAbsoluteUrl(c.Host.Url) {
+		problems.add("host.url: %q is not an absolute url", c.Host.Url)
+	}
+
+	if port, err := strconv.Atoi(c.Host.Port); nil != err || port < 1 || port > 65535 {
+		problems.add("host.port: %q is not a valid port", c.Host.Port)
+	}
+
+	if "" == c.Twitch.ClientId {
+		problems.add("twitch.client_id: required (or set $%s)", ClientIdEnvVar)
+	}
+
+	if !isAbsoluteUrl(c.Twitch.ApiUrl) {
+		problems.add("twitch.api_url: %q is not an absolute url", c.Twitch.ApiUrl)
+	}
+
+	if len(c.Twitch.Secret) >= twitch.TwitchMaxSecretBytes {
+		problems.add("twitch.secret: must be shorter than %d bytes", twitch.TwitchMaxSecretBytes)
+	}
+
+	if c.Http.TimeoutSeconds < 1 {
+		problems.add("http.timeout_seconds: must be at least 1")
+	}
+
+	if "" == c.Http.UserAgent {
+		problems.add("http.user_agent: required")
+	}
+
+	if "" != c.Storage.Url {
+		if _, err := url.Parse(c.Storage.Url); nil != err {
+			problems.add("storage.url: %s", err)
+		}
+	}
+
+	if c.Storage.CacheSize < 0 {
+		problems.add("storage.cache_size: must not be negative")
+	}
+
+	if c.Storage.InitAttempts < 1 {
+		problems.add("storage.init_attempts: must be at least 1")
+	}
+
+	if c.Storage.MaxConnections < 0 {
+		problems.add("storage.max_connections: must not be negative")
+	}
+
+	if c.Processing.Workers < 1 {
+		problems.add("processing.workers: must be at least 1")
+	}
+
+	if c.Processing.QueueSize < 1 {
+		problems.add("processing.queue_size: must be at least 1")
+	}
+
+	if c.Capture.Limit < 0 {
+		problems.add("capture.limit: must not be negative")
+	}
+
+	if c.Capture.MaxAgeHours < 1 {
+		problems.add("capture.max_age_hours: must be at least 1")
+	}
+
+	if _, err := logutil.ParseLevel(c.Logging.Level); nil != err {
+		problems.add("logging.level: %s", err)
+	}
+
+	if !logutil.IsFormat(c.Logging.Format) {
+		problems.add("logging.format: %q is not %s or %s", c.Logging.Format, logutil.FormatLogfmt, logutil.FormatJson)
+	}
+
+	c.validateDestinations(problems)
+	c.validateTemplates(problems)
+	c.validateStreamers(problems)
+}
+
+// validateDestinations checks each destination is named uniquely and fully configured
+func (c *Config) validateDestinations(problems *ValidationError) {
+	if len(c.Destinations) == 0 {
+		problems.add("destinations: at least one destination is required (or set $%s and $%s)",
+			DiscordWebHookIdEnvVar, DiscordWebHookTokenEnvVar)
+	}
+
+	names := map[string]bool{}
+	for i, destination := range c.Destinations {
+		field := fmt.Sprintf("destinations[%d]", i)
+
+		if "" == destination.Name {
+			problems.add("%s.name: required", field)
+		} else if names[destination.Name] {
+			problems.add("%s.name: duplicate destination %q", field, destination.Name)
+		}
+		names[destination.Name] = true
+
+		if "" != destination.ApiUrl && !isAbsoluteUrl(destination.ApiUrl) {
+			problems.add("%s.api_url: %q is not an absolute url", field, destination.ApiUrl)
+		}
+
+		switch destination.Type {
+		case DiscordDestinationType:
+			if "" == destination.WebHookId {
+				problems.add("%s.webhook_id: required for discord destinations", field)
+			}
+
+			if "" == destination.WebHookToken {
+				problems.add("%s.webhook_token: required for discord destinations", field)
+			}
+
+		case SlackDestinationType, WebHookDestinationType:
+			if "" == destination.WebHookUrl {
+				problems.add("%s.webhook_url: required for %s destinations", field, destination.Type)
+			} else if !isAbsoluteUrl(destination.WebHookUrl) {
+				problems.add("%s.webhook_url: not an absolute url", field)
+			}
+
+			if destination.Attempts < 0 {
+				problems.add("%s.attempts: must not be negative", field)
+			}
+
+		case MatrixDestinationType:
+			if "" == destination.RoomId {
+				problems.add("%s.room_id: required for matrix destinations", field)
+			}
+
+			if "" == destination.AccessToken {
+				problems.add("%s.access_token: required for matrix destinations", field)
+			}
+
+		case TelegramDestinationType:
+			if "" == destination.ChatId {
+				problems.add("%s.chat_id: required for telegram destinations", field)
+			}
+
+			if "" == destination.BotToken {
+				problems.add("%s.bot_token: required for telegram destinations", field)
+			}
+
+		default:
+			problems.add("%s.type: unknown destination type %q", field, destination.Type)
+		}
+	}
+}
+
+// validateTemplates checks every template parses
+func (c *Config) validateTemplates(problems *ValidationError) {
+	for _, name := range sortedKeys(c.Templates) {
+		if _, err := NewTemplate(name, c.Templates[name]); nil != err {
+			problems.add("templates.%s: %s", name, err)
+		}
+	}
+}
+
+// validateStreamers checks each streamer is unique and only references configured
+// destinations, templates and filters
+func (c *Config) validateStreamers(problems *ValidationError) {
+	if len(c.Streamers) == 0 {
+		problems.add("streamers: at least one streamer is required (or set $%s)", UsersEnvVar)
+	}
+
+	logins := map[string]bool{}
+	for i, streamer := range c.Streamers {
+		field := fmt.Sprintf("streamers[%d]", i)
+		login := strings.ToLower(streamer.Login)
+
+		if !twitchLoginPattern.MatchString(streamer.Login) {
+			problems.add("%s.login: %q is not a valid Twitch login", field, streamer.Login)
+		} else if logins[login] {
+			problems.add("%s.login: duplicate streamer %q", field, streamer.Login)
+		}
+		logins[login] = true
+
+		for j, name := range streamer.Destinations {
+			if nil == c.Destination(name) {
+				problems.add("%s.destinations[%d]: unknown destination %q", field, j, name)
+			}
+		}
+
+		if "" != streamer.Template {
+			if _, ok := c.Templates[streamer.Template]; !ok {
+				problems.add("%s.template: unknown template %q", field, streamer.Template)
+			}
+		}
+
+		if "" != streamer.Filter {
+			if _, ok := c.Filters[streamer.Filter]; !ok {
+				problems.add("%s.filter: unknown filter %q", field, streamer.Filter)
+			}
+		}
+	}
+}
+
+// Destination returns the destination with the name, or nil if there is none
+func (c *Config) Destination(name string) *DestinationConfig {
+	for i := range c.Destinations {
+		if c.Destinations[i].Name == name {
+			return &c.Destinations[i]
+		}
+	}
+
+	return nil
+}
+
+// Streamer returns the streamer with the login, or nil if there is none
+func (c *Config) Streamer(login string) *StreamerConfig {
+	for i := range c.Streamers {
+		if strings.EqualFold(c.Streamers[i].Login, login) {
+			return &c.Streamers[i]
+		}
+	}
+
+	return nil
+}
+
+// Logins returns the login names of every configured streamer
+func (c *Config) Logins() []string {
+	logins := []string{}
+	for _, streamer := range c.Streamers {
+		logins = append(logins, streamer.Login)
+	}
+
+	return logins
+}
+
+// DestinationsFor returns the destination names a streamer announces to
+func (c *Config) DestinationsFor(streamer *StreamerConfig) []string {
+	if len(streamer.Destinations) > 0 {
+		return streamer.Destinations
+	}
+
+	names := []string{}
+	for _, destination := range c.Destinations {
+		names = append(names, destination.Name)
+	}
+
+	return names
+}
+
+// TemplateFor returns the template name a streamer announces with
+func (c *Config) TemplateFor(streamer *StreamerConfig) string {
+	if "" != streamer.Template {
+		return streamer.Template
+	}
+
+	return DefaultTemplateName
+}
+
+// LogLevel returns the configured minimum log level
+func (c *Config) LogLevel() logutil.Level {
+	level, _ := logutil.ParseLevel(c.Logging.Level)
+	return level
+}
+
+// PoolOptions returns the connection pool limits for SQL databases
+func (c *Config) PoolOptions() storage.PoolOptions {
+	pool := storage.DefaultPoolOptions
+	pool.MaxOpenConnections = c.Storage.MaxConnections
+
+	if pool.MaxIdleConnections > pool.MaxOpenConnections && pool.MaxOpenConnections > 0 {
+		pool.MaxIdleConnections = pool.MaxOpenConnections
+	}
+
+	return pool
+}
+
+// TwitchOptions returns how the Twitch client communicates with the Twitch APIs
+func (c *Config) TwitchOptions() twitch.Options {
+	options := twitch.DefaultOptions
+	options.ApiUrl = c.Twitch.ApiUrl
+	options.ClientOptions = c.Http.ClientOptions()
+	options.Secret = c.Twitch.Secret
+
+	return options
+}
+
+// DiscordOptions returns how the destination's client communicates with the Discord API
+func (c *Config) DiscordOptions(destination DestinationConfig) discord.Options {
+	options := discord.DefaultOptions
+	if "" != destination.ApiUrl {
+		options.ApiUrl = destination.ApiUrl
+	}
+	options.ClientOptions = c.Http.ClientOptions()
+
+	return options
+}
+
+// SlackOptions returns how slack clients communicate with their web hooks
+func (c *Config) SlackOptions() slack.Options {
+	options := slack.DefaultOptions
+	options.ClientOptions = c.Http.ClientOptions()
+
+	return options
+}
+
+// MatrixOptions returns how the destination's client communicates with its homeserver
+func (c *Config) MatrixOptions(destination DestinationConfig) matrix.Options {
+	options := matrix.DefaultOptions
+	if "" != destination.ApiUrl {
+		options.ApiUrl = destination.ApiUrl
+	}
+	options.ClientOptions = c.Http.ClientOptions()
+
+	return options
+}
+
+// TelegramOptions returns how the destination's client communicates with the Bot API
+func (c *Config) TelegramOptions(destination DestinationConfig) telegram.Options {
+	options := telegram.DefaultOptions
+	if "" != destination.ApiUrl {
+		options.ApiUrl = destination.ApiUrl
+	}
+	options.ClientOptions = c.Http.ClientOptions()
+
+	return options
+}
+
+// WebHookOptions returns how the destination's generic web hook client delivers events
+func (c *Config) WebHookOptions(destination DestinationConfig) webhook.Options {
+	options := webhook.DefaultOptions
+	if destination.Attempts > 0 {
+		options.Attempts = destination.Attempts
+	}
+	options.ClientOptions = c.Http.ClientOptions()
+
+	return options
+}
+
+// MaxAge returns how long a captured delivery is kept
+func (c CaptureConfig) MaxAge() time.Duration {
+	return time.Duration(c.MaxAgeHours) * time.Hour
+}
+
+// Timeout returns the request timeout as a duration
+func (h HttpConfig) Timeout() time.Duration {
+	return time.Duration(h.TimeoutSeconds) * time.Second
+}
+
+// ClientOptions returns how notifiers' http clients send requests
+func (h HttpConfig) ClientOptions() httputil.ClientOptions {
+	options := httputil.DefaultClientOptions
+	options.Timeout = h.Timeout()
+	options.UserAgent = h.UserAgent
+
+	return options
+}
+
+// isAbsoluteUrl determines whether the value is a url with a scheme and host
+func isAbsoluteUrl(value string) bool {
+	u, err := url.Parse(value)
+	return nil == err && "" != u.Scheme && "" != u.Host
+}
+
+// Matches determines whether a stream's game, language and title pass the filter
+func (f FilterConfig) Matches(gameId string, language string, title string) bool {
+	if len(f.GameIds) > 0 && !containsFold(f.GameIds, gameId) {
+		return false
+	}
+
+	if len(f.Languages) > 0 && !containsFold(f.Languages, language) {
+		return false
+	}
+
+	lowerTitle := strings.ToLower(title)
+	if len(f.TitleIncludes) > 0 && !containsPhrase(f.TitleIncludes, lowerTitle) {
+		return false
+	}
+
+	return !containsPhrase(f.TitleExcludes, lowerTitle)
+}
+
+// containsFold determines whether the values contain the value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsPhrase determines whether the lower case text contains any of the phrases
+func containsPhrase(phrases []string, lowerText string) bool {
+	for _, phrase := range phrases {
+		if strings.Contains(lowerText, strings.ToLower(phrase)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,352 @@
+package settings_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/discord"
+	"github.com/mbolt35/multi-twitch-discord-bot/settings"
+)
+
+// useEnvironment replaces the environment with the values, returning a function which
+// restores the original environment
+func useEnvironment(values map[string]string) func() {
+	original := os.Environ()
+
+	os.Clearenv()
+	for name, value := range values {
+		os.Setenv(name, value)
+	}
+
+	return func() {
+		os.Clearenv()
+		for _, pair := range original {
+			parts := strings.SplitN(pair, "=", 2)
+			if len(parts) == 2 {
+				os.Setenv(parts[0], parts[1])
+			}
+		}
+	}
+}
+
+// writeConfig writes the configuration to a file in a new temporary directory, returning
+// its path and a function which removes it
+func writeConfig(t *testing.T, text string) (string, func()) {
+	dir, err := ioutil.TempDir("", "settings-test")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(text), 0600); nil != err {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return path, func() { os.RemoveAll(dir) }
+}
+
+// validConfig returns a minimal configuration which passes validation
+func validConfig() *settings.Config {
+	config := settings.DefaultConfig()
+	config.Twitch.ClientId = "client-id"
+	config.Streamers = []settings.StreamerConfig{{Login: "streamer"}}
+	config.Destinations = []settings.DestinationConfig{
+		{Name: "default", Type: settings.DiscordDestinationType, WebHookId: "1", WebHookToken: "token"},
+	}
+	config.Templates[settings.DefaultTemplateName] = settings.DefaultTemplate
+
+	return config
+}
+
+// expectProblems fails unless the error is a ValidationError with exactly the problems
+func expectProblems(t *testing.T, err error, expected ...string) {
+	validationErr, ok := err.(*settings.ValidationError)
+	if !ok {
+		t.Fatalf("expected a ValidationError, got %v", err)
+	}
+
+	if strings.Join(expected, "\n") != strings.Join(validationErr.Problems, "\n") {
+		t.Fatalf("expected problems:\n  %s\ngot:\n  %s", strings.Join(expected, "\n  "), strings.Join(validationErr.Problems, "\n  "))
+	}
+}
+
+func TestLoadExampleConfig(t *testing.T) {
+	defer useEnvironment(nil)()
+
+	config, err := settings.LoadConfig(filepath.Join("..", "config.example.json"))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if "https://my-bot.herokuapp.com" != config.Host.Url {
+		t.Errorf("host.url = %q", config.Host.Url)
+	}
+
+	if 6 != len(config.Destinations) || 2 != len(config.Streamers) {
+		t.Errorf("got %d destinations and %d streamers", len(config.Destinations), len(config.Streamers))
+	}
+
+	if settings.DefaultTemplate != config.Templates[settings.DefaultTemplateName] {
+		t.Errorf("expected the default template to be added, got %q", config.Templates[settings.DefaultTemplateName])
+	}
+}
+
+func TestLoadConfigFromEnvironment(t *testing.T) {
+	defer useEnvironment(map[string]string{
+		settings.ClientIdEnvVar:            "client-id",
+		settings.UsersEnvVar:               "first, second",
+		settings.DiscordWebHookIdEnvVar:    "123",
+		settings.DiscordWebHookTokenEnvVar: "token",
+		settings.HostUrlEnvVar:             "https://bot.example.com/",
+		settings.TwitchSecretEnvVar:        "hub-secret",
+		settings.WorkersEnvVar:             "8",
+		settings.DryRunEnvVar:              "true",
+	})()
+
+	config, err := settings.LoadConfig("")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if "first,second" != strings.Join(config.Logins(), ",") {
+		t.Errorf("logins = %v", config.Logins())
+	}
+
+	destination := config.Destination(settings.DefaultDestinationName)
+	if nil == destination || settings.DiscordDestinationType != destination.Type || "123" != destination.WebHookId || "token" != destination.WebHookToken {
+		t.Errorf("default destination = %+v", destination)
+	}
+
+	if "https://bot.example.com" != config.Host.Url {
+		t.Errorf("expected the trailing slash to be trimmed, got %q", config.Host.Url)
+	}
+
+	if "hub-secret" != config.Twitch.Secret || "hub-secret" != config.TwitchOptions().Secret {
+		t.Errorf("twitch secret = %q", config.Twitch.Secret)
+	}
+
+	if 8 != config.Processing.Workers || !config.DryRun {
+		t.Errorf("workers = %d, dry run = %v", config.Processing.Workers, config.DryRun)
+	}
+}
+
+func TestEnvironmentOverridesConfigFile(t *testing.T) {
+	path, remove := writeConfig(t, `{
+		"twitch": {"client_id": "from-file"},
+		"streamers": [{"login": "streamer"}],
+		"destinations": [{"name": "default", "webhook_id": "1", "webhook_token": "file-token"}]
+	}`)
+	defer remove()
+
+	defer useEnvironment(map[string]string{
+		settings.ClientIdEnvVar:            "from-environment",
+		settings.DiscordWebHookTokenEnvVar: "environment-token",
+	})()
+
+	config, err := settings.LoadConfig(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if "from-environment" != config.Twitch.ClientId {
+		t.Errorf("client id = %q", config.Twitch.ClientId)
+	}
+
+	destination := config.Destination("default")
+	if "1" != destination.WebHookId || "environment-token" != destination.WebHookToken {
+		t.Errorf("destination = %+v", destination)
+	}
+
+	if settings.DiscordDestinationType != destination.Type {
+		t.Errorf("expected the type to default to discord, got %q", destination.Type)
+	}
+}
+
+func TestLoadConfigReportsEveryProblem(t *testing.T) {
+	path, remove := writeConfig(t, `{
+		"host": {"url": "not a url", "port": "0"},
+		"twitch": {"secret": "`+strings.Repeat("x", 200)+`"},
+		"processing": {"workers": 0, "queue_size": 1},
+		"streamers": [
+			{"login": "streamer", "destinations": ["missing"], "template": "missing"},
+			{"login": "STREAMER", "filter": "missing"},
+			{"login": "not a login"}
+		],
+		"destinations": [
+			{"name": "default", "webhook_id": "1"},
+			{"name": "default", "type": "slack", "webhook_url": "/relative"},
+			{"name": "other", "type": "carrier-pigeon"}
+		],
+		"templates": {"broken": "{{.Missing}}"}
+	}`)
+	defer remove()
+
+	defer useEnvironment(nil)()
+
+	_, err := settings.LoadConfig(path)
+	expectProblems(t, err,
+		`host.url: "not a url" is not an absolute url`,
+		`host.port: "0" is not a valid port`,
+		`twitch.client_id: required (or set $TWITCH_CLIENT_ID)`,
+		`twitch.secret: must be shorter than 200 bytes`,
+		`processing.workers: must be at least 1`,
+		`destinations[0].webhook_token: required for discord destinations`,
+		`destinations[1].name: duplicate destination "default"`,
+		`destinations[1].webhook_url: not an absolute url`,
+		`destinations[2].type: unknown destination type "carrier-pigeon"`,
+		`templates.broken: template: broken:1:2: executing "broken" at <.Missing>: can't evaluate field Missing in type settings.TemplateData`,
+		`streamers[0].destinations[0]: unknown destination "missing"`,
+		`streamers[0].template: unknown template "missing"`,
+		`streamers[1].login: duplicate streamer "STREAMER"`,
+		`streamers[1].filter: unknown filter "missing"`,
+		`streamers[2].login: "not a login" is not a valid Twitch login`)
+}
+
+func TestLoadConfigRejectsMalformedEnvironment(t *testing.T) {
+	defer useEnvironment(map[string]string{
+		settings.ClientIdEnvVar:            "client-id",
+		settings.UsersEnvVar:               "streamer",
+		settings.DiscordWebHookIdEnvVar:    "1",
+		settings.DiscordWebHookTokenEnvVar: "token",
+		settings.WorkersEnvVar:             "many",
+		settings.DryRunEnvVar:              "sometimes",
+	})()
+
+	_, err := settings.LoadConfig("")
+	expectProblems(t, err,
+		`$WORKERS: "many" is not an integer`,
+		`$DRY_RUN: "sometimes" is not a boolean`)
+}
+
+func TestLoadConfigRejectsUnknownFields(t *testing.T) {
+	path, remove := writeConfig(t, `{"twitch": {"client_id": "client-id", "clientid": "typo"}}`)
+	defer remove()
+
+	defer useEnvironment(nil)()
+
+	if _, err := settings.LoadConfig(path); nil == err || !strings.Contains(err.Error(), "clientid") {
+		t.Fatalf("expected the unknown field to be reported, got %v", err)
+	}
+}
+
+func TestValidateDestinations(t *testing.T) {
+	cases := map[string]struct {
+		destination settings.DestinationConfig
+		problems    []string
+	}{
+		"slack": {
+			settings.DestinationConfig{Name: "default", Type: settings.SlackDestinationType},
+			[]string{"destinations[0].webhook_url: required for slack destinations"},
+		},
+		"webhook": {
+			settings.DestinationConfig{Name: "default", Type: settings.WebHookDestinationType, WebHookUrl: "https://example.com", Attempts: -1},
+			[]string{"destinations[0].attempts: must not be negative"},
+		},
+		"matrix": {
+			settings.DestinationConfig{Name: "default", Type: settings.MatrixDestinationType, ApiUrl: "matrix.org"},
+			[]string{
+				`destinations[0].api_url: "matrix.org" is not an absolute url`,
+				"destinations[0].room_id: required for matrix destinations",
+				"destinations[0].access_token: required for matrix destinations",
+			},
+		},
+		"telegram": {
+			settings.DestinationConfig{Name: "default", Type: settings.TelegramDestinationType, ChatId: "@channel"},
+			[]string{"destinations[0].bot_token: required for telegram destinations"},
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			config := validConfig()
+			config.Destinations = []settings.DestinationConfig{c.destination}
+
+			expectProblems(t, config.Validate(), c.problems...)
+		})
+	}
+}
+
+func TestValidConfig(t *testing.T) {
+	if err := validConfig().Validate(); nil != err {
+		t.Fatal(err)
+	}
+}
+
+func TestDestinationsAndTemplateFor(t *testing.T) {
+	config := validConfig()
+	config.Destinations = append(config.Destinations, settings.DestinationConfig{Name: "other"})
+
+	everywhere := &settings.StreamerConfig{Login: "everywhere"}
+	if "default,other" != strings.Join(config.DestinationsFor(everywhere), ",") {
+		t.Errorf("expected every destination, got %v", config.DestinationsFor(everywhere))
+	}
+
+	if settings.DefaultTemplateName != config.TemplateFor(everywhere) {
+		t.Errorf("expected the default template, got %q", config.TemplateFor(everywhere))
+	}
+
+	routed := &settings.StreamerConfig{Login: "routed", Destinations: []string{"other"}, Template: "custom"}
+	if "other" != strings.Join(config.DestinationsFor(routed), ",") || "custom" != config.TemplateFor(routed) {
+		t.Errorf("got %v and %q", config.DestinationsFor(routed), config.TemplateFor(routed))
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	filter := settings.FilterConfig{
+		GameIds:       []string{"1", "2"},
+		Languages:     []string{"EN"},
+		TitleIncludes: []string{"Speedrun", "any%"},
+		TitleExcludes: []string{"practice"},
+	}
+
+	cases := []struct {
+		gameId   string
+		language string
+		title    string
+		matches  bool
+	}{
+		{"1", "en", "Any% speedrun", true},
+		{"2", "en", "ANY% attempts", true},
+		{"3", "en", "Any% speedrun", false},
+		{"1", "de", "Any% speedrun", false},
+		{"1", "en", "Casual stream", false},
+		{"1", "en", "Speedrun practice", false},
+	}
+
+	for _, c := range cases {
+		if matches := filter.Matches(c.gameId, c.language, c.title); c.matches != matches {
+			t.Errorf("Matches(%q, %q, %q) = %v, expected %v", c.gameId, c.language, c.title, matches, c.matches)
+		}
+	}
+
+	if !(settings.FilterConfig{}).Matches("", "", "") {
+		t.Error("expected an empty filter to match everything")
+	}
+}
+
+func TestClientOptions(t *testing.T) {
+	config := validConfig()
+	config.Twitch.ApiUrl = "http://localhost:1234"
+	config.Http.TimeoutSeconds = 3
+	config.Http.UserAgent = "test-agent"
+
+	twitchOptions := config.TwitchOptions()
+	if "http://localhost:1234" != twitchOptions.ApiUrl || 3*time.Second != twitchOptions.Timeout || "test-agent" != twitchOptions.UserAgent {
+		t.Errorf("twitch options = %+v", twitchOptions)
+	}
+
+	discordOptions := config.DiscordOptions(config.Destinations[0])
+	if discord.DefaultOptions.ApiUrl != discordOptions.ApiUrl || 3*time.Second != discordOptions.Timeout || "test-agent" != discordOptions.UserAgent {
+		t.Errorf("discord options = %+v", discordOptions)
+	}
+
+	config.Destinations[0].ApiUrl = "http://localhost:5678/api"
+	if discordOptions := config.DiscordOptions(config.Destinations[0]); "http://localhost:5678/api" != discordOptions.ApiUrl {
+		t.Errorf("expected the destination's api url, got %q", discordOptions.ApiUrl)
+	}
+}
@@ -0,0 +1,194 @@
+package settings
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// ConfigDiff describes the differences between a running Config and a newly loaded one
+type ConfigDiff struct {
+	AddedStreamers      []string
+	RemovedStreamers    []string
+	ChangedStreamers    []string
+	AddedDestinations   []string
+	RemovedDestinations []string
+	ChangedDestinations []string
+	ChangedTemplates    []string
+	ChangedFilters      []string
+	LoggingChanged      bool
+	AdminChanged        bool
+	DryRunChanged       bool
+	CaptureChanged      bool
+	RestartRequired     []string
+}
+
+// Diff compares the previous and next configurations
+func Diff(previous *Config, next *Config) ConfigDiff {
+	diff := ConfigDiff{}
+
+	previousStreamers := streamersByLogin(previous)
+	nextStreamers := streamersByLogin(next)
+	diff.AddedStreamers, diff.RemovedStreamers, diff.ChangedStreamers = diffKeys(previousStreamers, nextStreamers)
+
+	previousDestinations := destinationsByName(previous)
+	nextDestinations := destinationsByName(next)
+	diff.AddedDestinations, diff.RemovedDestinations, diff.ChangedDestinations = diffKeys(previousDestinations, nextDestinations)
+
+	added, removed, changed := diffKeys(stringMap(previous.Templates), stringMap(next.Templates))
+	diff.ChangedTemplates = sortedUnion(added, removed, changed)
+
+	added, removed, changed = diffKeys(filterMap(previous.Filters), filterMap(next.Filters))
+	diff.ChangedFilters = sortedUnion(added, removed, changed)
+
+	diff.LoggingChanged = previous.Logging != next.Logging
+	diff.AdminChanged = previous.Admin != next.Admin
+	diff.DryRunChanged = previous.DryRun != next.DryRun
+	diff.CaptureChanged = previous.Capture != next.Capture
+
+	if previous.Host != next.Host {
+		diff.RestartRequired = append(diff.RestartRequired, "host")
+	}
+
+	if previous.Twitch != next.Twitch {
+		diff.RestartRequired = append(diff.RestartRequired, "twitch")
+	}
+
+	if previous.Http != next.Http {
+		diff.RestartRequired = append(diff.RestartRequired, "http")
+	}
+
+	if previous.Storage != next.Storage {
+		diff.RestartRequired = append(diff.RestartRequired, "storage")
+	}
+
+	if previous.Processing != next.Processing {
+		diff.RestartRequired = append(diff.RestartRequired, "processing")
+	}
+
+	return diff
+}
+
+// IsEmpty determines whether the configurations were equivalent
+func (d ConfigDiff) IsEmpty() bool {
+	return reflect.DeepEqual(d, ConfigDiff{})
+}
+
+// String describes the differences for logging
+func (d ConfigDiff) String() string {
+	parts := []string{}
+
+	describe := func(label string, names []string) {
+		if len(names) > 0 {
+			parts = append(parts, label+": "+strings.Join(names, ", "))
+		}
+	}
+
+	describe("streamers added", d.AddedStreamers)
+	describe("streamers removed", d.RemovedStreamers)
+	describe("streamers changed", d.ChangedStreamers)
+	describe("destinations added", d.AddedDestinations)
+	describe("destinations removed", d.RemovedDestinations)
+	describe("destinations changed", d.ChangedDestinations)
+	describe("templates changed", d.ChangedTemplates)
+	describe("filters changed", d.ChangedFilters)
+	if d.LoggingChanged {
+		parts = append(parts, "logging changed")
+	}
+
+	if d.AdminChanged {
+		parts = append(parts, "admin changed")
+	}
+
+	if d.DryRunChanged {
+		parts = append(parts, "dry run changed")
+	}
+
+	if d.CaptureChanged {
+		parts = append(parts, "capture changed")
+	}
+
+	describe("restart required for", d.RestartRequired)
+
+	if len(parts) == 0 {
+		return "no changes"
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// streamersByLogin indexes the streamers by lower case login
+func streamersByLogin(c *Config) map[string]interface{} {
+	result := map[string]interface{}{}
+	for _, streamer := range c.Streamers {
+		result[strings.ToLower(streamer.Login)] = streamer
+	}
+
+	return result
+}
+
+// destinationsByName indexes the destinations by name
+func destinationsByName(c *Config) map[string]interface{} {
+	result := map[string]interface{}{}
+	for _, destination := range c.Destinations {
+		result[destination.Name] = destination
+	}
+
+	return result
+}
+
+// stringMap converts the values of the map for comparison
+func stringMap(m map[string]string) map[string]interface{} {
+	result := map[string]interface{}{}
+	for key, value := range m {
+		result[key] = value
+	}
+
+	return result
+}
+
+// filterMap converts the values of the map for comparison
+func filterMap(m map[string]FilterConfig) map[string]interface{} {
+	result := map[string]interface{}{}
+	for key, value := range m {
+		result[key] = value
+	}
+
+	return result
+}
+
+// diffKeys returns the sorted keys added to, removed from and changed between the maps
+func diffKeys(previous map[string]interface{}, next map[string]interface{}) ([]string, []string, []string) {
+	var added, removed, changed []string
+
+	for key, value := range next {
+		previousValue, ok := previous[key]
+		if !ok {
+			added = append(added, key)
+		} else if !reflect.DeepEqual(previousValue, value) {
+			changed = append(changed, key)
+		}
+	}
+
+	for key := range previous {
+		if _, ok := next[key]; !ok {
+			removed = append(removed, key)
+		}
+	}
+
+	sort.Strings(added)
+	sort.Strings(removed)
+	sort.Strings(changed)
+	return added, removed, changed
+}
+
+// sortedUnion returns every name from the lists, sorted
+func sortedUnion(lists ...[]string) []string {
+	var result []string
+	for _, list := range lists {
+		result = append(result, list...)
+	}
+
+	sort.Strings(result)
+	return result
+}
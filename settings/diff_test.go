@@ -0,0 +1,72 @@
+package settings_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/settings"
+)
+
+func TestDiffOfEqualConfigsIsEmpty(t *testing.T) {
+	diff := settings.Diff(validConfig(), validConfig())
+
+	if !diff.IsEmpty() {
+		t.Fatalf("expected no changes, got %s", diff)
+	}
+
+	if "no changes" != diff.String() {
+		t.Fatalf("got %q", diff.String())
+	}
+}
+
+func TestDiff(t *testing.T) {
+	previous := validConfig()
+	previous.Streamers = append(previous.Streamers,
+		settings.StreamerConfig{Login: "removed"},
+		settings.StreamerConfig{Login: "changed"})
+	previous.Destinations = append(previous.Destinations,
+		settings.DestinationConfig{Name: "removed", Type: settings.SlackDestinationType, WebHookUrl: "https://hooks.slack.com/a"})
+	previous.Templates["removed"] = "{{.Url}}"
+	previous.Filters["changed"] = settings.FilterConfig{Languages: []string{"en"}}
+
+	next := validConfig()
+	next.Streamers = append(next.Streamers,
+		settings.StreamerConfig{Login: "Changed", Template: "added"},
+		settings.StreamerConfig{Login: "added"})
+	next.Destinations[0].WebHookToken = "rotated"
+	next.Destinations = append(next.Destinations,
+		settings.DestinationConfig{Name: "added", Type: settings.SlackDestinationType, WebHookUrl: "https://hooks.slack.com/b"})
+	next.Templates["added"] = "{{.Title}}"
+	next.Filters["changed"] = settings.FilterConfig{Languages: []string{"de"}}
+	next.Logging.Level = "debug"
+	next.Capture.Limit = 10
+	next.Host.Port = "4000"
+	next.Storage.Url = "redis://localhost"
+
+	expected := settings.ConfigDiff{
+		AddedStreamers:      []string{"added"},
+		RemovedStreamers:    []string{"removed"},
+		ChangedStreamers:    []string{"changed"},
+		AddedDestinations:   []string{"added"},
+		RemovedDestinations: []string{"removed"},
+		ChangedDestinations: []string{"default"},
+		ChangedTemplates:    []string{"added", "removed"},
+		ChangedFilters:      []string{"changed"},
+		LoggingChanged:      true,
+		CaptureChanged:      true,
+		RestartRequired:     []string{"host", "storage"},
+	}
+
+	diff := settings.Diff(previous, next)
+	if !reflect.DeepEqual(expected, diff) {
+		t.Fatalf("expected %+v, got %+v", expected, diff)
+	}
+
+	described := "streamers added: added; streamers removed: removed; streamers changed: changed; " +
+		"destinations added: added; destinations removed: removed; destinations changed: default; " +
+		"templates changed: added, removed; filters changed: changed; logging changed; capture changed; " +
+		"restart required for: host, storage"
+	if described != diff.String() {
+		t.Fatalf("got %q", diff.String())
+	}
+}
@@ -0,0 +1,68 @@
+package settings
+
+import (
+	"encoding/json"
+	"regexp"
+
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+var (
+	// secretSettings are the known settings whose values are always secret
+	secretSettings = map[string]bool{
+		DiscordWebHookTokenEnvVar: true,
+		TwitchSecretEnvVar:        true,
+	}
+
+	// secretNamePattern matches the names of settings which are likely to be secret
+	secretNamePattern = regexp.MustCompile(`(?i)(token|secret|passw(or)?d|pwd|api_?key|private_?key|credential|auth)`)
+)
+
+// IsSecretSetting determines whether the value of the named setting should never be shown
+func IsSecretSetting(name string) bool {
+	return secretSettings[name] || secretNamePattern.MatchString(name)
+}
+
+// RedactSetting returns the value of the named setting as it is safe to show. Secret settings
+// are masked entirely, and the passwords of urls and web hook tokens are removed from the rest.
+func RedactSetting(name string, value string) string {
+	if "" == value {
+		return value
+	}
+
+	if IsSecretSetting(name) {
+		return logutil.Redacted
+	}
+
+	return logutil.Scrub(value)
+}
+
+// Redacted returns a copy of the configuration with its secrets masked
+func (c *Config) Redacted() *Config {
+	redacted := *c
+	redacted.Storage.Url = RedactSetting(DatabaseHostEnvVar, c.Storage.Url)
+	redacted.Admin.Token = RedactSetting(AdminTokenEnvVar, c.Admin.Token)
+	redacted.Twitch.Secret = RedactSetting(TwitchSecretEnvVar, c.Twitch.Secret)
+
+	redacted.Destinations = make([]DestinationConfig, len(c.Destinations))
+	for i, destination := range c.Destinations {
+		destination.WebHookToken = RedactSetting(DiscordWebHookTokenEnvVar, destination.WebHookToken)
+		destination.WebHookUrl = RedactSetting("webhook_url", destination.WebHookUrl)
+		destination.Secret = RedactSetting("secret", destination.Secret)
+		destination.AccessToken = RedactSetting("access_token", destination.AccessToken)
+		destination.BotToken = RedactSetting("bot_token", destination.BotToken)
+		redacted.Destinations[i] = destination
+	}
+
+	return &redacted
+}
+
+// String describes the configuration as JSON, with its secrets masked
+func (c *Config) String() string {
+	jsonBytes, err := json.MarshalIndent(c.Redacted(), "", "  ")
+	if nil != err {
+		return err.Error()
+	}
+
+	return string(jsonBytes)
+}
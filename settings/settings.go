@@ -1,10 +1,11 @@
 package settings
 
 import (
-	"fmt"
-	"log"
 	"os"
+	"sort"
 	"strings"
+
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
 )
 
 const (
@@ -20,126 +21,101 @@ const (
 	// The Twitch App Client Identifier used when communicating with Twitch APIs
 	ClientIdEnvVar string = "TWITCH_CLIENT_ID"
 
+	// The base url of the Twitch APIs, replaced to run against a stand-in server
+	TwitchApiUrlEnvVar string = "TWITCH_API_URL"
+
+	// The secret Twitch signs notification deliveries with
+	TwitchSecretEnvVar string = "TWITCH_WEBHOOK_SECRET"
+
+	// The number of seconds any single Twitch or Discord API request may take
+	HttpTimeoutEnvVar string = "HTTP_TIMEOUT_SECONDS"
+
+	// The User-Agent sent with every Twitch and Discord API request
+	UserAgentEnvVar string = "HTTP_USER_AGENT"
+
 	// A comma delimited list of Twitch user names to subscribe to go live events for
 	UsersEnvVar string = "TWITCH_USERS"
 
-	// The discord web hook id environment variable
-	DiscordWebHookIdEnvVar string = "DISCORD_WEBHOOK_ID"
+	// The number of storage keys cached in memory, or 0 to disable caching
+	StoreCacheSizeEnvVar string = "STORE_CACHE_SIZE"
 
-	// The discord web hook token environment variable
-	DiscordWebHookTokenEnvVar string = "DISCORD_WEBHOOK_TOKEN"
+	// The number of attempts made to connect to the database at startup
+	StoreInitAttemptsEnvVar string = "STORE_INIT_ATTEMPTS"
 
-	// The default host url
-	DefaultHostUrl string = "http://localhost"
+	// When "true", in memory storage is used if the database never becomes available,
+	// rather than exiting
+	StoreFallbackEnvVar string = "STORE_FALLBACK_TO_MEMORY"
 
-	// Default Port Value when running locally
-	DefaultPort string = "3001"
-)
-
-var (
-	twitchClientId      string
-	twitchUserNames     []string
-	hostUrl             string
-	hostPort            string
-	discordWebHookId    string
-	discordWebHookToken string
-	databaseHost        string
-)
+	// The maximum number of open database connections
+	DatabaseMaxConnectionsEnvVar string = "DATABASE_MAX_CONNECTIONS"
 
-// DumpEnvironmentVariables is a Debug Function to Dump All Environment Variables to stdout
-func DumpEnvironmentVariables() {
-	fmt.Println("--- ENV Vars ---")
-	for _, e := range os.Environ() {
-		pair := strings.Split(e, "=")
-		fmt.Println(pair[0] + " = " + os.Getenv(pair[0]))
-	}
-	fmt.Println("---------------")
-}
+	// The discord web hook id environment variable
+	DiscordWebHookIdEnvVar string = "DISCORD_WEBHOOK_ID"
 
-// GetHostUrl Gets the Host URL base
-func GetHostUrl() string {
-	host := os.Getenv(HostUrlEnvVar)
+	// The discord web hook token environment variable
+	DiscordWebHookTokenEnvVar string = "DISCORD_WEBHOOK_TOKEN"
 
-	if host == "" {
-		host = DefaultHostUrl
-	}
+	// The minimum level of log entries written: debug, info, warn or error
+	LogLevelEnvVar string = "LOG_LEVEL"
 
-	return host
-}
+	// The format of log entries: logfmt or json
+	LogFormatEnvVar string = "LOG_FORMAT"
 
-// GetHostPort Gets the port the web app should be hosted on
-func GetHostPort() string {
-	if "" != hostPort {
-		return hostPort
-	}
+	// The number of notifications processed in parallel
+	WorkersEnvVar string = "WORKERS"
 
-	hostPort = os.Getenv(HostPortEnvVar)
+	// The number of notifications which may be waiting to be processed
+	QueueSizeEnvVar string = "QUEUE_SIZE"
 
-	if hostPort == "" {
-		log.Println("$PORT not set. Defaulting to 3001")
-		hostPort = DefaultPort
-	}
+	// When "true", announcements are logged and recorded rather than sent
+	DryRunEnvVar string = "DRY_RUN"
 
-	return hostPort
-}
+	// The bearer token required by the admin end points, which are disabled without one
+	AdminTokenEnvVar string = "ADMIN_TOKEN"
 
-// GetDatabaseHost Gets the database host url
-func GetDatabaseHost() string {
-	if "" != databaseHost {
-		return databaseHost
-	}
+	// The number of most recent raw notification deliveries kept, or 0 to keep none
+	CaptureLimitEnvVar string = "CAPTURE_LIMIT"
 
-	databaseHost = os.Getenv(DatabaseHostEnvVar)
+	// The default host url
+	DefaultHostUrl string = "http://localhost"
 
-	if "" == databaseHost {
-		log.Println("$DATABASE_URL not set.")
-	}
+	// Default Port Value when running locally
+	DefaultPort string = "3001"
 
-	return databaseHost
-}
+	// DefaultLogLevel logs normal operation, but not debugging detail
+	DefaultLogLevel string = "info"
 
-// GetClientId Gets the Client Identifier Header for HTTP Requests
-func GetClientId() string {
-	if "" != twitchClientId {
-		return twitchClientId
-	}
+	// DefaultWorkers processes a few streamers' notifications in parallel
+	DefaultWorkers int = 4
 
-	twitchClientId = os.Getenv(ClientIdEnvVar)
-	return twitchClientId
-}
+	// DefaultQueueSize is far more notifications than arrive at once for a handful of streamers
+	DefaultQueueSize int = 100
 
-// GetUserNames Gets the name of twitch users to listen for go live events
-func GetUserNames() []string {
-	if nil != twitchUserNames {
-		return twitchUserNames
-	}
+	// DefaultCaptureMaxAgeHours keeps captured deliveries for a week
+	DefaultCaptureMaxAgeHours int = 7 * 24
 
-	userNames := os.Getenv(UsersEnvVar)
-	if "" != userNames {
-		twitchUserNames = strings.Split(userNames, ",")
-	} else {
-		twitchUserNames = []string{}
-	}
+	// DefaultStoreInitAttempts retries the database for roughly a minute before giving up
+	DefaultStoreInitAttempts int = 6
+)
 
-	return twitchUserNames
-}
+// DumpEnvironmentVariables is a Debug Function to Log All Environment Variables, with
+// secrets redacted
+func DumpEnvironmentVariables() {
+	names := []string{}
+	values := make(map[string]string)
+	for _, e := range os.Environ() {
+		pair := strings.SplitN(e, "=", 2)
+		if len(pair) != 2 {
+			continue
+		}
 
-// GetDiscordHookId gets the Discord WebHook Id
-func GetDiscordHookId() string {
-	if "" != discordWebHookId {
-		return discordWebHookId
+		names = append(names, pair[0])
+		values[pair[0]] = pair[1]
 	}
 
-	discordWebHookId = os.Getenv(DiscordWebHookIdEnvVar)
-	return discordWebHookId
-}
+	sort.Strings(names)
 
-// GetDiscordHookToken gets the Discord WebHook Token
-func GetDiscordHookToken() string {
-	if "" != discordWebHookToken {
-		return discordWebHookToken
+	for _, name := range names {
+		logutil.Debug("Environment variable", "name", name, "value", RedactSetting(name, values[name]))
 	}
-
-	discordWebHookToken = os.Getenv(DiscordWebHookTokenEnvVar)
-	return discordWebHookToken
 }
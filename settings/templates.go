@@ -0,0 +1,92 @@
+package settings
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// TemplateData is the data available to announcement templates
+type TemplateData struct {
+	UserId       string
+	Login        string
+	DisplayName  string
+	Title        string
+	GameId       string
+	GameName     string
+	Language     string
+	StartedAt    string
+	ViewerCount  int
+	ThumbnailUrl string
+	Url          string
+}
+
+// SampleTemplateData is used to check templates render when they are loaded
+var SampleTemplateData = TemplateData{
+	UserId:       "12345",
+	Login:        "sample_streamer",
+	DisplayName:  "Sample_Streamer",
+	Title:        "Sample Stream",
+	GameId:       "1",
+	GameName:     "Sample Game",
+	Language:     "en",
+	StartedAt:    "2019-01-01T00:00:00Z",
+	ViewerCount:  1,
+	ThumbnailUrl: "https://static-cdn.jtvnw.net/previews-ttv/live_user_sample_streamer-{width}x{height}.jpg",
+	Url:          "http://twitch.tv/sample_streamer",
+}
+
+// templateFuncs are the functions available to announcement templates
+var templateFuncs = template.FuncMap{
+	"escape": EscapeMarkdown,
+	"upper":  strings.ToUpper,
+	"lower":  strings.ToLower,
+}
+
+// EscapeMarkdown escapes the characters in s which discord would treat as markdown
+func EscapeMarkdown(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, "_", `\_`, "*", `\*`, "~", `\~`, "`", "\\`", "|", `\|`)
+	return replacer.Replace(s)
+}
+
+// NewTemplate parses an announcement template, and checks it renders with sample data
+func NewTemplate(name string, text string) (*template.Template, error) {
+	return NewTemplateWithEscape(name, text, EscapeMarkdown)
+}
+
+// NewTemplateWithEscape parses an announcement template whose escape function is the one
+// given, for destinations which don't use discord's markdown
+func NewTemplateWithEscape(name string, text string, escape func(s string) string) (*template.Template, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Funcs(template.FuncMap{"escape": escape}).Option("missingkey=error").Parse(text)
+	if nil != err {
+		return nil, err
+	}
+
+	if _, err = RenderTemplate(t, SampleTemplateData); nil != err {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// RenderTemplate renders an announcement template with the data
+func RenderTemplate(t *template.Template, data TemplateData) (string, error) {
+	buffer := &bytes.Buffer{}
+	if err := t.Execute(buffer, data); nil != err {
+		return "", err
+	}
+
+	return buffer.String(), nil
+}
+
+// sortedKeys returns the keys of the map in sorted order
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,7 @@
+package slack
+
+import (
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+var requests = httputil.NewRequestMetrics("slack", "Slack web hook")
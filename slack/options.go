@@ -0,0 +1,22 @@
+package slack
+
+import (
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+// Options configures how a Slack client sends requests to its incoming web hook
+type Options struct {
+	// ClientOptions configure the http client and user agent
+	httputil.ClientOptions
+}
+
+// DefaultOptions are used by clients created without options
+var DefaultOptions = Options{
+	ClientOptions: httputil.DefaultClientOptions,
+}
+
+// withDefaults returns the options with an empty user agent replaced by the default
+func (o Options) withDefaults() Options {
+	o.ClientOptions = o.ClientOptions.WithDefaults()
+	return o
+}
@@ -0,0 +1,215 @@
+// Package slack announces go live events to Slack channels through incoming web hooks, as
+// Block Kit messages.
+package slack
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/notifier"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+const (
+	// WatchButtonText labels the button linking to the stream
+	WatchButtonText string = "Watch on Twitch"
+)
+
+// Message is an incoming web hook request body. Text is shown in notifications and by
+// clients which can't show the blocks.
+type Message struct {
+	Text   string  `json:"text"`
+	Blocks []Block `json:"blocks,omitempty"`
+}
+
+// Block is a Block Kit layout block
+type Block struct {
+	Type      string    `json:"type"`
+	Text      *Text     `json:"text,omitempty"`
+	ImageUrl  string    `json:"image_url,omitempty"`
+	AltText   string    `json:"alt_text,omitempty"`
+	Elements  []Element `json:"elements,omitempty"`
+	Accessory *Element  `json:"accessory,omitempty"`
+}
+
+// Text is a Block Kit text object
+type Text struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+// Element is a Block Kit block element or context element
+type Element struct {
+	Type string `json:"type"`
+	Text *Text  `json:"text,omitempty"`
+	Url  string `json:"url,omitempty"`
+
+	// Context elements are text objects, which are flattened into the element
+	ContextText string `json:"-"`
+}
+
+// MarshalJSON encodes context text elements as plain text objects
+func (e Element) MarshalJSON() ([]byte, error) {
+	if "" != e.ContextText {
+		return json.Marshal(Text{Type: e.Type, Text: e.ContextText})
+	}
+
+	type element Element
+	return json.Marshal(element(e))
+}
+
+// slack is a notifier.Notifier for a Slack incoming web hook
+type slack struct {
+	webHookUrl string
+	userAgent  string
+	httpClient *http.Client
+}
+
+var _ notifier.Notifier = &slack{}
+var _ notifier.Escaper = &slack{}
+
+// NewSlack creates a Notifier which posts to the incoming web hook url
+func NewSlack(webHookUrl string, options Options) notifier.Notifier {
+	options = options.withDefaults()
+
+	instance := slack{
+		webHookUrl: webHookUrl,
+		userAgent:  options.UserAgent,
+		httpClient: options.NewClient(),
+	}
+
+	return &instance
+}
+
+// escape escapes the characters Slack treats as markup
+func escape(s string) string {
+	s = strings.Replace(s, "&", "&amp;", -1)
+	s = strings.Replace(s, "<", "&lt;", -1)
+	return strings.Replace(s, ">", "&gt;", -1)
+}
+
+// Escape escapes what templates insert into the message, which is Slack's fallback text
+func (s *slack) Escape(text string) string {
+	return escape(text)
+}
+
+// NewMessage renders the event as a Block Kit message, with the message as its text
+func NewMessage(message string, event notifier.Event) Message {
+	headline := fmt.Sprintf("*<%s|%s>* is now live!", event.Url, escape(event.DisplayName))
+	if "" != event.Title {
+		headline += "\n" + escape(event.Title)
+	}
+
+	blocks := []Block{
+		{
+			Type: "section",
+			Text: &Text{Type: "mrkdwn", Text: headline},
+		},
+	}
+
+	if thumbnail := event.Thumbnail(); "" != thumbnail {
+		blocks = append(blocks, Block{
+			Type:     "image",
+			ImageUrl: thumbnail,
+			AltText:  event.DisplayName + "'s stream",
+		})
+	}
+
+	if game := event.Game(); "" != game {
+		blocks = append(blocks, Block{
+			Type:     "context",
+			Elements: []Element{{Type: "mrkdwn", ContextText: "Playing " + escape(game)}},
+		})
+	}
+
+	blocks = append(blocks, Block{
+		Type: "actions",
+		Elements: []Element{{
+			Type: "button",
+			Text: &Text{Type: "plain_text", Text: WatchButtonText},
+			Url:  event.Url,
+		}},
+	})
+
+	return Message{
+		Text:   message,
+		Blocks: blocks,
+	}
+}
+
+// Payload returns the Block Kit message announcing the event
+func (s *slack) Payload(message string, event notifier.Event) (json.RawMessage, error) {
+	jsonBytes, err := httputil.EncodeJson(NewMessage(message, event))
+	if nil != err {
+		return nil, err
+	}
+
+	return json.RawMessage(bytes.TrimSpace(jsonBytes)), nil
+}
+
+// Notify posts the Block Kit message announcing the event
+func (s *slack) Notify(message string, event notifier.Event) error {
+	body, err := s.Payload(message, event)
+	if nil != err {
+		return err
+	}
+
+	statusCode, response, err := s.post(body)
+	if nil != err {
+		return err
+	}
+
+	if statusCode >= http.StatusBadRequest {
+		return fmt.Errorf("Slack web hook returned %d: %s", statusCode, response)
+	}
+
+	logutil.Debug("Sent Slack message", "status", statusCode)
+	return nil
+}
+
+// Check validates the web hook url. Slack has no way to check an incoming web hook exists
+// without posting to its channel, so nothing is sent.
+func (s *slack) Check() error {
+	u, err := url.Parse(s.webHookUrl)
+	if nil != err {
+		return err
+	}
+
+	if ("https" != u.Scheme && "http" != u.Scheme) || "" == u.Host {
+		return fmt.Errorf("Slack web hook url must be an absolute http or https url: %s", s.webHookUrl)
+	}
+
+	return nil
+}
+
+// post sends the body to the web hook, returning the status code and response text
+func (s *slack) post(body []byte) (int, string, error) {
+	request, err := http.NewRequest(http.MethodPost, s.webHookUrl, bytes.NewReader(body))
+	if nil != err {
+		return 0, "", err
+	}
+
+	request.Header.Set(httputil.HttpContentTypeHeader, httputil.JsonContentType)
+	request.Header.Set(httputil.HttpUserAgentHeader, s.userAgent)
+
+	resp, err := requests.Do(s.httpClient, request)
+	if nil != err {
+		return 0, "", err
+	}
+
+	defer resp.Body.Close()
+
+	response, err := ioutil.ReadAll(resp.Body)
+	if nil != err {
+		return 0, "", err
+	}
+
+	return resp.StatusCode, strings.TrimSpace(string(response)), nil
+}
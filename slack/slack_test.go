@@ -0,0 +1,190 @@
+package slack_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/notifier"
+	"github.com/mbolt35/multi-twitch-discord-bot/slack"
+)
+
+// webHookServer is a stand-in incoming web hook, recording the bodies posted to it
+type webHookServer struct {
+	*httptest.Server
+	lock   sync.Mutex
+	bodies []string
+	status int
+}
+
+// newWebHookServer starts a web hook which responds with the status code
+func newWebHookServer(status int) *webHookServer {
+	instance := &webHookServer{status: status}
+	instance.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+
+		instance.lock.Lock()
+		instance.bodies = append(instance.bodies, string(body))
+		status := instance.status
+		instance.lock.Unlock()
+
+		rw.WriteHeader(status)
+		rw.Write([]byte("ok"))
+	}))
+
+	return instance
+}
+
+// Respond changes the status code the web hook responds with
+func (s *webHookServer) Respond(status int) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.status = status
+}
+
+// Bodies returns the bodies posted so far
+func (s *webHookServer) Bodies() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string{}, s.bodies...)
+}
+
+// blockTypes returns the type of each of the message's blocks
+func blockTypes(message slack.Message) []string {
+	types := []string{}
+	for _, block := range message.Blocks {
+		types = append(types, block.Type)
+	}
+
+	return types
+}
+
+func TestNewMessage(t *testing.T) {
+	event := notifier.Event{
+		DisplayName:  "A<B",
+		Title:        "Tips & tricks",
+		GameId:       "509658",
+		GameName:     "Just Chatting",
+		ThumbnailUrl: "https://static-cdn.jtvnw.net/previews-ttv/live_user_ab-{width}x{height}.jpg",
+		Url:          "http://twitch.tv/ab",
+	}
+
+	message := slack.NewMessage("A<B is now live!", event)
+	if "A<B is now live!" != message.Text {
+		t.Errorf("expected the rendered template as the text, got %q", message.Text)
+	}
+
+	types := blockTypes(message)
+	if 4 != len(types) || "section" != types[0] || "image" != types[1] || "context" != types[2] || "actions" != types[3] {
+		t.Fatalf("got blocks %v", types)
+	}
+
+	if "*<http://twitch.tv/ab|A&lt;B>* is now live!\nTips &amp; tricks" != message.Blocks[0].Text.Text {
+		t.Errorf("got headline %q", message.Blocks[0].Text.Text)
+	}
+
+	if "https://static-cdn.jtvnw.net/previews-ttv/live_user_ab-1280x720.jpg" != message.Blocks[1].ImageUrl {
+		t.Errorf("got image %q", message.Blocks[1].ImageUrl)
+	}
+
+	if "Playing Just Chatting" != message.Blocks[2].Elements[0].ContextText {
+		t.Errorf("expected the game's name, got %q", message.Blocks[2].Elements[0].ContextText)
+	}
+
+	if event.Url != message.Blocks[3].Elements[0].Url {
+		t.Errorf("expected the button to link to the stream, got %q", message.Blocks[3].Elements[0].Url)
+	}
+}
+
+func TestNewMessageFallsBackToTheGameId(t *testing.T) {
+	message := slack.NewMessage("live", notifier.Event{GameId: "509658", Url: "http://twitch.tv/ab"})
+
+	types := blockTypes(message)
+	if 3 != len(types) || "context" != types[1] {
+		t.Fatalf("got blocks %v", types)
+	}
+
+	if "Playing 509658" != message.Blocks[1].Elements[0].ContextText {
+		t.Errorf("expected the game's id, got %q", message.Blocks[1].Elements[0].ContextText)
+	}
+
+	// Without a game, thumbnail or title there's only the headline and button
+	if types := blockTypes(slack.NewMessage("live", notifier.Event{})); 2 != len(types) {
+		t.Fatalf("got blocks %v", types)
+	}
+}
+
+func TestPayload(t *testing.T) {
+	client := slack.NewSlack("https://hooks.slack.com/services/T000/B000/secret", slack.DefaultOptions)
+
+	payload, err := client.Payload("live", notifier.Event{GameName: "Chess", Url: "http://twitch.tv/ab"})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(payload, &decoded); nil != err {
+		t.Fatal(err)
+	}
+
+	// Context elements are plain text objects
+	blocks := decoded["blocks"].([]interface{})
+	context := blocks[1].(map[string]interface{})["elements"].([]interface{})[0].(map[string]interface{})
+	if "mrkdwn" != context["type"] || "Playing Chess" != context["text"] || 2 != len(context) {
+		t.Fatalf("got context element %v", context)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	client := slack.NewSlack("https://hooks.slack.com/services/T000/B000/secret", slack.DefaultOptions)
+
+	// Only Slack's markup is escaped, not discord's markdown
+	if escaped := client.(notifier.Escaper).Escape("A_<B> & *C*"); "A_&lt;B&gt; &amp; *C*" != escaped {
+		t.Fatalf("got %q", escaped)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	server := newWebHookServer(http.StatusOK)
+	defer server.Close()
+
+	client := slack.NewSlack(server.URL, slack.DefaultOptions)
+	event := notifier.Event{GameName: "Chess", Url: "http://twitch.tv/ab"}
+	if err := client.Notify("live", event); nil != err {
+		t.Fatal(err)
+	}
+
+	payload, _ := client.Payload("live", event)
+	if bodies := server.Bodies(); 1 != len(bodies) || string(payload) != bodies[0] {
+		t.Fatalf("expected the payload to be posted, got %v", bodies)
+	}
+
+	server.Respond(http.StatusNotFound)
+	if err := client.Notify("live", event); nil == err {
+		t.Fatal("expected a refused message to fail")
+	}
+}
+
+func TestCheckDoesntPost(t *testing.T) {
+	server := newWebHookServer(http.StatusOK)
+	defer server.Close()
+
+	if err := slack.NewSlack(server.URL, slack.DefaultOptions).Check(); nil != err {
+		t.Fatal(err)
+	}
+
+	if bodies := server.Bodies(); 0 != len(bodies) {
+		t.Fatalf("expected nothing to be posted, got %v", bodies)
+	}
+
+	for _, webHookUrl := range []string{"/relative", "ftp://hooks.slack.com/services", "https://", "%"} {
+		if err := slack.NewSlack(webHookUrl, slack.DefaultOptions).Check(); nil == err {
+			t.Errorf("%q: expected the url to be rejected", webHookUrl)
+		}
+	}
+}
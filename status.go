@@ -0,0 +1,342 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+const (
+	// StatusEndPoint serves the human readable status page
+	StatusEndPoint string = "status"
+
+	// SubscriptionsEndPoint serves the state of every subscription as JSON
+	SubscriptionsEndPoint string = "subscriptions"
+
+	// RecentErrorLimit is the number of recent errors shown on the status page
+	RecentErrorLimit int = 20
+
+	// StreamLive is shown for streamers who are live
+	StreamLive string = "live"
+
+	// StreamOffline is shown for streamers who have gone offline
+	StreamOffline string = "offline"
+
+	// StreamUnknown is shown for streamers the bot hasn't been notified about since starting
+	StreamUnknown string = "unknown"
+)
+
+// streamStatus is the last known state of a streamer's stream
+type streamStatus struct {
+	State     string
+	Title     string
+	GameId    string
+	UpdatedAt time.Time
+}
+
+// deliveryStatus is the result of the last announcement sent to a destination
+type deliveryStatus struct {
+	Destination string
+	SentAt      time.Time
+	Error       string
+}
+
+// recentError is an error or warning shown on the status page
+type recentError struct {
+	Time    time.Time
+	Level   string
+	Message string
+	Error   string
+}
+
+// statusTracker remembers what the status page shows which isn't kept anywhere else
+type statusTracker struct {
+	lock       sync.RWMutex
+	streams    map[string]streamStatus
+	deliveries map[string]map[string]deliveryStatus
+	errors     []recentError
+}
+
+// newStatusTracker creates an empty statusTracker
+func newStatusTracker() *statusTracker {
+	instance := statusTracker{
+		streams:    make(map[string]streamStatus),
+		deliveries: make(map[string]map[string]deliveryStatus),
+	}
+
+	return &instance
+}
+
+// status tracks the state shown on the status page
+var status = newStatusTracker()
+
+// RecordLive records a notification that the user's stream is live
+func (s *statusTracker) RecordLive(notification *twitch.TwitchNotification) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.streams[notification.UserId] = streamStatus{
+		State:     StreamLive,
+		Title:     notification.Title,
+		GameId:    notification.GameId,
+		UpdatedAt: time.Now(),
+	}
+}
+
+// RecordOffline records a notification that the user's stream has ended
+func (s *statusTracker) RecordOffline(userId string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.streams[userId] = streamStatus{
+		State:     StreamOffline,
+		UpdatedAt: time.Now(),
+	}
+}
+
+// RecordDelivery records the result of sending the user's announcement to the destination
+func (s *statusTracker) RecordDelivery(userId string, destination string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.deliveries[userId]; !ok {
+		s.deliveries[userId] = make(map[string]deliveryStatus)
+	}
+
+	delivery := deliveryStatus{
+		Destination: destination,
+		SentAt:      time.Now(),
+	}
+
+	if nil != err {
+		delivery.Error = logutil.Scrub(err.Error())
+	}
+
+	s.deliveries[userId][destination] = delivery
+}
+
+// LastDelivery returns the result of the most recent announcement sent to the destination,
+// for any streamer
+func (s *statusTracker) LastDelivery(destination string) (deliveryStatus, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	last, found := deliveryStatus{}, false
+	for _, destinations := range s.deliveries {
+		delivery, ok := destinations[destination]
+		if ok && (!found || delivery.SentAt.After(last.SentAt)) {
+			last, found = delivery, true
+		}
+	}
+
+	return last, found
+}
+
+// RecordError remembers a logged warning or error, keeping only the most recent
+func (s *statusTracker) RecordError(entry logutil.Entry) {
+	recent := recentError{
+		Time:    entry.Time,
+		Level:   entry.Level.String(),
+		Message: entry.Message,
+	}
+
+	switch err := entry.Field(logutil.ErrorKey).(type) {
+	case error:
+		recent.Error = logutil.Scrub(err.Error())
+	case string:
+		recent.Error = logutil.Scrub(err)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.errors = append(s.errors, recent)
+	if len(s.errors) > RecentErrorLimit {
+		s.errors = s.errors[len(s.errors)-RecentErrorLimit:]
+	}
+}
+
+// streamerView is a single row of the status page
+type streamerView struct {
+	Login        string
+	DisplayName  string
+	UserId       string
+	Stream       streamStatus
+	LastLive     time.Time
+	Subscription twitch.Subscription
+	Subscribed   bool
+	Deliveries   []deliveryStatus
+}
+
+// statusView is everything shown on the status page
+type statusView struct {
+	GeneratedAt time.Time
+	Streamers   []streamerView
+	Errors      []recentError
+}
+
+// view gathers the current state of every streamer being announced
+func (s *statusTracker) view(announcer *Announcer) statusView {
+	result := statusView{
+		GeneratedAt: time.Now(),
+	}
+
+	// Copy what's tracked, so storage isn't queried with the lock held. Anything logged
+	// while querying it would otherwise deadlock when recorded.
+	s.lock.RLock()
+	streams := make(map[string]streamStatus)
+	for userId, stream := range s.streams {
+		streams[userId] = stream
+	}
+
+	deliveries := make(map[string][]deliveryStatus)
+	for userId, destinations := range s.deliveries {
+		for _, delivery := range destinations {
+			deliveries[userId] = append(deliveries[userId], delivery)
+		}
+	}
+
+	// Most recent first
+	for i := len(s.errors) - 1; i >= 0; i-- {
+		result.Errors = append(result.Errors, s.errors[i])
+	}
+	s.lock.RUnlock()
+
+	for _, user := range announcer.Users() {
+		streamer := streamerView{
+			Login:       user.UserName,
+			DisplayName: user.DisplayName,
+			UserId:      user.UserId,
+			Stream:      streamStatus{State: StreamUnknown},
+		}
+
+		if stream, ok := streams[user.UserId]; ok {
+			streamer.Stream = stream
+		}
+
+		if lastLive, err := liveStartTimes.Get(user.UserId); nil == err {
+			streamer.LastLive = lastLive
+		}
+
+		streamer.Subscription, streamer.Subscribed = twitchClient.Subscriptions().Get(user.UserId)
+
+		streamer.Deliveries = deliveries[user.UserId]
+		sort.Slice(streamer.Deliveries, func(i, j int) bool {
+			return streamer.Deliveries[i].Destination < streamer.Deliveries[j].Destination
+		})
+
+		result.Streamers = append(result.Streamers, streamer)
+	}
+
+	sort.Slice(result.Streamers, func(i, j int) bool {
+		return strings.ToLower(result.Streamers[i].Login) < strings.ToLower(result.Streamers[j].Login)
+	})
+
+	return result
+}
+
+// formatTime formats a time for the status page, or a dash for the zero time
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.UTC().Format("2006-01-02 15:04:05 MST")
+}
+
+var statusTemplate = template.Must(template.New(StatusEndPoint).Funcs(template.FuncMap{
+	"time": formatTime,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="60">
+<title>Bot Status</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { text-align: left; padding: 0.4em 0.8em; border-bottom: 1px solid #ddd; vertical-align: top; }
+.live, .verified, .sent { color: #1a7f37; font-weight: bold; }
+.offline, .unknown, .pending, .unsubscribing { color: #6e7781; }
+.denied, .failed, .expired, .error { color: #cf222e; font-weight: bold; }
+</style>
+</head>
+<body>
+<h1>Bot Status</h1>
+<p>Updated {{time .GeneratedAt}}. This page refreshes every minute.</p>
+
+<h2>Streamers</h2>
+<table>
+<tr><th>Streamer</th><th>Stream</th><th>Last Went Live</th><th>Subscription</th><th>Lease Expires</th><th>Last Announcement</th></tr>
+{{range .Streamers}}
+<tr>
+<td>{{.DisplayName}}<br><small>{{.Login}} ({{.UserId}})</small></td>
+<td><span class="{{.Stream.State}}">{{.Stream.State}}</span>{{if .Stream.Title}}<br><small>{{.Stream.Title}}</small>{{end}}</td>
+<td>{{time .LastLive}}</td>
+{{if .Subscribed}}
+<td><span class="{{.Subscription.State}}">{{.Subscription.State}}</span>{{if .Subscription.Reason}}<br><small>{{.Subscription.Reason}}</small>{{end}}</td>
+<td>{{time .Subscription.ExpiresAt}}</td>
+{{else}}
+<td><span class="unknown">not subscribed</span></td>
+<td>-</td>
+{{end}}
+<td>{{range .Deliveries}}{{.Destination}}: {{if .Error}}<span class="error">failed</span> {{time .SentAt}}<br><small>{{.Error}}</small>{{else}}<span class="sent">sent</span> {{time .SentAt}}{{end}}<br>{{else}}-{{end}}</td>
+</tr>
+{{end}}
+</table>
+
+<h2>Recent Errors</h2>
+{{if .Errors}}
+<table>
+<tr><th>Time</th><th>Level</th><th>Message</th></tr>
+{{range .Errors}}
+<tr><td>{{time .Time}}</td><td>{{.Level}}</td><td>{{.Message}}{{if .Error}}<br><small>{{.Error}}</small>{{end}}</td></tr>
+{{end}}
+</table>
+{{else}}
+<p>No errors since the bot started.</p>
+{{end}}
+</body>
+</html>
+`))
+
+// OnStatus serves the read-only status page
+func OnStatus(rw http.ResponseWriter, request *http.Request) {
+	if http.MethodGet != request.Method && http.MethodHead != request.Method {
+		rw.Header().Set("Allow", "GET, HEAD")
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+	err := statusTemplate.Execute(rw, status.view(currentAnnouncer()))
+	if nil != err {
+		logutil.Error("Failed to render status page", logutil.ErrorKey, err)
+	}
+}
+
+// OnSubscriptions serves the state of every subscription as JSON
+func OnSubscriptions(rw http.ResponseWriter, request *http.Request) {
+	if http.MethodGet != request.Method && http.MethodHead != request.Method {
+		rw.Header().Set("Allow", "GET, HEAD")
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	jsonBytes, err := httputil.EncodeJson(twitchClient.Subscriptions().All())
+	if nil != err {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set(httputil.HttpContentTypeHeader, httputil.JsonContentType)
+	rw.Write(jsonBytes)
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+// get requests the end point, returning the status code and body
+func get(t *testing.T, bot *testBot, endPoint string) (int, string) {
+	resp, err := http.Get(bot.server.URL + "/" + endPoint)
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return resp.StatusCode, string(body)
+}
+
+func TestStatusTrackerKeepsRecentErrors(t *testing.T) {
+	tracker := newStatusTracker()
+
+	for i := 0; i < RecentErrorLimit+5; i++ {
+		tracker.RecordError(logutil.Entry{
+			Time:    time.Now(),
+			Level:   logutil.LevelError,
+			Message: fmt.Sprintf("error %d", i),
+			Fields:  []interface{}{logutil.ErrorKey, errors.New("Post https://discord.com/api/webhooks/1/secret-token: timeout")},
+		})
+	}
+
+	if RecentErrorLimit != len(tracker.errors) {
+		t.Fatalf("expected %d errors, got %d", RecentErrorLimit, len(tracker.errors))
+	}
+
+	if "error 5" != tracker.errors[0].Message {
+		t.Fatalf("expected the oldest errors to be dropped, got %q", tracker.errors[0].Message)
+	}
+
+	if strings.Contains(tracker.errors[0].Error, "secret-token") {
+		t.Fatalf("expected the web hook token to be scrubbed, got %q", tracker.errors[0].Error)
+	}
+}
+
+func TestStatusPage(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	code, body := get(t, bot, StatusEndPoint)
+	if http.StatusOK != code || !strings.Contains(body, StreamUnknown) || !strings.Contains(body, "No errors since the bot started.") {
+		t.Fatalf("got %d:\n%s", code, body)
+	}
+
+	liveStartTimes.Set("42", "2020-01-01T00:00:00Z")
+	status.RecordLive(&twitch.TwitchNotification{UserId: "42", Title: "<script>alert(1)</script>"})
+	status.RecordDelivery("42", "default", errors.New("Post https://discord.com/api/webhooks/1/secret-token: timeout"))
+	status.RecordError(logutil.Entry{Time: time.Now(), Level: logutil.LevelWarn, Message: "Something went wrong"})
+
+	code, body = get(t, bot, StatusEndPoint)
+	if http.StatusOK != code {
+		t.Fatalf("got %d", code)
+	}
+
+	expected := []string{
+		`<span class="live">live</span>`,
+		`&lt;script&gt;alert(1)&lt;/script&gt;`,
+		`2020-01-01 00:00:00 UTC`,
+		`<span class="verified">verified</span>`,
+		`default: <span class="error">failed</span>`,
+		`Something went wrong`,
+	}
+
+	for _, text := range expected {
+		if !strings.Contains(body, text) {
+			t.Errorf("expected the page to contain %q:\n%s", text, body)
+		}
+	}
+
+	if strings.Contains(body, "<script>") || strings.Contains(body, "secret-token") {
+		t.Errorf("expected the page to be escaped and scrubbed:\n%s", body)
+	}
+}
+
+func TestStatusPageIsReadOnly(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	for _, endPoint := range []string{StatusEndPoint, SubscriptionsEndPoint} {
+		resp, err := http.Post(bot.server.URL+"/"+endPoint, "text/plain", nil)
+		if nil != err {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+
+		if http.StatusMethodNotAllowed != resp.StatusCode || "GET, HEAD" != resp.Header.Get("Allow") {
+			t.Errorf("%s: got %d, Allow: %q", endPoint, resp.StatusCode, resp.Header.Get("Allow"))
+		}
+	}
+}
+
+func TestSubscriptionsEndPoint(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	code, body := get(t, bot, SubscriptionsEndPoint)
+	if http.StatusOK != code {
+		t.Fatalf("got %d", code)
+	}
+
+	var subscriptions []twitch.Subscription
+	if err := json.Unmarshal([]byte(body), &subscriptions); nil != err {
+		t.Fatal(err)
+	}
+
+	if 1 != len(subscriptions) || "42" != subscriptions[0].UserId || twitch.SubscriptionVerified != subscriptions[0].State {
+		t.Fatalf("got %+v", subscriptions)
+	}
+}
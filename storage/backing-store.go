@@ -1,9 +1,134 @@
 package storage
 
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+// SqliteScheme is the DATABASE_URL scheme which selects the SQLite store
+const SqliteScheme string = "sqlite:"
+
+var (
+	// ErrNotFound is returned when a key does not exist in the store, or has expired
+	ErrNotFound = errors.New("storage: key not found")
+
+	// ErrNotInitialized is returned when a store is used before Init succeeds
+	ErrNotInitialized = errors.New("storage: store is not initialized")
+)
+
 // BackingStore implementation prototype for an object capable of retrieving and
 // storing strings
 type BackingStore interface {
+	// Init prepares the store for use, and must be called before any other method
 	Init() error
+
+	// Ping verifies the store is reachable and usable, for health checks
+	Ping() error
+
+	// Get returns the value for the key, or ErrNotFound if no live entry exists
 	Get(key string) (string, error)
+
+	// Set stores the value for the key without an expiry
 	Set(key string, value string) error
+
+	// SetWithTTL stores the value for the key, expiring it after the ttl has elapsed.
+	// A ttl of zero or less never expires.
+	SetWithTTL(key string, value string, ttl time.Duration) error
+
+	// Delete removes the key. Deleting a key which does not exist is not an error.
+	Delete(key string) error
+
+	// List returns every live key and value where the key starts with the prefix
+	List(prefix string) (map[string]string, error)
+
+	// CompareAndSwap atomically replaces the value for an existing key with next only if
+	// the current value equals previous, returning true if the swap occurred. Any expiry
+	// on the key is preserved.
+	CompareAndSwap(key string, previous string, next string) (bool, error)
+
+	// SetIfAbsent atomically stores the value for the key with the provided ttl only if no
+	// live entry exists, returning true if the value was stored
+	SetIfAbsent(key string, value string, ttl time.Duration) (bool, error)
+
+	// SetIfChanged atomically stores the value for the key without an expiry unless the
+	// key already holds an equal value, returning true if the value was stored
+	SetIfChanged(key string, value string) (bool, error)
+}
+
+// ExpiringGetter is implemented by stores which can report when a key expires, so copies
+// of its value are never kept beyond the key's lifetime
+type ExpiringGetter interface {
+	// GetWithExpiry returns the value for the key and when it expires, which is the zero time
+	// if it never does, or ErrNotFound if no live entry exists
+	GetWithExpiry(key string) (string, time.Time, error)
+}
+
+// expiryFor returns the absolute expiration time for a ttl relative to now, or the zero
+// time if the ttl never expires
+func expiryFor(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+
+	return now.Add(ttl)
+}
+
+// isExpired determines whether an absolute expiration time has passed
+func isExpired(now time.Time, expires time.Time) bool {
+	return !expires.IsZero() && !now.Before(expires)
+}
+
+// escapeLikePattern escapes the wildcard characters in a SQL LIKE pattern
+func escapeLikePattern(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return replacer.Replace(s)
+}
+
+// DatabasePath returns the file path from a file based DATABASE_URL such as sqlite:// or
+// file://. Both absolute (sqlite:///var/lib/bot.db) and relative (sqlite://bot.db) paths
+// are supported.
+func DatabasePath(databaseUrl string) (string, error) {
+	u, err := url.Parse(databaseUrl)
+	if nil != err {
+		return "", err
+	}
+
+	if "" != u.Opaque {
+		return u.Opaque, nil
+	}
+
+	return u.Host + u.Path, nil
+}
+
+// InitWithRetry initializes the store, retrying failures with exponential backoff starting
+// at the initial delay and capped at the maximum delay. The last error is returned if every
+// attempt fails.
+func InitWithRetry(backingStore BackingStore, attempts int, initialDelay time.Duration, maxDelay time.Duration) error {
+	delay := initialDelay
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = backingStore.Init()
+		if nil == err {
+			return nil
+		}
+
+		if attempt == attempts {
+			break
+		}
+
+		logutil.Warn("Storage initialization failed, retrying", "attempt", attempt, "attempts", attempts, "delay", delay, logutil.ErrorKey, err)
+		time.Sleep(delay)
+
+		delay *= 2
+		if delay > maxDelay {
+			delay = maxDelay
+		}
+	}
+
+	return err
 }
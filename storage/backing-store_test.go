@@ -0,0 +1,52 @@
+package storage_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/storage"
+)
+
+// tempDirs creates temporary directories for the stores of a test, removing them all once
+// the test is over
+type tempDirs struct {
+	dirs []string
+}
+
+// path returns a path to the file in a new temporary directory
+func (d *tempDirs) path(t *testing.T, name string) string {
+	dir, err := ioutil.TempDir("", "storage-test")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	d.dirs = append(d.dirs, dir)
+	return filepath.Join(dir, name)
+}
+
+// remove removes every directory created
+func (d *tempDirs) remove() {
+	for _, dir := range d.dirs {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDatabasePath(t *testing.T) {
+	cases := map[string]string{
+		"sqlite:///var/lib/bot.db":        "/var/lib/bot.db",
+		"sqlite://bot.db":                 "bot.db",
+		"sqlite:bot.db":                   "bot.db",
+		"sqlite:///tmp/x.db?cache=shared": "/tmp/x.db",
+		"file:///var/lib/bot.json":        "/var/lib/bot.json",
+		"file://data/bot.json":            "data/bot.json",
+	}
+
+	for databaseUrl, expected := range cases {
+		path, err := storage.DatabasePath(databaseUrl)
+		if nil != err || expected != path {
+			t.Errorf("DatabasePath(%q) = %q, %v, expected %q", databaseUrl, path, err, expected)
+		}
+	}
+}
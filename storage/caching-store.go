@@ -0,0 +1,352 @@
+package storage
+
+import (
+	"container/list"
+	"io"
+	"sync"
+	"time"
+
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+const (
+	// DefaultCacheSize is the default number of keys held by a CachingBackingStore
+	DefaultCacheSize int = 1000
+
+	// DefaultCacheMaxAge bounds how long a value is cached, even if its key never expires
+	DefaultCacheMaxAge time.Duration = 5 * time.Minute
+)
+
+// CacheInvalidator broadcasts key invalidations between processes sharing a backing store,
+// keeping each process's cache coherent
+type CacheInvalidator interface {
+	// Start begins receiving invalidations from other processes. Invalidate is called with
+	// each changed key, and reset is called when invalidations may have been missed.
+	Start(invalidate func(key string), reset func()) error
+
+	// Publish notifies other processes that the key has changed
+	Publish(key string) error
+
+	// Close stops receiving invalidations and releases the invalidator's connections
+	Close() error
+}
+
+// cacheEntry is a single cached value
+type cacheEntry struct {
+	key     string
+	value   string
+	expires time.Time
+}
+
+// cacheFill tracks the reads of a key which missed the cache and are in progress. Its
+// generation is bumped whenever the key changes, so a read which started before the change
+// doesn't cache a stale value.
+type cacheFill struct {
+	generation uint64
+	readers    int
+}
+
+// CachingBackingStore is a BackingStore decorator which keeps recently used values in an
+// in-process LRU cache. Writes go through to the backing store before updating the cache,
+// and the atomic operations are always performed by the backing store.
+type CachingBackingStore struct {
+	backingStore BackingStore
+	invalidator  CacheInvalidator
+	capacity     int
+	maxAge       time.Duration
+	lock         sync.Mutex
+	entries      map[string]*list.Element
+	order        *list.List
+	fills        map[string]*cacheFill
+}
+
+// Ensure we correctly implement BackingStore
+var _ BackingStore = &CachingBackingStore{}
+
+// NewCachingStore wraps the backing store with an LRU cache holding up to capacity keys. The
+// invalidator may be nil when only a single process uses the backing store.
+func NewCachingStore(backingStore BackingStore, capacity int, invalidator CacheInvalidator) BackingStore {
+	instance := CachingBackingStore{
+		backingStore: backingStore,
+		invalidator:  invalidator,
+		capacity:     capacity,
+		maxAge:       DefaultCacheMaxAge,
+		entries:      make(map[string]*list.Element),
+		order:        list.New(),
+		fills:        make(map[string]*cacheFill),
+	}
+
+	return &instance
+}
+
+func (p *CachingBackingStore) Init() error {
+	err := p.backingStore.Init()
+	if nil != err {
+		return err
+	}
+
+	if nil == p.invalidator {
+		return nil
+	}
+
+	return p.invalidator.Start(p.evict, p.reset)
+}
+
+// Close stops the invalidator, then closes the backing store if it has anything to close
+func (p *CachingBackingStore) Close() error {
+	var err error
+	if nil != p.invalidator {
+		err = p.invalidator.Close()
+	}
+
+	if closer, ok := p.backingStore.(io.Closer); ok {
+		if closeErr := closer.Close(); nil == err {
+			err = closeErr
+		}
+	}
+
+	return err
+}
+
+// lookup returns the cached value for the key, if present and not expired
+func (p *CachingBackingStore) lookup(key string) (string, bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	element, ok := p.entries[key]
+	if !ok {
+		return "", false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if isExpired(time.Now(), entry.expires) {
+		p.order.Remove(element)
+		delete(p.entries, key)
+		return "", false
+	}
+
+	p.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// store caches the value for the key, evicting the least recently used key if full
+func (p *CachingBackingStore) store(key string, value string, expires time.Time) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.changedLocked(key)
+	p.insertLocked(key, value, expires)
+}
+
+// insertLocked caches the value for the key while the lock is held
+func (p *CachingBackingStore) insertLocked(key string, value string, expires time.Time) {
+	if element, ok := p.entries[key]; ok {
+		entry := element.Value.(*cacheEntry)
+		entry.value = value
+		entry.expires = expires
+		p.order.MoveToFront(element)
+		return
+	}
+
+	p.entries[key] = p.order.PushFront(&cacheEntry{
+		key:     key,
+		value:   value,
+		expires: expires,
+	})
+
+	for p.order.Len() > p.capacity {
+		oldest := p.order.Back()
+		p.order.Remove(oldest)
+		delete(p.entries, oldest.Value.(*cacheEntry).key)
+	}
+}
+
+// cacheExpiry returns the time a value written with the ttl stops being cached
+func (p *CachingBackingStore) cacheExpiry(ttl time.Duration) time.Time {
+	return p.cacheDeadline(expiryFor(time.Now(), ttl))
+}
+
+// cacheDeadline returns the time a value whose key expires at the time stops being cached,
+// which is the earlier of the key's expiry and the cache's maximum age
+func (p *CachingBackingStore) cacheDeadline(expires time.Time) time.Time {
+	deadline := time.Now().Add(p.maxAge)
+	if !expires.IsZero() && expires.Before(deadline) {
+		return expires
+	}
+
+	return deadline
+}
+
+// changedLocked bumps the generation of any read of the key in progress while the lock
+// is held
+func (p *CachingBackingStore) changedLocked(key string) {
+	if fill, ok := p.fills[key]; ok {
+		fill.generation++
+	}
+}
+
+// beginFill records a read of the key which missed the cache, returning its generation
+func (p *CachingBackingStore) beginFill(key string) uint64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	fill, ok := p.fills[key]
+	if !ok {
+		fill = &cacheFill{}
+		p.fills[key] = fill
+	}
+
+	fill.readers++
+	return fill.generation
+}
+
+// endFill completes a read of the key which missed the cache, caching the value read if
+// the key hasn't changed since the read began
+func (p *CachingBackingStore) endFill(key string, generation uint64, value string, expires time.Time, cache bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	fill := p.fills[key]
+	fill.readers--
+	if 0 == fill.readers {
+		delete(p.fills, key)
+	}
+
+	if cache && generation == fill.generation {
+		p.insertLocked(key, value, expires)
+	}
+}
+
+// evict removes the key from the cache
+func (p *CachingBackingStore) evict(key string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.changedLocked(key)
+	if element, ok := p.entries[key]; ok {
+		p.order.Remove(element)
+		delete(p.entries, key)
+	}
+}
+
+// reset removes every key from the cache
+func (p *CachingBackingStore) reset() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.entries = make(map[string]*list.Element)
+	p.order.Init()
+
+	for _, fill := range p.fills {
+		fill.generation++
+	}
+}
+
+// changed updates the cache after a successful write, and notifies other processes
+func (p *CachingBackingStore) changed(key string, value string, ttl time.Duration) {
+	p.store(key, value, p.cacheExpiry(ttl))
+	p.publish(key)
+}
+
+// publish notifies other processes that the key has changed
+func (p *CachingBackingStore) publish(key string) {
+	if nil == p.invalidator {
+		return
+	}
+
+	if err := p.invalidator.Publish(key); nil != err {
+		logutil.Error("Failed to publish cache invalidation", "key", key, logutil.ErrorKey, err)
+	}
+}
+
+func (p *CachingBackingStore) Ping() error {
+	return p.backingStore.Ping()
+}
+
+func (p *CachingBackingStore) Get(key string) (string, error) {
+	if value, ok := p.lookup(key); ok {
+		return value, nil
+	}
+
+	// Values are only cached when the backing store can say when their key expires
+	getter, ok := p.backingStore.(ExpiringGetter)
+	if !ok {
+		return p.backingStore.Get(key)
+	}
+
+	generation := p.beginFill(key)
+	value, expires, err := getter.GetWithExpiry(key)
+	p.endFill(key, generation, value, p.cacheDeadline(expires), nil == err)
+
+	return value, err
+}
+
+func (p *CachingBackingStore) Set(key string, value string) error {
+	return p.SetWithTTL(key, value, 0)
+}
+
+func (p *CachingBackingStore) SetWithTTL(key string, value string, ttl time.Duration) error {
+	err := p.backingStore.SetWithTTL(key, value, ttl)
+	if nil != err {
+		p.evict(key)
+		return err
+	}
+
+	p.changed(key, value, ttl)
+	return nil
+}
+
+func (p *CachingBackingStore) Delete(key string) error {
+	err := p.backingStore.Delete(key)
+	p.evict(key)
+
+	if nil == err {
+		p.publish(key)
+	}
+
+	return err
+}
+
+func (p *CachingBackingStore) List(prefix string) (map[string]string, error) {
+	return p.backingStore.List(prefix)
+}
+
+func (p *CachingBackingStore) CompareAndSwap(key string, previous string, next string) (bool, error) {
+	swapped, err := p.backingStore.CompareAndSwap(key, previous, next)
+	if !swapped {
+		p.evict(key)
+		return swapped, err
+	}
+
+	// The remaining expiry of the key isn't known, so it is evicted rather than cached
+	p.evict(key)
+	p.publish(key)
+	return swapped, err
+}
+
+func (p *CachingBackingStore) SetIfAbsent(key string, value string, ttl time.Duration) (bool, error) {
+	stored, err := p.backingStore.SetIfAbsent(key, value, ttl)
+	if !stored {
+		p.evict(key)
+		return stored, err
+	}
+
+	p.changed(key, value, ttl)
+	return stored, err
+}
+
+func (p *CachingBackingStore) SetIfChanged(key string, value string) (bool, error) {
+	changed, err := p.backingStore.SetIfChanged(key, value)
+	if nil != err {
+		p.evict(key)
+		return changed, err
+	}
+
+	// Whether or not the value changed, the backing store now holds the value
+	p.store(key, value, p.cacheExpiry(0))
+	if changed {
+		p.publish(key)
+	}
+
+	return changed, err
+}
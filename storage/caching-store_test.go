@@ -0,0 +1,318 @@
+package storage_test
+
+import (
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/storage"
+	"github.com/mbolt35/multi-twitch-discord-bot/storage/storagetest"
+)
+
+// countingStore counts the reads which reach the backing store
+type countingStore struct {
+	storage.BackingStore
+	gets int
+}
+
+func (c *countingStore) Get(key string) (string, error) {
+	c.gets++
+	return c.BackingStore.Get(key)
+}
+
+func (c *countingStore) GetWithExpiry(key string) (string, time.Time, error) {
+	c.gets++
+	return c.BackingStore.(storage.ExpiringGetter).GetWithExpiry(key)
+}
+
+// plainStore hides every method but those of storage.BackingStore
+type plainStore struct {
+	storage.BackingStore
+}
+
+// recordingInvalidator records the keys published, and keeps the callbacks it's started with
+type recordingInvalidator struct {
+	closed     bool
+	published  []string
+	invalidate func(key string)
+	reset      func()
+}
+
+func (r *recordingInvalidator) Start(invalidate func(key string), reset func()) error {
+	r.invalidate = invalidate
+	r.reset = reset
+	return nil
+}
+
+func (r *recordingInvalidator) Publish(key string) error {
+	r.published = append(r.published, key)
+	return nil
+}
+
+func (r *recordingInvalidator) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestCachingStoreConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.BackingStore {
+		store := storage.NewCachingStore(storage.NewMemoryStore(), 3, nil)
+		if err := store.Init(); nil != err {
+			t.Fatal(err)
+		}
+
+		return store
+	})
+}
+
+func newCountingCache(t *testing.T, capacity int, invalidator storage.CacheInvalidator) (*countingStore, storage.BackingStore) {
+	backing := &countingStore{BackingStore: storage.NewMemoryStore()}
+	cache := storage.NewCachingStore(backing, capacity, invalidator)
+	if err := cache.Init(); nil != err {
+		t.Fatal(err)
+	}
+
+	return backing, cache
+}
+
+func TestCachingStoreServesReadsFromCache(t *testing.T) {
+	backing, cache := newCountingCache(t, 10, nil)
+	backing.Set("key", "value")
+
+	for i := 0; i < 3; i++ {
+		if value, err := cache.Get("key"); nil != err || "value" != value {
+			t.Fatalf("unexpected get %q, %v", value, err)
+		}
+	}
+
+	if 1 != backing.gets {
+		t.Fatalf("expected a single backing read, got %d", backing.gets)
+	}
+}
+
+func TestCachingStoreHonoursBackingExpiryOnRead(t *testing.T) {
+	backing, cache := newCountingCache(t, 10, nil)
+
+	// Written around the cache, so the cache only learns the expiry when reading the key
+	backing.SetWithTTL("dedup", "1", 50*time.Millisecond)
+	if value, err := cache.Get("dedup"); nil != err || "1" != value {
+		t.Fatalf("unexpected get %q, %v", value, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := cache.Get("dedup"); storage.ErrNotFound != err {
+		t.Fatalf("expected the expired key to be gone, got %v", err)
+	}
+}
+
+func TestCachingStoreHonoursTTLOnWrite(t *testing.T) {
+	_, cache := newCountingCache(t, 10, nil)
+
+	cache.SetWithTTL("key", "value", 50*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	if _, err := cache.Get("key"); storage.ErrNotFound != err {
+		t.Fatalf("expected the expired key to be gone, got %v", err)
+	}
+}
+
+func TestCachingStoreDoesNotCacheReadsWithoutExpiry(t *testing.T) {
+	backing := &countingStore{BackingStore: storage.NewMemoryStore()}
+	cache := storage.NewCachingStore(plainStore{backing}, 10, nil)
+	cache.Init()
+	backing.Set("key", "value")
+
+	cache.Get("key")
+	cache.Get("key")
+
+	if 2 != backing.gets {
+		t.Fatalf("expected every read to reach the backing store, got %d", backing.gets)
+	}
+}
+
+func TestCachingStoreEvictsLeastRecentlyUsed(t *testing.T) {
+	backing, cache := newCountingCache(t, 2, nil)
+	cache.Set("a", "1")
+	cache.Set("b", "2")
+	cache.Get("a")
+	cache.Set("c", "3")
+
+	backing.gets = 0
+	cache.Get("a")
+	cache.Get("c")
+	if 0 != backing.gets {
+		t.Fatalf("expected a and c to be cached, got %d backing reads", backing.gets)
+	}
+
+	cache.Get("b")
+	if 1 != backing.gets {
+		t.Fatalf("expected b to have been evicted, got %d backing reads", backing.gets)
+	}
+}
+
+func TestCachingStoreInvalidation(t *testing.T) {
+	invalidator := &recordingInvalidator{}
+	backing, cache := newCountingCache(t, 10, invalidator)
+
+	cache.Set("key", "one")
+	cache.Delete("other")
+	if 2 != len(invalidator.published) {
+		t.Fatalf("expected writes to be published, got %v", invalidator.published)
+	}
+
+	// Another process changes the key and publishes the change
+	backing.Set("key", "two")
+	invalidator.invalidate("key")
+
+	if value, _ := cache.Get("key"); "two" != value {
+		t.Fatalf("expected the invalidated key to be read again, got %q", value)
+	}
+
+	backing.Set("key", "three")
+	invalidator.reset()
+
+	if value, _ := cache.Get("key"); "three" != value {
+		t.Fatalf("expected the reset cache to be read again, got %q", value)
+	}
+}
+
+func TestCachingStoreAtomicOperations(t *testing.T) {
+	_, cache := newCountingCache(t, 10, nil)
+
+	if stored, _ := cache.SetIfAbsent("key", "one", 0); !stored {
+		t.Fatal("expected the absent key to be stored")
+	}
+
+	if stored, _ := cache.SetIfAbsent("key", "two", 0); stored {
+		t.Fatal("expected the present key not to be stored")
+	}
+
+	if swapped, _ := cache.CompareAndSwap("key", "one", "three"); !swapped {
+		t.Fatal("expected the swap to succeed")
+	}
+
+	if value, _ := cache.Get("key"); "three" != value {
+		t.Fatalf("expected the swapped value, got %q", value)
+	}
+}
+
+// pausingStore pauses reads after they reach the backing store, until released
+type pausingStore struct {
+	storage.BackingStore
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (p *pausingStore) GetWithExpiry(key string) (string, time.Time, error) {
+	value, expires, err := p.BackingStore.(storage.ExpiringGetter).GetWithExpiry(key)
+	p.read <- struct{}{}
+	<-p.release
+
+	return value, expires, err
+}
+
+func TestCachingStoreDoesNotCacheStaleReads(t *testing.T) {
+	for name, change := range map[string]func(cache storage.BackingStore, invalidator *recordingInvalidator){
+		"set":        func(cache storage.BackingStore, _ *recordingInvalidator) { cache.Set("key", "two") },
+		"delete":     func(cache storage.BackingStore, _ *recordingInvalidator) { cache.Delete("key") },
+		"invalidate": func(_ storage.BackingStore, invalidator *recordingInvalidator) { invalidator.invalidate("key") },
+		"reset":      func(_ storage.BackingStore, invalidator *recordingInvalidator) { invalidator.reset() },
+	} {
+		memory := storage.NewMemoryStore()
+		backing := &pausingStore{BackingStore: memory, read: make(chan struct{}), release: make(chan struct{})}
+		invalidator := &recordingInvalidator{}
+		cache := storage.NewCachingStore(backing, 10, invalidator)
+		if err := cache.Init(); nil != err {
+			t.Fatal(err)
+		}
+		memory.Set("key", "one")
+
+		// The key changes after a read missed the cache, but before the read completes
+		done := make(chan string)
+		go func() {
+			value, _ := cache.Get("key")
+			done <- value
+		}()
+
+		<-backing.read
+		memory.Set("key", "two")
+		change(cache, invalidator)
+		close(backing.release)
+
+		if value := <-done; "one" != value {
+			t.Fatalf("%s: expected the read to see the old value, got %q", name, value)
+		}
+
+		// The stale value wasn't cached, so the next read reaches the backing store
+		go func() { <-backing.read }()
+		expected, _ := memory.Get("key")
+		if value, _ := cache.Get("key"); expected != value {
+			t.Errorf("%s: expected the stale value not to be cached, got %q", name, value)
+		}
+	}
+}
+
+func TestCachingStoreConcurrentReadsAndWrites(t *testing.T) {
+	memory := storage.NewMemoryStore()
+	cache := storage.NewCachingStore(memory, 10, nil)
+	if err := cache.Init(); nil != err {
+		t.Fatal(err)
+	}
+
+	var wait sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wait.Add(1)
+		go func(i int) {
+			defer wait.Done()
+			for j := 0; j < 200; j++ {
+				key := strconv.Itoa(j % 5)
+				if 0 == i%2 {
+					cache.Set(key, strconv.Itoa(j))
+				} else {
+					cache.Get(key)
+				}
+			}
+		}(i)
+	}
+	wait.Wait()
+
+	// Once writes stop, the cache agrees with the backing store
+	for j := 0; j < 5; j++ {
+		key := strconv.Itoa(j)
+		expected, _ := memory.Get(key)
+		if value, _ := cache.Get(key); expected != value {
+			t.Fatalf("expected %q to be %q, got %q", key, expected, value)
+		}
+	}
+}
+
+// closingStore records whether it was closed
+type closingStore struct {
+	storage.BackingStore
+	closed bool
+}
+
+func (c *closingStore) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestCachingStoreClose(t *testing.T) {
+	backing := &closingStore{BackingStore: storage.NewMemoryStore()}
+	invalidator := &recordingInvalidator{}
+	cache := storage.NewCachingStore(backing, 10, invalidator)
+	if err := cache.Init(); nil != err {
+		t.Fatal(err)
+	}
+
+	if err := cache.(io.Closer).Close(); nil != err {
+		t.Fatal(err)
+	}
+
+	if !invalidator.closed || !backing.closed {
+		t.Fatalf("expected the invalidator and backing store to be closed, got %v and %v", invalidator.closed, backing.closed)
+	}
+}
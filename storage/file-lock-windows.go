@@ -0,0 +1,26 @@
+//go:build windows
+// +build windows
+
+package storage
+
+import (
+	"fmt"
+	"os"
+)
+
+// lockPath creates the lock file exclusively, failing if it already exists. A lock file
+// left behind by a crashed process must be removed by hand.
+func lockPath(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
+	if nil != err {
+		return nil, fmt.Errorf("%s is locked by another process: %s", path, err)
+	}
+
+	return file, nil
+}
+
+// unlockPath releases a lock taken with lockPath
+func unlockPath(file *os.File) {
+	file.Close()
+	os.Remove(file.Name())
+}
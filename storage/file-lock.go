@@ -0,0 +1,33 @@
+//go:build !windows
+// +build !windows
+
+package storage
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// lockPath creates the lock file and takes an exclusive lock on it, failing immediately if
+// another process already holds the lock
+func lockPath(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if nil != err {
+		return nil, err
+	}
+
+	err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if nil != err {
+		file.Close()
+		return nil, fmt.Errorf("%s is locked by another process: %s", path, err)
+	}
+
+	return file, nil
+}
+
+// unlockPath releases a lock taken with lockPath
+func unlockPath(file *os.File) {
+	syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+	file.Close()
+}
@@ -0,0 +1,343 @@
+package storage
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+const (
+	// JsonFileScheme is the DATABASE_URL scheme which selects the JSON file store
+	JsonFileScheme string = "file:"
+
+	// JsonFileVersion is the version of the JSON file format written by the store
+	JsonFileVersion int = 1
+
+	// DefaultFlushDelay is how long writes are collected before being flushed to disk
+	DefaultFlushDelay time.Duration = time.Second
+)
+
+// jsonFileEntry is the persisted form of a single value
+type jsonFileEntry struct {
+	Value     string     `json:"value"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// jsonFileContents is the persisted form of the entire store
+type jsonFileContents struct {
+	Version int                      `json:"version"`
+	Entries map[string]jsonFileEntry `json:"entries"`
+}
+
+// JsonFileBackingStore is the implementation of BackingStore which keeps all values in
+// memory and persists them to a single JSON file. Writes are debounced, and the file is
+// replaced atomically so a crash never leaves a partially written file behind.
+type JsonFileBackingStore struct {
+	path       string
+	flushDelay time.Duration
+	memory     MemoryBackingStore
+	flushLock  sync.Mutex
+	flushTimer *time.Timer
+	flushErr   error
+	lockFile   *os.File
+}
+
+// Ensure we correctly implement BackingStore
+var _ BackingStore = &JsonFileBackingStore{}
+
+// NewJsonFileStore creates a new BackingStore implementation persisting to the JSON file
+func NewJsonFileStore(path string) BackingStore {
+	return NewJsonFileStoreWithDelay(path, DefaultFlushDelay)
+}
+
+// NewJsonFileStoreWithDelay creates a new BackingStore implementation persisting to the JSON
+// file, collecting writes for the flush delay before writing
+func NewJsonFileStoreWithDelay(path string, flushDelay time.Duration) *JsonFileBackingStore {
+	instance := JsonFileBackingStore{
+		path:       path,
+		flushDelay: flushDelay,
+	}
+
+	return &instance
+}
+
+func (p *JsonFileBackingStore) Init() error {
+	lockFile, err := lockPath(p.path + ".lock")
+	if nil != err {
+		return err
+	}
+
+	err = p.memory.Init()
+	if nil != err {
+		unlockPath(lockFile)
+		return err
+	}
+
+	err = p.load()
+	if nil != err {
+		unlockPath(lockFile)
+		return err
+	}
+
+	p.flushLock.Lock()
+	p.lockFile = lockFile
+	p.flushLock.Unlock()
+
+	return nil
+}
+
+// load reads the existing file into memory, if one exists
+func (p *JsonFileBackingStore) load() error {
+	data, err := ioutil.ReadFile(p.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if nil != err {
+		return err
+	}
+
+	var contents jsonFileContents
+	err = json.Unmarshal(data, &contents)
+	if nil != err {
+		return err
+	}
+
+	now := time.Now()
+
+	p.memory.lock.Lock()
+	defer p.memory.lock.Unlock()
+
+	for key, entry := range contents.Entries {
+		expires := time.Time{}
+		if nil != entry.ExpiresAt {
+			expires = *entry.ExpiresAt
+		}
+
+		if isExpired(now, expires) {
+			continue
+		}
+
+		p.memory.memory[key] = memoryEntry{
+			value:   entry.Value,
+			expires: expires,
+		}
+	}
+
+	return nil
+}
+
+// snapshot copies all live values into their persisted form
+func (p *JsonFileBackingStore) snapshot() jsonFileContents {
+	contents := jsonFileContents{
+		Version: JsonFileVersion,
+		Entries: make(map[string]jsonFileEntry),
+	}
+
+	now := time.Now()
+
+	p.memory.lock.Lock()
+	defer p.memory.lock.Unlock()
+
+	for key, entry := range p.memory.memory {
+		if isExpired(now, entry.expires) {
+			continue
+		}
+
+		persisted := jsonFileEntry{
+			Value: entry.value,
+		}
+
+		if !entry.expires.IsZero() {
+			expires := entry.expires.UTC()
+			persisted.ExpiresAt = &expires
+		}
+
+		contents.Entries[key] = persisted
+	}
+
+	return contents
+}
+
+// scheduleFlush writes the store to disk after the flush delay, unless a flush is
+// already scheduled or the store doesn't hold the file lock
+func (p *JsonFileBackingStore) scheduleFlush() {
+	p.flushLock.Lock()
+	defer p.flushLock.Unlock()
+
+	if nil != p.flushTimer || nil == p.lockFile {
+		return
+	}
+
+	p.flushTimer = time.AfterFunc(p.flushDelay, func() {
+		p.flushLock.Lock()
+		defer p.flushLock.Unlock()
+
+		// Closed while the timer fired
+		if nil == p.lockFile {
+			return
+		}
+
+		if err := p.flush(); nil != err {
+			logutil.Error("Failed to flush JSON file store", "path", p.path, logutil.ErrorKey, err)
+		}
+	})
+}
+
+// Flush immediately writes all values to disk, cancelling any scheduled flush
+func (p *JsonFileBackingStore) Flush() error {
+	p.flushLock.Lock()
+	defer p.flushLock.Unlock()
+
+	if nil == p.lockFile {
+		return ErrNotInitialized
+	}
+
+	return p.flush()
+}
+
+// flush writes all values to disk while the flush lock is held
+func (p *JsonFileBackingStore) flush() error {
+	if nil != p.flushTimer {
+		p.flushTimer.Stop()
+		p.flushTimer = nil
+	}
+
+	data, err := json.MarshalIndent(p.snapshot(), "", "  ")
+	if nil == err {
+		err = writeFileAtomic(p.path, data)
+	}
+
+	p.flushErr = err
+	return err
+}
+
+// Ping reports the error from the most recent flush, if it failed
+func (p *JsonFileBackingStore) Ping() error {
+	p.flushLock.Lock()
+	defer p.flushLock.Unlock()
+
+	if nil == p.lockFile {
+		return ErrNotInitialized
+	}
+
+	return p.flushErr
+}
+
+// Close flushes all pending writes and releases the file lock. A store which never
+// acquired the lock doesn't write, so the file of the process holding it is left alone.
+func (p *JsonFileBackingStore) Close() error {
+	p.flushLock.Lock()
+	defer p.flushLock.Unlock()
+
+	if nil == p.lockFile {
+		return nil
+	}
+
+	err := p.flush()
+	unlockPath(p.lockFile)
+	p.lockFile = nil
+
+	return err
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory, then renames
+// it over the destination
+func writeFileAtomic(path string, data []byte) error {
+	directory := filepath.Dir(path)
+
+	temp, err := ioutil.TempFile(directory, filepath.Base(path)+".tmp")
+	if nil != err {
+		return err
+	}
+
+	_, err = temp.Write(data)
+	if nil == err {
+		err = temp.Sync()
+	}
+
+	if closeErr := temp.Close(); nil == err {
+		err = closeErr
+	}
+
+	if nil != err {
+		os.Remove(temp.Name())
+		return err
+	}
+
+	err = os.Rename(temp.Name(), path)
+	if nil != err {
+		os.Remove(temp.Name())
+		return err
+	}
+
+	// Persist the rename itself; not every platform supports syncing a directory
+	if dir, err := os.Open(directory); nil == err {
+		dir.Sync()
+		dir.Close()
+	}
+
+	return nil
+}
+
+func (p *JsonFileBackingStore) Get(key string) (string, error) {
+	return p.memory.Get(key)
+}
+
+func (p *JsonFileBackingStore) Set(key string, value string) error {
+	return p.SetWithTTL(key, value, 0)
+}
+
+func (p *JsonFileBackingStore) SetWithTTL(key string, value string, ttl time.Duration) error {
+	err := p.memory.SetWithTTL(key, value, ttl)
+	if nil == err {
+		p.scheduleFlush()
+	}
+
+	return err
+}
+
+func (p *JsonFileBackingStore) Delete(key string) error {
+	err := p.memory.Delete(key)
+	if nil == err {
+		p.scheduleFlush()
+	}
+
+	return err
+}
+
+func (p *JsonFileBackingStore) List(prefix string) (map[string]string, error) {
+	return p.memory.List(prefix)
+}
+
+func (p *JsonFileBackingStore) CompareAndSwap(key string, previous string, next string) (bool, error) {
+	swapped, err := p.memory.CompareAndSwap(key, previous, next)
+	if swapped {
+		p.scheduleFlush()
+	}
+
+	return swapped, err
+}
+
+func (p *JsonFileBackingStore) SetIfAbsent(key string, value string, ttl time.Duration) (bool, error) {
+	stored, err := p.memory.SetIfAbsent(key, value, ttl)
+	if stored {
+		p.scheduleFlush()
+	}
+
+	return stored, err
+}
+
+func (p *JsonFileBackingStore) SetIfChanged(key string, value string) (bool, error) {
+	changed, err := p.memory.SetIfChanged(key, value)
+	if changed {
+		p.scheduleFlush()
+	}
+
+	return changed, err
+}
@@ -0,0 +1,195 @@
+package storage_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/storage"
+	"github.com/mbolt35/multi-twitch-discord-bot/storage/storagetest"
+)
+
+// newJsonFileStore creates and initializes a store at the path with a short flush delay
+func newJsonFileStore(t *testing.T, path string) *storage.JsonFileBackingStore {
+	store := storage.NewJsonFileStoreWithDelay(path, 10*time.Millisecond)
+	if err := store.Init(); nil != err {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestJsonFileStoreConformance(t *testing.T) {
+	dirs := &tempDirs{}
+	defer dirs.remove()
+
+	var stores []*storage.JsonFileBackingStore
+	defer func() {
+		for _, store := range stores {
+			store.Close()
+		}
+	}()
+
+	storagetest.RunConformance(t, func(t *testing.T) storage.BackingStore {
+		store := newJsonFileStore(t, dirs.path(t, "bot.json"))
+		stores = append(stores, store)
+		return store
+	})
+}
+
+func TestJsonFileStorePersistsOnClose(t *testing.T) {
+	dirs := &tempDirs{}
+	defer dirs.remove()
+
+	path := dirs.path(t, "bot.json")
+
+	// A long flush delay means only Close writes the file
+	store := storage.NewJsonFileStoreWithDelay(path, time.Hour)
+	if err := store.Init(); nil != err {
+		t.Fatal(err)
+	}
+
+	store.Set("forever", "1")
+	store.SetWithTTL("later", "2", time.Hour)
+	store.SetWithTTL("soon", "3", 20*time.Millisecond)
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected writes to be debounced, got %v", err)
+	}
+
+	if err := store.Close(); nil != err {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	reopened := newJsonFileStore(t, path)
+	defer reopened.Close()
+
+	for key, expected := range map[string]string{"forever": "1", "later": "2"} {
+		if value, err := reopened.Get(key); nil != err || expected != value {
+			t.Errorf("Get(%q) = %q, %v, expected %q", key, value, err, expected)
+		}
+	}
+
+	if _, err := reopened.Get("soon"); storage.ErrNotFound != err {
+		t.Errorf("expected the expired key not to be loaded, got %v", err)
+	}
+}
+
+func TestJsonFileStoreFlushesAfterDelay(t *testing.T) {
+	dirs := &tempDirs{}
+	defer dirs.remove()
+
+	path := dirs.path(t, "bot.json")
+	store := newJsonFileStore(t, path)
+	defer store.Close()
+
+	store.Set("key", "value")
+	time.Sleep(100 * time.Millisecond)
+
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	var contents struct {
+		Version int `json:"version"`
+		Entries map[string]struct {
+			Value string `json:"value"`
+		} `json:"entries"`
+	}
+
+	if err := json.Unmarshal(data, &contents); nil != err {
+		t.Fatal(err)
+	}
+
+	if storage.JsonFileVersion != contents.Version || "value" != contents.Entries["key"].Value {
+		t.Fatalf("unexpected file contents %s", data)
+	}
+}
+
+func TestJsonFileStoreLocksFile(t *testing.T) {
+	dirs := &tempDirs{}
+	defer dirs.remove()
+
+	path := dirs.path(t, "bot.json")
+	store := newJsonFileStore(t, path)
+
+	if err := storage.NewJsonFileStore(path).Init(); nil == err {
+		t.Fatal("expected a second store on the same file to fail to initialize")
+	}
+
+	store.Close()
+
+	other := storage.NewJsonFileStore(path)
+	if err := other.Init(); nil != err {
+		t.Fatalf("expected the lock to be released on Close, got %v", err)
+	}
+	other.(*storage.JsonFileBackingStore).Close()
+}
+
+func TestJsonFileStoreWithoutTheLockDoesNotWrite(t *testing.T) {
+	dirs := &tempDirs{}
+	defer dirs.remove()
+
+	path := dirs.path(t, "bot.json")
+	store := newJsonFileStore(t, path)
+	defer store.Close()
+
+	store.Set("key", "value")
+	if err := store.Flush(); nil != err {
+		t.Fatal(err)
+	}
+
+	// Closing a store which failed to acquire the lock must not replace the file
+	other := storage.NewJsonFileStoreWithDelay(path, 10*time.Millisecond)
+	if err := other.Init(); nil == err {
+		t.Fatal("expected a second store on the same file to fail to initialize")
+	}
+
+	other.Set("other", "value")
+	if err := other.Close(); nil != err {
+		t.Fatal(err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	data, err := ioutil.ReadFile(path)
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(data), `"key"`) || strings.Contains(string(data), `"other"`) {
+		t.Fatalf("expected the file to be left alone, got %s", data)
+	}
+}
+
+func TestJsonFileStoreDoesNotWriteAfterClose(t *testing.T) {
+	dirs := &tempDirs{}
+	defer dirs.remove()
+
+	path := dirs.path(t, "bot.json")
+	store := newJsonFileStore(t, path)
+	if err := store.Close(); nil != err {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(path); nil != err {
+		t.Fatal(err)
+	}
+
+	store.Set("key", "value")
+	time.Sleep(50 * time.Millisecond)
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected no flush after Close, got %v", err)
+	}
+
+	if err := store.Flush(); storage.ErrNotInitialized != err {
+		t.Fatalf("expected Flush after Close to fail, got %v", err)
+	}
+}
@@ -1,12 +1,26 @@
 package storage
 
-// PostgresBackingStore is the implementation of BackingStore with Postgres SQL
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoryEntry is a single value held by the MemoryBackingStore
+type memoryEntry struct {
+	value   string
+	expires time.Time
+}
+
+// MemoryBackingStore is the implementation of BackingStore with an in memory map
 type MemoryBackingStore struct {
-	memory map[string]string
+	lock   sync.Mutex
+	memory map[string]memoryEntry
 }
 
 // Ensure we correctly implement BackingStore
 var _ BackingStore = &MemoryBackingStore{}
+var _ ExpiringGetter = &MemoryBackingStore{}
 
 // NewMemoryStore creates a new BackingStore implementation using an in memory map
 func NewMemoryStore() BackingStore {
@@ -14,26 +28,165 @@ func NewMemoryStore() BackingStore {
 	return &instance
 }
 
-// isMapEntry determines if the input key exists in the map
-func isMapEntry(m map[string]string, key string) bool {
-	_, ok := m[key]
-	return ok
+// lookup returns the live entry for the key. The lock must be held by the caller.
+func (p *MemoryBackingStore) lookup(key string) (memoryEntry, bool) {
+	entry, ok := p.memory[key]
+	if !ok {
+		return entry, false
+	}
+
+	if isExpired(time.Now(), entry.expires) {
+		delete(p.memory, key)
+		return entry, false
+	}
+
+	return entry, true
 }
 
 func (p *MemoryBackingStore) Init() error {
-	p.memory = make(map[string]string)
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.memory = make(map[string]memoryEntry)
+	return nil
+}
+
+func (p *MemoryBackingStore) Ping() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if nil == p.memory {
+		return ErrNotInitialized
+	}
+
 	return nil
 }
 
 func (p *MemoryBackingStore) Get(key string) (string, error) {
-	if !isMapEntry(p.memory, key) {
-		return "", nil
+	value, _, err := p.GetWithExpiry(key)
+	return value, err
+}
+
+func (p *MemoryBackingStore) GetWithExpiry(key string) (string, time.Time, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if nil == p.memory {
+		return "", time.Time{}, ErrNotInitialized
+	}
+
+	entry, ok := p.lookup(key)
+	if !ok {
+		return "", time.Time{}, ErrNotFound
 	}
 
-	return p.memory[key], nil
+	return entry.value, entry.expires, nil
 }
 
 func (p *MemoryBackingStore) Set(key string, value string) error {
-	p.memory[key] = value
+	return p.SetWithTTL(key, value, 0)
+}
+
+func (p *MemoryBackingStore) SetWithTTL(key string, value string, ttl time.Duration) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if nil == p.memory {
+		return ErrNotInitialized
+	}
+
+	p.memory[key] = memoryEntry{
+		value:   value,
+		expires: expiryFor(time.Now(), ttl),
+	}
+	return nil
+}
+
+func (p *MemoryBackingStore) Delete(key string) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if nil == p.memory {
+		return ErrNotInitialized
+	}
+
+	delete(p.memory, key)
 	return nil
 }
+
+func (p *MemoryBackingStore) List(prefix string) (map[string]string, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if nil == p.memory {
+		return nil, ErrNotInitialized
+	}
+
+	result := make(map[string]string)
+	for key := range p.memory {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		if entry, ok := p.lookup(key); ok {
+			result[key] = entry.value
+		}
+	}
+
+	return result, nil
+}
+
+func (p *MemoryBackingStore) CompareAndSwap(key string, previous string, next string) (bool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if nil == p.memory {
+		return false, ErrNotInitialized
+	}
+
+	entry, ok := p.lookup(key)
+	if !ok || entry.value != previous {
+		return false, nil
+	}
+
+	entry.value = next
+	p.memory[key] = entry
+	return true, nil
+}
+
+func (p *MemoryBackingStore) SetIfAbsent(key string, value string, ttl time.Duration) (bool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if nil == p.memory {
+		return false, ErrNotInitialized
+	}
+
+	if _, ok := p.lookup(key); ok {
+		return false, nil
+	}
+
+	p.memory[key] = memoryEntry{
+		value:   value,
+		expires: expiryFor(time.Now(), ttl),
+	}
+	return true, nil
+}
+
+func (p *MemoryBackingStore) SetIfChanged(key string, value string) (bool, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if nil == p.memory {
+		return false, ErrNotInitialized
+	}
+
+	if entry, ok := p.lookup(key); ok && entry.value == value {
+		return false, nil
+	}
+
+	p.memory[key] = memoryEntry{
+		value: value,
+	}
+	return true, nil
+}
@@ -0,0 +1,19 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/storage"
+	"github.com/mbolt35/multi-twitch-discord-bot/storage/storagetest"
+)
+
+func TestMemoryStoreConformance(t *testing.T) {
+	storagetest.RunConformance(t, func(t *testing.T) storage.BackingStore {
+		store := storage.NewMemoryStore()
+		if err := store.Init(); nil != err {
+			t.Fatal(err)
+		}
+
+		return store
+	})
+}
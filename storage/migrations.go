@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+const (
+	// CreateMigrationsTableSql creates the table used to track applied schema migrations
+	CreateMigrationsTableSql string = `CREATE TABLE IF NOT EXISTS schema_migrations (
+                                version integer not null,
+                                description text not null,
+                                applied_at timestamp not null default CURRENT_TIMESTAMP,
+                                PRIMARY KEY(version));`
+
+	// AppliedMigrationQuery determines whether a specific migration version has been applied
+	AppliedMigrationQuery string = "SELECT COUNT(*) FROM schema_migrations WHERE version=$1"
+
+	// CurrentVersionQuery selects the highest applied migration version
+	CurrentVersionQuery string = "SELECT COALESCE(MAX(version), 0) FROM schema_migrations"
+
+	// RecordMigrationStatement records a migration version as applied
+	RecordMigrationStatement string = "INSERT INTO schema_migrations(version, description) VALUES($1, $2)"
+)
+
+// Migration is a single, versioned schema change. Migrations are applied in ascending
+// Version order, and each is applied at most once.
+type Migration struct {
+	Version     int
+	Description string
+	Statements  []string
+}
+
+// Migrator applies an ordered set of Migrations to a database, recording each applied
+// version in the schema_migrations table.
+type Migrator struct {
+	db            *sql.DB
+	lockStatement string
+	migrations    []Migration
+}
+
+// NewMigrator creates a new Migrator for the database. The lock statement is executed at the
+// start of every migration transaction, and must block until no other process is migrating.
+func NewMigrator(db *sql.DB, lockStatement string, migrations []Migration) *Migrator {
+	sorted := make([]Migration, len(migrations))
+	copy(sorted, migrations)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+
+	instance := Migrator{
+		db:            db,
+		lockStatement: lockStatement,
+		migrations:    sorted,
+	}
+
+	return &instance
+}
+
+// Migrate applies all pending migrations, each inside its own transaction
+func (m *Migrator) Migrate() error {
+	for i, migration := range m.migrations {
+		if i > 0 && m.migrations[i-1].Version == migration.Version {
+			return fmt.Errorf("Duplicate migration version: %d", migration.Version)
+		}
+
+		applied, err := m.apply(migration)
+		if nil != err {
+			return fmt.Errorf("Migration %d (%s) failed: %s", migration.Version, migration.Description, err)
+		}
+
+		if applied {
+			logutil.Info("Applied migration", "version", migration.Version, "description", migration.Description)
+		}
+	}
+
+	return nil
+}
+
+// Version returns the highest migration version applied to the database
+func (m *Migrator) Version() (int, error) {
+	var version int
+
+	tx, err := m.begin()
+	if nil != err {
+		return version, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(CurrentVersionQuery).Scan(&version)
+	if nil != err {
+		return version, err
+	}
+
+	return version, tx.Commit()
+}
+
+// Latest returns the highest migration version known to the Migrator
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// begin starts a new transaction, acquires the migration lock and ensures the
+// migrations table exists
+func (m *Migrator) begin() (*sql.Tx, error) {
+	tx, err := m.db.Begin()
+	if nil != err {
+		return nil, err
+	}
+
+	if "" != m.lockStatement {
+		if _, err = tx.Exec(m.lockStatement); nil != err {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	if _, err = tx.Exec(CreateMigrationsTableSql); nil != err {
+		tx.Rollback()
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// apply runs a single migration if it has not already been applied. The applied check
+// happens after the lock is held, so concurrent processes will never apply the same
+// migration twice.
+func (m *Migrator) apply(migration Migration) (bool, error) {
+	tx, err := m.begin()
+	if nil != err {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var count int
+	err = tx.QueryRow(AppliedMigrationQuery, migration.Version).Scan(&count)
+	if nil != err {
+		return false, err
+	}
+
+	if count > 0 {
+		return false, nil
+	}
+
+	for _, statement := range migration.Statements {
+		if _, err = tx.Exec(statement); nil != err {
+			return false, err
+		}
+	}
+
+	_, err = tx.Exec(RecordMigrationStatement, migration.Version, migration.Description)
+	if nil != err {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
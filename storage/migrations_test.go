@@ -0,0 +1,125 @@
+//go:build cgo
+// +build cgo
+
+package storage_test
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/storage"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openMigrationsDatabase opens a new, empty SQLite database to migrate
+func openMigrationsDatabase(t *testing.T, dirs *tempDirs) *sql.DB {
+	db, err := sql.Open(storage.DatabaseSqliteType, dirs.path(t, "migrations.db"))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+var testMigrations = []storage.Migration{
+	{Version: 2, Description: "add column", Statements: []string{"ALTER TABLE things ADD COLUMN color text"}},
+	{Version: 1, Description: "create table", Statements: []string{"CREATE TABLE things (name text)"}},
+}
+
+func TestMigratorAppliesInVersionOrder(t *testing.T) {
+	dirs := &tempDirs{}
+	defer dirs.remove()
+
+	db := openMigrationsDatabase(t, dirs)
+	defer db.Close()
+
+	migrator := storage.NewMigrator(db, "", testMigrations)
+	if 2 != migrator.Latest() {
+		t.Fatalf("expected the latest version to be 2, got %d", migrator.Latest())
+	}
+
+	if version, err := migrator.Version(); nil != err || 0 != version {
+		t.Fatalf("expected an empty database at version 0, got %d, %v", version, err)
+	}
+
+	if err := migrator.Migrate(); nil != err {
+		t.Fatal(err)
+	}
+
+	if version, err := migrator.Version(); nil != err || 2 != version {
+		t.Fatalf("expected version 2, got %d, %v", version, err)
+	}
+
+	if _, err := db.Exec("INSERT INTO things(name, color) VALUES('a', 'red')"); nil != err {
+		t.Fatalf("expected both migrations to be applied, got %v", err)
+	}
+}
+
+func TestMigratorAppliesEachMigrationOnce(t *testing.T) {
+	dirs := &tempDirs{}
+	defer dirs.remove()
+
+	db := openMigrationsDatabase(t, dirs)
+	defer db.Close()
+
+	if err := storage.NewMigrator(db, "", testMigrations[1:]).Migrate(); nil != err {
+		t.Fatal(err)
+	}
+
+	// Applying the first migration again would fail, as the table already exists
+	migrator := storage.NewMigrator(db, "", testMigrations)
+	for i := 0; i < 2; i++ {
+		if err := migrator.Migrate(); nil != err {
+			t.Fatal(err)
+		}
+	}
+
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&count); nil != err || 2 != count {
+		t.Fatalf("expected 2 recorded migrations, got %d, %v", count, err)
+	}
+}
+
+func TestMigratorRejectsDuplicateVersions(t *testing.T) {
+	dirs := &tempDirs{}
+	defer dirs.remove()
+
+	db := openMigrationsDatabase(t, dirs)
+	defer db.Close()
+
+	duplicated := append([]storage.Migration{}, testMigrations...)
+	duplicated = append(duplicated, storage.Migration{Version: 2, Description: "again"})
+
+	err := storage.NewMigrator(db, "", duplicated).Migrate()
+	if nil == err || !strings.Contains(err.Error(), "Duplicate migration version") {
+		t.Fatalf("expected a duplicate version error, got %v", err)
+	}
+}
+
+func TestMigratorRollsBackFailedMigration(t *testing.T) {
+	dirs := &tempDirs{}
+	defer dirs.remove()
+
+	db := openMigrationsDatabase(t, dirs)
+	defer db.Close()
+
+	failing := []storage.Migration{
+		testMigrations[1],
+		{Version: 2, Description: "broken", Statements: []string{"CREATE TABLE partial (id integer)", "NOT SQL"}},
+	}
+
+	migrator := storage.NewMigrator(db, "", failing)
+	if err := migrator.Migrate(); nil == err {
+		t.Fatal("expected the broken migration to fail")
+	}
+
+	if version, err := migrator.Version(); nil != err || 1 != version {
+		t.Fatalf("expected version 1, got %d, %v", version, err)
+	}
+
+	if _, err := db.Exec("SELECT * FROM partial"); nil == err {
+		t.Fatal("expected the failed migration's statements to be rolled back")
+	}
+}
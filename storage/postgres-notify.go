@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+const (
+	// PostgresInvalidationChannel is the LISTEN/NOTIFY channel carrying cache invalidations
+	PostgresInvalidationChannel string = "store_invalidation"
+
+	// NotifyStatement is the SQL which publishes a notification to a channel
+	NotifyStatement string = "SELECT pg_notify($1, $2)"
+
+	// ListenerMinReconnect is the initial delay before reconnecting a dropped listener
+	ListenerMinReconnect time.Duration = time.Second
+
+	// ListenerMaxReconnect is the maximum delay before reconnecting a dropped listener
+	ListenerMaxReconnect time.Duration = time.Minute
+
+	// ListenerPingInterval is how often an idle listener connection is checked
+	ListenerPingInterval time.Duration = 90 * time.Second
+)
+
+// PostgresInvalidator is the implementation of CacheInvalidator using Postgres LISTEN/NOTIFY.
+// Each notification payload is the publishing process's id and the key, so a process
+// ignores its own invalidations.
+type PostgresInvalidator struct {
+	databaseHost string
+	instanceId   string
+	db           *sql.DB
+	listener     *pq.Listener
+}
+
+// Ensure we correctly implement CacheInvalidator
+var _ CacheInvalidator = &PostgresInvalidator{}
+
+// NewPostgresInvalidator creates a new CacheInvalidator implementation using Postgres SQL
+func NewPostgresInvalidator(databaseHost string) CacheInvalidator {
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	instance := PostgresInvalidator{
+		databaseHost: databaseHost,
+		instanceId:   hex.EncodeToString(id),
+	}
+
+	return &instance
+}
+
+func (p *PostgresInvalidator) Start(invalidate func(key string), reset func()) error {
+	db, err := sql.Open(DatabasePGType, p.databaseHost)
+	if nil != err {
+		return err
+	}
+
+	onEvent := func(event pq.ListenerEventType, err error) {
+		if nil != err {
+			logutil.Warn("Cache invalidation listener", logutil.ErrorKey, err)
+		}
+
+		// Notifications sent while disconnected are lost, so nothing cached can be trusted
+		if pq.ListenerEventReconnected == event || pq.ListenerEventDisconnected == event {
+			reset()
+		}
+	}
+
+	listener := pq.NewListener(p.databaseHost, ListenerMinReconnect, ListenerMaxReconnect, onEvent)
+	if err = listener.Listen(PostgresInvalidationChannel); nil != err {
+		listener.Close()
+		db.Close()
+		return err
+	}
+
+	p.db = db
+	p.listener = listener
+
+	go p.receive(invalidate)
+	return nil
+}
+
+// receive dispatches invalidations from other processes until the listener is closed
+func (p *PostgresInvalidator) receive(invalidate func(key string)) {
+	ticker := time.NewTicker(ListenerPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case notification, ok := <-p.listener.Notify:
+			if !ok {
+				return
+			}
+
+			// A nil notification is sent after reconnecting, which the event callback handles
+			if nil == notification {
+				continue
+			}
+
+			parts := strings.SplitN(notification.Extra, ":", 2)
+			if len(parts) == 2 && parts[0] != p.instanceId {
+				invalidate(parts[1])
+			}
+
+		case <-ticker.C:
+			go p.listener.Ping()
+		}
+	}
+}
+
+func (p *PostgresInvalidator) Publish(key string) error {
+	_, err := p.db.Exec(NotifyStatement, PostgresInvalidationChannel, p.instanceId+":"+key)
+	return err
+}
+
+// Close closes the listener, which stops receiving invalidations, then the database
+func (p *PostgresInvalidator) Close() error {
+	if nil == p.listener {
+		return nil
+	}
+
+	err := p.listener.Close()
+	if closeErr := p.db.Close(); nil == err {
+		err = closeErr
+	}
+
+	return err
+}
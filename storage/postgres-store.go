@@ -2,6 +2,7 @@ package storage
 
 import (
 	"database/sql"
+	"time"
 
 	_ "github.com/lib/pq"
 )
@@ -16,29 +17,104 @@ const (
                                 value varchar(255) not null,
                                 PRIMARY KEY(key));`
 
-	// GetQuery is the SQL which looks up a value from storage given a key
-	GetQuery string = "SELECT value FROM store WHERE key=$1"
+	// WidenValueSql removes the length restriction on stored values
+	WidenValueSql string = "ALTER TABLE store ALTER COLUMN value TYPE text"
 
-	// SetStatement is the SQL which inserts a new value for the provided key
-	SetStatement string = `INSERT INTO store(key, value) VALUES($1, $2)
-                                ON CONFLICT (key) DO UPDATE SET value=$2`
+	// PostgresLockStatement acquires the migration advisory lock for the current transaction,
+	// which serializes migrations across every process sharing the database
+	PostgresLockStatement string = "SELECT pg_advisory_xact_lock(7887039219502153729)"
+
+	// AddExpiresAtSql adds the optional per key expiration time
+	AddExpiresAtSql string = "ALTER TABLE store ADD COLUMN IF NOT EXISTS expires_at timestamptz"
+
+	// GetQuery is the SQL which looks up a value from storage given a key, along with the
+	// milliseconds until it expires, or null if it never does
+	GetQuery string = `SELECT value, CAST(EXTRACT(EPOCH FROM expires_at - now()) * 1000 AS bigint)
+                                FROM store WHERE key=$1
+                                AND (expires_at IS NULL OR expires_at > now())`
+
+	// SetStatement is the SQL which inserts a new value for the provided key, expiring after
+	// the provided number of milliseconds if positive
+	SetStatement string = `INSERT INTO store(key, value, expires_at) VALUES($1, $2,
+                                CASE WHEN $3::bigint > 0 THEN now() + $3::bigint * interval '1 millisecond' END)
+                                ON CONFLICT (key) DO UPDATE SET value=EXCLUDED.value, expires_at=EXCLUDED.expires_at`
+
+	// DeleteStatement is the SQL which removes the provided key
+	DeleteStatement string = "DELETE FROM store WHERE key=$1"
+
+	// ListQuery is the SQL which looks up all keys and values matching a LIKE pattern
+	ListQuery string = `SELECT key, value FROM store WHERE key LIKE $1 ESCAPE '\'
+                                AND (expires_at IS NULL OR expires_at > now())`
+
+	// CompareAndSwapStatement is the SQL which replaces the value for a key only if it
+	// currently holds the expected value
+	CompareAndSwapStatement string = `UPDATE store SET value=$3 WHERE key=$1 AND value=$2
+                                AND (expires_at IS NULL OR expires_at > now())`
+
+	// SetIfAbsentQuery is the SQL which inserts a value for the provided key only if there
+	// is no live entry, returning the key if the value was stored
+	SetIfAbsentQuery string = `INSERT INTO store(key, value, expires_at) VALUES($1, $2,
+                                CASE WHEN $3::bigint > 0 THEN now() + $3::bigint * interval '1 millisecond' END)
+                                ON CONFLICT (key) DO UPDATE SET value=EXCLUDED.value, expires_at=EXCLUDED.expires_at
+                                WHERE store.expires_at IS NOT NULL AND store.expires_at <= now()
+                                RETURNING key`
+
+	// SetIfChangedQuery is the SQL which stores a value for the provided key unless it
+	// already holds the same live value, returning the key if the value was stored
+	SetIfChangedQuery string = `INSERT INTO store(key, value) VALUES($1, $2)
+                                ON CONFLICT (key) DO UPDATE SET value=EXCLUDED.value, expires_at=NULL
+                                WHERE store.value <> EXCLUDED.value
+                                OR (store.expires_at IS NOT NULL AND store.expires_at <= now())
+                                RETURNING key`
+
+	// PurgeExpiredStatement is the SQL which removes all expired keys
+	PurgeExpiredStatement string = "DELETE FROM store WHERE expires_at <= now()"
 )
 
+// PostgresMigrations are the ordered schema migrations for the Postgres store. Existing
+// entries must never be changed; append a new Migration instead.
+var PostgresMigrations = []Migration{
+	{
+		Version:     1,
+		Description: "create store table",
+		Statements:  []string{CreateTableSql},
+	},
+	{
+		Version:     2,
+		Description: "widen store value column",
+		Statements:  []string{WidenValueSql},
+	},
+	{
+		Version:     3,
+		Description: "add store expires_at column",
+		Statements:  []string{AddExpiresAtSql},
+	},
+}
+
 // PostgresBackingStore is the implementation of BackingStore with Postgres SQL
 type PostgresBackingStore struct {
-	databaseHost string
-	db           *sql.DB
-	getQuery     *sql.Stmt
-	setStatement *sql.Stmt
+	databaseHost            string
+	pool                    PoolOptions
+	db                      *sql.DB
+	getQuery                *sql.Stmt
+	setStatement            *sql.Stmt
+	deleteStatement         *sql.Stmt
+	listQuery               *sql.Stmt
+	compareAndSwapStatement *sql.Stmt
+	setIfAbsentQuery        *sql.Stmt
+	setIfChangedQuery       *sql.Stmt
 }
 
 // Ensure we correctly implement BackingStore
 var _ BackingStore = &PostgresBackingStore{}
+var _ ExpiringGetter = &PostgresBackingStore{}
 
-// NewPostgresStore creates a new BackingStore implementation using Postgres SQL
-func NewPostgresStore(databaseHost string) BackingStore {
+// NewPostgresStore creates a new BackingStore implementation using Postgres SQL, limiting
+// its connections with the pool options
+func NewPostgresStore(databaseHost string, pool PoolOptions) BackingStore {
 	instance := PostgresBackingStore{
 		databaseHost: databaseHost,
+		pool:         pool,
 	}
 
 	return &instance
@@ -46,49 +122,188 @@ func NewPostgresStore(databaseHost string) BackingStore {
 
 func (p *PostgresBackingStore) Init() error {
 	db, err := sql.Open(DatabasePGType, p.databaseHost)
-
 	if err != nil {
 		return err
 	}
 
-	if err := db.Ping(); err != nil {
-		return err
-	}
+	p.pool.apply(db)
 
-	_, err = db.Exec(CreateTableSql)
+	err = p.initDatabase(db)
 	if nil != err {
+		db.Close()
 		return err
 	}
 
 	p.db = db
-	p.getQuery, _ = db.Prepare(GetQuery)
-	p.setStatement, _ = db.Prepare(SetStatement)
 	return nil
 }
 
-func (p *PostgresBackingStore) Get(key string) (string, error) {
-	rows, err := p.getQuery.Query(key)
+// initDatabase verifies the connection, migrates the schema and prepares all statements
+func (p *PostgresBackingStore) initDatabase(db *sql.DB) error {
+	if err := db.Ping(); err != nil {
+		return err
+	}
+
+	err := NewMigrator(db, PostgresLockStatement, PostgresMigrations).Migrate()
 	if nil != err {
-		return "", err
+		return err
 	}
 
-	defer rows.Close()
+	_, err = db.Exec(PurgeExpiredStatement)
+	if nil != err {
+		return err
+	}
+
+	return prepareStatements(db, []preparedStatement{
+		{&p.getQuery, GetQuery},
+		{&p.setStatement, SetStatement},
+		{&p.deleteStatement, DeleteStatement},
+		{&p.listQuery, ListQuery},
+		{&p.compareAndSwapStatement, CompareAndSwapStatement},
+		{&p.setIfAbsentQuery, SetIfAbsentQuery},
+		{&p.setIfChangedQuery, SetIfChangedQuery},
+	})
+}
+
+func (p *PostgresBackingStore) Ping() error {
+	if nil == p.db {
+		return ErrNotInitialized
+	}
+
+	return p.db.Ping()
+}
+
+// Close closes the database, after which every method fails
+func (p *PostgresBackingStore) Close() error {
+	if nil == p.db {
+		return nil
+	}
+
+	return p.db.Close()
+}
+
+func (p *PostgresBackingStore) Get(key string) (string, error) {
+	value, _, err := p.GetWithExpiry(key)
+	return value, err
+}
 
-	// No Entries
-	if !rows.Next() {
-		return "", nil
+func (p *PostgresBackingStore) GetWithExpiry(key string) (string, time.Time, error) {
+	if nil == p.db {
+		return "", time.Time{}, ErrNotInitialized
 	}
 
 	var value string
-	err = rows.Scan(&value)
+	var remaining sql.NullInt64
+
+	// The remaining time is measured by the database, so its clock doesn't need to agree
+	err := p.getQuery.QueryRow(key).Scan(&value, &remaining)
+	if sql.ErrNoRows == err {
+		return "", time.Time{}, ErrNotFound
+	}
+
 	if nil != err {
-		return "", err
+		return "", time.Time{}, err
+	}
+
+	if !remaining.Valid {
+		return value, time.Time{}, nil
 	}
 
-	return value, nil
+	return value, time.Now().Add(time.Duration(remaining.Int64) * time.Millisecond), nil
 }
 
 func (p *PostgresBackingStore) Set(key string, value string) error {
-	_, err := p.setStatement.Exec(key, value)
+	return p.SetWithTTL(key, value, 0)
+}
+
+func (p *PostgresBackingStore) SetWithTTL(key string, value string, ttl time.Duration) error {
+	if nil == p.db {
+		return ErrNotInitialized
+	}
+
+	_, err := p.setStatement.Exec(key, value, int64(ttl/time.Millisecond))
 	return err
 }
+
+func (p *PostgresBackingStore) Delete(key string) error {
+	if nil == p.db {
+		return ErrNotInitialized
+	}
+
+	_, err := p.deleteStatement.Exec(key)
+	return err
+}
+
+func (p *PostgresBackingStore) List(prefix string) (map[string]string, error) {
+	if nil == p.db {
+		return nil, ErrNotInitialized
+	}
+
+	rows, err := p.listQuery.Query(escapeLikePattern(prefix) + "%")
+	if nil != err {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	result := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err = rows.Scan(&key, &value); nil != err {
+			return nil, err
+		}
+
+		result[key] = value
+	}
+
+	return result, rows.Err()
+}
+
+func (p *PostgresBackingStore) CompareAndSwap(key string, previous string, next string) (bool, error) {
+	if nil == p.db {
+		return false, ErrNotInitialized
+	}
+
+	result, err := p.compareAndSwapStatement.Exec(key, previous, next)
+	if nil != err {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if nil != err {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (p *PostgresBackingStore) SetIfAbsent(key string, value string, ttl time.Duration) (bool, error) {
+	if nil == p.db {
+		return false, ErrNotInitialized
+	}
+
+	return isReturned(p.setIfAbsentQuery.QueryRow(key, value, int64(ttl/time.Millisecond)))
+}
+
+func (p *PostgresBackingStore) SetIfChanged(key string, value string) (bool, error) {
+	if nil == p.db {
+		return false, ErrNotInitialized
+	}
+
+	return isReturned(p.setIfChangedQuery.QueryRow(key, value))
+}
+
+// isReturned determines whether a conditional write returned a row
+func isReturned(row *sql.Row) (bool, error) {
+	var key string
+	err := row.Scan(&key)
+	if sql.ErrNoRows == err {
+		return false, nil
+	}
+
+	if nil != err {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,41 @@
+package storage_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/storage"
+	"github.com/mbolt35/multi-twitch-discord-bot/storage/storagetest"
+)
+
+// PostgresTestUrlEnvVar holds the url of a Postgres database the tests may empty and write
+// to. The Postgres tests are skipped when it's not set.
+const PostgresTestUrlEnvVar string = "POSTGRES_TEST_URL"
+
+func TestPostgresStoreConformance(t *testing.T) {
+	databaseUrl := os.Getenv(PostgresTestUrlEnvVar)
+	if "" == databaseUrl {
+		t.Skipf("$%s is not set", PostgresTestUrlEnvVar)
+	}
+
+	storagetest.RunConformance(t, func(t *testing.T) storage.BackingStore {
+		store := storage.NewPostgresStore(databaseUrl, storage.DefaultPoolOptions)
+		if err := store.Init(); nil != err {
+			t.Fatal(err)
+		}
+
+		// Every test shares the database, so each starts by removing what the last left
+		existing, err := store.List("")
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		for key := range existing {
+			if err := store.Delete(key); nil != err {
+				t.Fatal(err)
+			}
+		}
+
+		return store
+	})
+}
@@ -0,0 +1,358 @@
+package storage
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RedisDefaultPort is used when the redis url does not specify a port
+	RedisDefaultPort string = "6379"
+
+	// RedisMaxIdleConnections is the number of idle connections kept open for reuse
+	RedisMaxIdleConnections int = 8
+
+	// RedisTimeout bounds how long a single command may take
+	RedisTimeout time.Duration = 5 * time.Second
+)
+
+// errRedisNil is the parsed form of a RESP null bulk string or null array
+var errRedisNil = errors.New("redis: nil")
+
+// errRedisPoolClosed is returned for commands sent after the pool is closed
+var errRedisPoolClosed = errors.New("redis: connection pool is closed")
+
+// RedisError is an error reply returned by the redis server
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisOptions are the connection options parsed from a redis:// or rediss:// url
+type redisOptions struct {
+	address  string
+	password string
+	database int
+	useTls   bool
+}
+
+// parseRedisUrl parses redis://[:password@]host[:port][/database]
+func parseRedisUrl(redisUrl string) (redisOptions, error) {
+	options := redisOptions{}
+
+	u, err := url.Parse(redisUrl)
+	if nil != err {
+		return options, err
+	}
+
+	if "redis" != u.Scheme && "rediss" != u.Scheme {
+		return options, fmt.Errorf("Unsupported redis url scheme: %s", u.Scheme)
+	}
+
+	host := u.Hostname()
+	if "" == host {
+		host = "localhost"
+	}
+
+	port := u.Port()
+	if "" == port {
+		port = RedisDefaultPort
+	}
+
+	options.address = net.JoinHostPort(host, port)
+	options.useTls = "rediss" == u.Scheme
+
+	if nil != u.User {
+		options.password, _ = u.User.Password()
+	}
+
+	database := strings.TrimPrefix(u.Path, "/")
+	if "" != database {
+		options.database, err = strconv.Atoi(database)
+		if nil != err {
+			return options, fmt.Errorf("Invalid redis database: %s", database)
+		}
+	}
+
+	return options, nil
+}
+
+// redisConn is a single connection speaking the redis serialization protocol (RESP)
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writer *bufio.Writer
+	broken bool
+}
+
+// redisPool is a pool of redis connections
+type redisPool struct {
+	options redisOptions
+	idle    chan *redisConn
+	lock    sync.Mutex
+	closed  bool
+}
+
+// newRedisPool creates a new, empty pool of connections
+func newRedisPool(options redisOptions) *redisPool {
+	instance := redisPool{
+		options: options,
+		idle:    make(chan *redisConn, RedisMaxIdleConnections),
+	}
+
+	return &instance
+}
+
+// dial opens and authenticates a new connection
+func (p *redisPool) dial() (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: RedisTimeout}
+
+	var conn net.Conn
+	var err error
+	if p.options.useTls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", p.options.address, &tls.Config{})
+	} else {
+		conn, err = dialer.Dial("tcp", p.options.address)
+	}
+
+	if nil != err {
+		return nil, err
+	}
+
+	rc := &redisConn{
+		conn:   conn,
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
+	}
+
+	if "" != p.options.password {
+		if _, err = rc.do("AUTH", p.options.password); nil != err {
+			rc.close()
+			return nil, err
+		}
+	}
+
+	if 0 != p.options.database {
+		if _, err = rc.do("SELECT", strconv.Itoa(p.options.database)); nil != err {
+			rc.close()
+			return nil, err
+		}
+	}
+
+	return rc, nil
+}
+
+// get returns an idle connection, or dials a new one
+func (p *redisPool) get() (*redisConn, error) {
+	p.lock.Lock()
+	closed := p.closed
+	p.lock.Unlock()
+
+	if closed {
+		return nil, errRedisPoolClosed
+	}
+
+	select {
+	case rc := <-p.idle:
+		return rc, nil
+	default:
+		return p.dial()
+	}
+}
+
+// put returns a connection to the pool, closing it if it is broken or the pool is full
+func (p *redisPool) put(rc *redisConn) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if rc.broken || p.closed {
+		rc.close()
+		return
+	}
+
+	select {
+	case p.idle <- rc:
+	default:
+		rc.close()
+	}
+}
+
+// do runs a single command on a pooled connection
+func (p *redisPool) do(args ...string) (interface{}, error) {
+	rc, err := p.get()
+	if nil != err {
+		return nil, err
+	}
+
+	defer p.put(rc)
+	return rc.do(args...)
+}
+
+// close closes every idle connection
+func (p *redisPool) close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.closed = true
+	for {
+		select {
+		case rc := <-p.idle:
+			rc.close()
+		default:
+			return
+		}
+	}
+}
+
+// close closes the underlying network connection
+func (rc *redisConn) close() {
+	rc.broken = true
+	rc.conn.Close()
+}
+
+// do writes a command and reads its reply. Error replies are returned as RedisError,
+// and null replies as errRedisNil.
+func (rc *redisConn) do(args ...string) (interface{}, error) {
+	rc.conn.SetDeadline(time.Now().Add(RedisTimeout))
+
+	err := writeRedisCommand(rc.writer, args)
+	if nil == err {
+		err = rc.writer.Flush()
+	}
+
+	if nil != err {
+		rc.broken = true
+		return nil, err
+	}
+
+	reply, err := readRedisReply(rc.reader)
+	if nil != err {
+		if _, ok := err.(RedisError); !ok && errRedisNil != err {
+			rc.broken = true
+		}
+	}
+
+	return reply, err
+}
+
+// writeRedisCommand writes the command as a RESP array of bulk strings
+func writeRedisCommand(w *bufio.Writer, args []string) error {
+	if _, err := fmt.Fprintf(w, "*%d\r\n", len(args)); nil != err {
+		return err
+	}
+
+	for _, arg := range args {
+		if _, err := fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg); nil != err {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readRedisLine reads a single CRLF terminated line, without the terminator
+func readRedisLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if nil != err {
+		return "", err
+	}
+
+	if !strings.HasSuffix(line, "\r\n") {
+		return "", errors.New("redis: malformed reply line")
+	}
+
+	return line[:len(line)-2], nil
+}
+
+// readRedisReply reads a single RESP reply. Simple and bulk strings are returned as string,
+// integers as int64 and arrays as []interface{}.
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := readRedisLine(r)
+	if nil != err {
+		return nil, err
+	}
+
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+
+	case '-':
+		return nil, RedisError(line[1:])
+
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if nil != err {
+			return nil, err
+		}
+
+		if length < 0 {
+			return nil, errRedisNil
+		}
+
+		data := make([]byte, length+2)
+		if _, err = io.ReadFull(r, data); nil != err {
+			return nil, err
+		}
+
+		return string(data[:length]), nil
+
+	case '*':
+		length, err := strconv.Atoi(line[1:])
+		if nil != err {
+			return nil, err
+		}
+
+		if length < 0 {
+			return nil, errRedisNil
+		}
+
+		// Every element is read before returning an error reply within the array, so the
+		// connection is left at the start of the next reply
+		var elementErr error
+		elements := make([]interface{}, length)
+		for i := range elements {
+			elements[i], err = readRedisReply(r)
+			if _, ok := err.(RedisError); ok {
+				if nil == elementErr {
+					elementErr = err
+				}
+				continue
+			}
+
+			if nil != err && errRedisNil != err {
+				return nil, err
+			}
+		}
+
+		if nil != elementErr {
+			return nil, elementErr
+		}
+
+		return elements, nil
+	}
+
+	return nil, fmt.Errorf("redis: unknown reply type %q", line[0])
+}
+
+// escapeRedisPattern escapes the glob characters in a redis MATCH pattern
+func escapeRedisPattern(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`, `]`, `\]`)
+	return replacer.Replace(s)
+}
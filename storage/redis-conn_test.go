@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"bufio"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadRedisReply(t *testing.T) {
+	cases := []struct {
+		name  string
+		input string
+		reply interface{}
+		err   error
+	}{
+		{"simple string", "+OK\r\n", "OK", nil},
+		{"error", "-ERR wrong type\r\n", nil, RedisError("ERR wrong type")},
+		{"integer", ":42\r\n", int64(42), nil},
+		{"bulk string", "$5\r\nhello\r\n", "hello", nil},
+		{"empty bulk string", "$0\r\n\r\n", "", nil},
+		{"null bulk string", "$-1\r\n", nil, errRedisNil},
+		{"null array", "*-1\r\n", nil, errRedisNil},
+		{"array", "*3\r\n$1\r\na\r\n:1\r\n$-1\r\n", []interface{}{"a", int64(1), nil}, nil},
+		{"nested array", "*2\r\n$1\r\n0\r\n*1\r\n$3\r\nkey\r\n", []interface{}{"0", []interface{}{"key"}}, nil},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reply, err := readRedisReply(bufio.NewReader(strings.NewReader(c.input)))
+			if c.err != err {
+				t.Fatalf("expected error %v, got %v", c.err, err)
+			}
+
+			if !reflect.DeepEqual(c.reply, reply) {
+				t.Fatalf("expected %#v, got %#v", c.reply, reply)
+			}
+		})
+	}
+}
+
+func TestReadRedisReplyMalformed(t *testing.T) {
+	for _, input := range []string{"", "\r\n", "+OK\n", "?what\r\n", ":nope\r\n", "$5\r\nhi\r\n", "*2\r\n+a\r\n"} {
+		if _, err := readRedisReply(bufio.NewReader(strings.NewReader(input))); nil == err {
+			t.Errorf("expected an error reading %q", input)
+		}
+	}
+}
+
+func TestReadRedisReplyArrayErrorConsumesArray(t *testing.T) {
+	// An error element must not leave the rest of the array, or the next reply, unread
+	r := bufio.NewReader(strings.NewReader("*3\r\n-ERR first\r\n$1\r\na\r\n-ERR second\r\n+NEXT\r\n"))
+
+	if _, err := readRedisReply(r); RedisError("ERR first") != err {
+		t.Fatalf("expected the first element error, got %v", err)
+	}
+
+	reply, err := readRedisReply(r)
+	if nil != err || "NEXT" != reply {
+		t.Fatalf("expected the next reply, got %#v, %v", reply, err)
+	}
+}
+
+func TestWriteRedisCommand(t *testing.T) {
+	var buffer strings.Builder
+	w := bufio.NewWriter(&buffer)
+
+	if err := writeRedisCommand(w, []string{"SET", "key", "a b"}); nil != err {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	expected := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$3\r\na b\r\n"
+	if expected != buffer.String() {
+		t.Fatalf("expected %q, got %q", expected, buffer.String())
+	}
+}
+
+func TestEscapeRedisPattern(t *testing.T) {
+	if escaped := escapeRedisPattern(`a*b?[c]\`); `a\*b\?\[c\]\\` != escaped {
+		t.Fatalf("unexpected escaped pattern %q", escaped)
+	}
+}
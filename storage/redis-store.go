@@ -0,0 +1,276 @@
+package storage
+
+import (
+	"errors"
+	"strconv"
+	"time"
+)
+
+const (
+	// RedisScheme is the DATABASE_URL scheme which selects the redis store
+	RedisScheme string = "redis:"
+
+	// RedisTlsScheme is the DATABASE_URL scheme which selects the redis store over TLS
+	RedisTlsScheme string = "rediss:"
+
+	// RedisScanCount is the number of keys requested per SCAN iteration
+	RedisScanCount string = "500"
+
+	// RedisMaxTransactionAttempts bounds the retries of an optimistic transaction which
+	// is aborted by a concurrent write
+	RedisMaxTransactionAttempts int = 10
+)
+
+// RedisBackingStore is the implementation of BackingStore with a redis server, using native
+// key expiry and SET NX for atomic deduplication. Multiple processes sharing the same redis
+// server share all values.
+type RedisBackingStore struct {
+	redisUrl string
+	pool     *redisPool
+}
+
+// Ensure we correctly implement BackingStore
+var _ BackingStore = &RedisBackingStore{}
+
+// NewRedisStore creates a new BackingStore implementation using the redis server at the url
+func NewRedisStore(redisUrl string) BackingStore {
+	instance := RedisBackingStore{
+		redisUrl: redisUrl,
+	}
+
+	return &instance
+}
+
+// redisMilliseconds formats a ttl as the millisecond argument to PX
+func redisMilliseconds(ttl time.Duration) string {
+	milliseconds := int64(ttl / time.Millisecond)
+	if milliseconds < 1 {
+		milliseconds = 1
+	}
+
+	return strconv.FormatInt(milliseconds, 10)
+}
+
+// redisSetCommand builds a SET command with an optional expiry and flags
+func redisSetCommand(key string, value string, ttl time.Duration, flags ...string) []string {
+	command := []string{"SET", key, value}
+	if ttl > 0 {
+		command = append(command, "PX", redisMilliseconds(ttl))
+	}
+
+	return append(command, flags...)
+}
+
+func (p *RedisBackingStore) Init() error {
+	options, err := parseRedisUrl(p.redisUrl)
+	if nil != err {
+		return err
+	}
+
+	pool := newRedisPool(options)
+	if _, err = pool.do("PING"); nil != err {
+		pool.close()
+		return err
+	}
+
+	p.pool = pool
+	return nil
+}
+
+func (p *RedisBackingStore) Ping() error {
+	_, err := p.do("PING")
+	return err
+}
+
+// Close closes the pooled connections, after which every method fails
+func (p *RedisBackingStore) Close() error {
+	if nil != p.pool {
+		p.pool.close()
+	}
+
+	return nil
+}
+
+// do sends a command on a pooled connection, failing if the store isn't initialized
+func (p *RedisBackingStore) do(args ...string) (interface{}, error) {
+	if nil == p.pool {
+		return nil, ErrNotInitialized
+	}
+
+	return p.pool.do(args...)
+}
+
+func (p *RedisBackingStore) Get(key string) (string, error) {
+	reply, err := p.do("GET", key)
+	if errRedisNil == err {
+		return "", ErrNotFound
+	}
+
+	if nil != err {
+		return "", err
+	}
+
+	return reply.(string), nil
+}
+
+func (p *RedisBackingStore) Set(key string, value string) error {
+	return p.SetWithTTL(key, value, 0)
+}
+
+func (p *RedisBackingStore) SetWithTTL(key string, value string, ttl time.Duration) error {
+	_, err := p.do(redisSetCommand(key, value, ttl)...)
+	return err
+}
+
+func (p *RedisBackingStore) Delete(key string) error {
+	_, err := p.do("DEL", key)
+	return err
+}
+
+func (p *RedisBackingStore) List(prefix string) (map[string]string, error) {
+	keys := []string{}
+	pattern := escapeRedisPattern(prefix) + "*"
+
+	cursor := "0"
+	for {
+		reply, err := p.do("SCAN", cursor, "MATCH", pattern, "COUNT", RedisScanCount)
+		if nil != err {
+			return nil, err
+		}
+
+		parts, ok := reply.([]interface{})
+		if !ok || len(parts) != 2 {
+			return nil, errors.New("redis: malformed SCAN reply")
+		}
+
+		cursor, _ = parts[0].(string)
+		batch, _ := parts[1].([]interface{})
+		for _, key := range batch {
+			if s, ok := key.(string); ok {
+				keys = append(keys, s)
+			}
+		}
+
+		if "0" == cursor || "" == cursor {
+			break
+		}
+	}
+
+	result := make(map[string]string)
+	if len(keys) == 0 {
+		return result, nil
+	}
+
+	reply, err := p.do(append([]string{"MGET"}, keys...)...)
+	if nil != err {
+		return nil, err
+	}
+
+	values, _ := reply.([]interface{})
+	for i, value := range values {
+		// Keys which expired between SCAN and MGET are returned as nil
+		if s, ok := value.(string); ok && i < len(keys) {
+			result[keys[i]] = s
+		}
+	}
+
+	return result, nil
+}
+
+// transaction runs an optimistic WATCH/MULTI/EXEC transaction on the key. The prepare
+// function runs after the key is watched and returns the commands to queue, or nil to
+// abort. The transaction is retried if a concurrent write to the key aborts it.
+func (p *RedisBackingStore) transaction(key string, prepare func(rc *redisConn) ([][]string, error)) (bool, error) {
+	if nil == p.pool {
+		return false, ErrNotInitialized
+	}
+
+	rc, err := p.pool.get()
+	if nil != err {
+		return false, err
+	}
+
+	defer p.pool.put(rc)
+
+	for attempt := 0; attempt < RedisMaxTransactionAttempts; attempt++ {
+		if _, err = rc.do("WATCH", key); nil != err {
+			return false, err
+		}
+
+		commands, err := prepare(rc)
+		if nil != err || nil == commands {
+			rc.do("UNWATCH")
+			return false, err
+		}
+
+		if _, err = rc.do("MULTI"); nil != err {
+			return false, err
+		}
+
+		for _, command := range commands {
+			if _, err = rc.do(command...); nil != err {
+				rc.do("DISCARD")
+				return false, err
+			}
+		}
+
+		_, err = rc.do("EXEC")
+		if errRedisNil == err {
+			continue
+		}
+
+		return nil == err, err
+	}
+
+	return false, errors.New("redis: transaction aborted by concurrent writes")
+}
+
+func (p *RedisBackingStore) CompareAndSwap(key string, previous string, next string) (bool, error) {
+	return p.transaction(key, func(rc *redisConn) ([][]string, error) {
+		current, err := rc.do("GET", key)
+		if errRedisNil == err {
+			return nil, nil
+		}
+
+		if nil != err || current.(string) != previous {
+			return nil, err
+		}
+
+		reply, err := rc.do("PTTL", key)
+		if nil != err {
+			return nil, err
+		}
+
+		// Preserve the remaining expiry of the key
+		ttl := time.Duration(0)
+		if milliseconds, _ := reply.(int64); milliseconds > 0 {
+			ttl = time.Duration(milliseconds) * time.Millisecond
+		}
+
+		return [][]string{redisSetCommand(key, next, ttl)}, nil
+	})
+}
+
+func (p *RedisBackingStore) SetIfAbsent(key string, value string, ttl time.Duration) (bool, error) {
+	_, err := p.do(redisSetCommand(key, value, ttl, "NX")...)
+	if errRedisNil == err {
+		return false, nil
+	}
+
+	return nil == err, err
+}
+
+func (p *RedisBackingStore) SetIfChanged(key string, value string) (bool, error) {
+	return p.transaction(key, func(rc *redisConn) ([][]string, error) {
+		current, err := rc.do("GET", key)
+		if nil == err && current.(string) == value {
+			return nil, nil
+		}
+
+		if nil != err && errRedisNil != err {
+			return nil, err
+		}
+
+		return [][]string{redisSetCommand(key, value, 0)}, nil
+	})
+}
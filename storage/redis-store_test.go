@@ -0,0 +1,78 @@
+package storage_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/storage"
+	"github.com/mbolt35/multi-twitch-discord-bot/storage/redistest"
+	"github.com/mbolt35/multi-twitch-discord-bot/storage/storagetest"
+)
+
+func TestRedisStoreConformance(t *testing.T) {
+	var servers []*redistest.Server
+	defer func() {
+		for _, server := range servers {
+			server.Close()
+		}
+	}()
+
+	storagetest.RunConformance(t, func(t *testing.T) storage.BackingStore {
+		server, err := redistest.NewServer()
+		if nil != err {
+			t.Fatal(err)
+		}
+		servers = append(servers, server)
+
+		server.RequirePassword("secret")
+		store := storage.NewRedisStore("redis://:secret@" + server.Addr() + "/2")
+		if err := store.Init(); nil != err {
+			t.Fatal(err)
+		}
+
+		return store
+	})
+}
+
+func TestRedisStoreRequiresPassword(t *testing.T) {
+	server, err := redistest.NewServer()
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	server.RequirePassword("secret")
+
+	if err := storage.NewRedisStore(server.Url()).Init(); nil == err {
+		t.Fatal("expected Init without the password to fail")
+	}
+
+	if err := storage.NewRedisStore("redis://:wrong@" + server.Addr()).Init(); nil == err {
+		t.Fatal("expected Init with the wrong password to fail")
+	}
+}
+
+func TestRedisStoreFailsAfterClose(t *testing.T) {
+	server, err := redistest.NewServer()
+	if nil != err {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	store := storage.NewRedisStore(server.Url())
+	if err := store.Init(); nil != err {
+		t.Fatal(err)
+	}
+
+	if err := store.Set("key", "value"); nil != err {
+		t.Fatal(err)
+	}
+
+	if err := store.(io.Closer).Close(); nil != err {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Get("key"); nil == err {
+		t.Fatal("expected commands to fail once the store is closed")
+	}
+}
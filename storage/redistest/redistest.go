@@ -0,0 +1,516 @@
+// Package redistest provides an in-process stand-in for a redis server, supporting the
+// subset of commands used by storage.RedisBackingStore.
+package redistest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// entry is a single value held by the Server
+type entry struct {
+	value   string
+	expires time.Time
+}
+
+// Server is an in-process redis server listening on a local port
+type Server struct {
+	listener net.Listener
+	lock     sync.Mutex
+	data     map[string]entry
+	versions map[string]int64
+	version  int64
+	password string
+	wait     sync.WaitGroup
+}
+
+// session is the per connection state of a client
+type session struct {
+	authenticated bool
+	watched       map[string]int64
+	queued        [][]string
+	inMulti       bool
+}
+
+// NewServer starts a new Server on a random local port
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if nil != err {
+		return nil, err
+	}
+
+	instance := &Server{
+		listener: listener,
+		data:     make(map[string]entry),
+		versions: make(map[string]int64),
+	}
+
+	instance.wait.Add(1)
+	go instance.serve()
+
+	return instance, nil
+}
+
+// RequirePassword requires clients to AUTH with the password before running commands
+func (s *Server) RequirePassword(password string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.password = password
+}
+
+// Addr returns the host:port the server is listening on
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Url returns a redis:// url for connecting to the server
+func (s *Server) Url() string {
+	return "redis://" + s.Addr()
+}
+
+// Close stops accepting connections
+func (s *Server) Close() {
+	s.listener.Close()
+	s.wait.Wait()
+}
+
+// FastForward advances the expiry clock by moving every expiration earlier
+func (s *Server) FastForward(d time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for key, e := range s.data {
+		if !e.expires.IsZero() {
+			e.expires = e.expires.Add(-d)
+			s.data[key] = e
+		}
+	}
+}
+
+// serve accepts connections until the listener is closed
+func (s *Server) serve() {
+	defer s.wait.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if nil != err {
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+// handle reads and executes commands from a single connection
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	writer := bufio.NewWriter(conn)
+	state := &session{}
+
+	for {
+		command, err := readCommand(reader)
+		if nil != err {
+			return
+		}
+
+		s.execute(state, command, writer)
+		if nil != writer.Flush() {
+			return
+		}
+	}
+}
+
+// readCommand reads a RESP array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if nil != err {
+		return nil, err
+	}
+
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "*") {
+		return strings.Fields(line), nil
+	}
+
+	count, err := strconv.Atoi(line[1:])
+	if nil != err {
+		return nil, err
+	}
+
+	args := make([]string, count)
+	for i := range args {
+		header, err := r.ReadString('\n')
+		if nil != err {
+			return nil, err
+		}
+
+		length, err := strconv.Atoi(strings.TrimRight(header, "\r\n")[1:])
+		if nil != err {
+			return nil, err
+		}
+
+		data := make([]byte, length+2)
+		if _, err = io.ReadFull(r, data); nil != err {
+			return nil, err
+		}
+
+		args[i] = string(data[:length])
+	}
+
+	return args, nil
+}
+
+// writeSimple writes a RESP simple string
+func writeSimple(w *bufio.Writer, s string) {
+	fmt.Fprintf(w, "+%s\r\n", s)
+}
+
+// writeError writes a RESP error
+func writeError(w *bufio.Writer, s string) {
+	fmt.Fprintf(w, "-%s\r\n", s)
+}
+
+// writeInteger writes a RESP integer
+func writeInteger(w *bufio.Writer, i int64) {
+	fmt.Fprintf(w, ":%d\r\n", i)
+}
+
+// writeBulk writes a RESP bulk string
+func writeBulk(w *bufio.Writer, s string) {
+	fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s)
+}
+
+// writeNil writes a RESP null bulk string
+func writeNil(w *bufio.Writer) {
+	fmt.Fprintf(w, "$-1\r\n")
+}
+
+// writeArrayHeader writes the header of a RESP array with n elements
+func writeArrayHeader(w *bufio.Writer, n int) {
+	fmt.Fprintf(w, "*%d\r\n", n)
+}
+
+// execute runs a single command, queueing it if a MULTI is in progress
+func (s *Server) execute(state *session, command []string, w *bufio.Writer) {
+	if len(command) == 0 {
+		writeError(w, "ERR empty command")
+		return
+	}
+
+	name := strings.ToUpper(command[0])
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if "" != s.password && !state.authenticated && "AUTH" != name {
+		writeError(w, "NOAUTH Authentication required.")
+		return
+	}
+
+	switch name {
+	case "AUTH":
+		if len(command) != 2 || command[1] != s.password {
+			writeError(w, "WRONGPASS invalid password")
+			return
+		}
+		state.authenticated = true
+		writeSimple(w, "OK")
+		return
+
+	case "MULTI":
+		state.inMulti = true
+		state.queued = nil
+		writeSimple(w, "OK")
+		return
+
+	case "DISCARD":
+		state.inMulti = false
+		state.queued = nil
+		state.watched = nil
+		writeSimple(w, "OK")
+		return
+
+	case "EXEC":
+		s.exec(state, w)
+		return
+
+	case "WATCH":
+		if nil == state.watched {
+			state.watched = make(map[string]int64)
+		}
+		for _, key := range command[1:] {
+			state.watched[key] = s.versions[key]
+		}
+		writeSimple(w, "OK")
+		return
+
+	case "UNWATCH":
+		state.watched = nil
+		writeSimple(w, "OK")
+		return
+	}
+
+	if state.inMulti {
+		state.queued = append(state.queued, command)
+		writeSimple(w, "QUEUED")
+		return
+	}
+
+	s.run(name, command[1:], w)
+}
+
+// exec runs all queued commands unless a watched key was modified
+func (s *Server) exec(state *session, w *bufio.Writer) {
+	queued := state.queued
+	watched := state.watched
+	inMulti := state.inMulti
+
+	state.inMulti = false
+	state.queued = nil
+	state.watched = nil
+
+	if !inMulti {
+		writeError(w, "ERR EXEC without MULTI")
+		return
+	}
+
+	s.expireAll()
+	for key, version := range watched {
+		if s.versions[key] != version {
+			fmt.Fprintf(w, "*-1\r\n")
+			return
+		}
+	}
+
+	writeArrayHeader(w, len(queued))
+	for _, command := range queued {
+		s.run(strings.ToUpper(command[0]), command[1:], w)
+	}
+}
+
+// touch records a modification to the key, invalidating any WATCH on it
+func (s *Server) touch(key string) {
+	s.version++
+	s.versions[key] = s.version
+}
+
+// lookup returns the live entry for the key, expiring it if needed
+func (s *Server) lookup(key string) (entry, bool) {
+	e, ok := s.data[key]
+	if ok && !e.expires.IsZero() && !time.Now().Before(e.expires) {
+		delete(s.data, key)
+		s.touch(key)
+		return e, false
+	}
+
+	return e, ok
+}
+
+// expireAll removes every expired entry
+func (s *Server) expireAll() {
+	for key := range s.data {
+		s.lookup(key)
+	}
+}
+
+// run executes a single non-transactional command
+func (s *Server) run(name string, args []string, w *bufio.Writer) {
+	switch name {
+	case "PING":
+		writeSimple(w, "PONG")
+
+	case "SELECT", "FLUSHDB":
+		if "FLUSHDB" == name {
+			for key := range s.data {
+				s.touch(key)
+			}
+			s.data = make(map[string]entry)
+		}
+		writeSimple(w, "OK")
+
+	case "GET":
+		if len(args) != 1 {
+			writeError(w, "ERR wrong number of arguments for 'get' command")
+			return
+		}
+
+		if e, ok := s.lookup(args[0]); ok {
+			writeBulk(w, e.value)
+		} else {
+			writeNil(w)
+		}
+
+	case "SET":
+		s.set(args, w)
+
+	case "DEL":
+		var count int64
+		for _, key := range args {
+			if _, ok := s.lookup(key); ok {
+				delete(s.data, key)
+				s.touch(key)
+				count++
+			}
+		}
+		writeInteger(w, count)
+
+	case "MGET":
+		writeArrayHeader(w, len(args))
+		for _, key := range args {
+			if e, ok := s.lookup(key); ok {
+				writeBulk(w, e.value)
+			} else {
+				writeNil(w)
+			}
+		}
+
+	case "PTTL":
+		if len(args) != 1 {
+			writeError(w, "ERR wrong number of arguments for 'pttl' command")
+			return
+		}
+
+		e, ok := s.lookup(args[0])
+		switch {
+		case !ok:
+			writeInteger(w, -2)
+		case e.expires.IsZero():
+			writeInteger(w, -1)
+		default:
+			writeInteger(w, int64(time.Until(e.expires)/time.Millisecond))
+		}
+
+	case "SCAN":
+		s.scan(args, w)
+
+	default:
+		writeError(w, "ERR unknown command '"+name+"'")
+	}
+}
+
+// set implements SET key value [EX seconds|PX milliseconds] [NX|XX]
+func (s *Server) set(args []string, w *bufio.Writer) {
+	if len(args) < 2 {
+		writeError(w, "ERR wrong number of arguments for 'set' command")
+		return
+	}
+
+	key, value := args[0], args[1]
+	expires := time.Time{}
+	nx, xx := false, false
+
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(args[i])
+		switch option {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 >= len(args) {
+				writeError(w, "ERR syntax error")
+				return
+			}
+
+			amount, err := strconv.ParseInt(args[i+1], 10, 64)
+			if nil != err || amount <= 0 {
+				writeError(w, "ERR invalid expire time in 'set' command")
+				return
+			}
+
+			unit := time.Millisecond
+			if "EX" == option {
+				unit = time.Second
+			}
+
+			expires = time.Now().Add(time.Duration(amount) * unit)
+			i++
+		default:
+			writeError(w, "ERR syntax error")
+			return
+		}
+	}
+
+	_, exists := s.lookup(key)
+	if (nx && exists) || (xx && !exists) {
+		writeNil(w)
+		return
+	}
+
+	s.data[key] = entry{value: value, expires: expires}
+	s.touch(key)
+	writeSimple(w, "OK")
+}
+
+// scan implements SCAN cursor [MATCH pattern] [COUNT count], returning all matches at once
+func (s *Server) scan(args []string, w *bufio.Writer) {
+	pattern := "*"
+	for i := 1; i+1 < len(args); i += 2 {
+		if "MATCH" == strings.ToUpper(args[i]) {
+			pattern = args[i+1]
+		}
+	}
+
+	s.expireAll()
+
+	keys := []string{}
+	for key := range s.data {
+		if match(pattern, key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	writeArrayHeader(w, 2)
+	writeBulk(w, "0")
+	writeArrayHeader(w, len(keys))
+	for _, key := range keys {
+		writeBulk(w, key)
+	}
+}
+
+// match implements redis glob matching of * and ? with backslash escapes
+func match(pattern string, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if match(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+
+		case '\\':
+			if len(pattern) > 1 {
+				pattern = pattern[1:]
+			}
+			fallthrough
+
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+
+		pattern = pattern[1:]
+		s = s[1:]
+	}
+
+	return len(s) == 0
+}
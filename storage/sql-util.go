@@ -0,0 +1,58 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// PoolOptions limits the connections held by a SQL backed store
+type PoolOptions struct {
+	// MaxOpenConnections is the maximum number of open connections, or 0 for unlimited
+	MaxOpenConnections int
+
+	// MaxIdleConnections is the maximum number of idle connections kept for reuse
+	MaxIdleConnections int
+
+	// ConnectionMaxLifetime is how long a connection may be reused, or 0 for forever
+	ConnectionMaxLifetime time.Duration
+}
+
+// DefaultPoolOptions stay well under the connection limit of a hobby Postgres database
+var DefaultPoolOptions = PoolOptions{
+	MaxOpenConnections:    10,
+	MaxIdleConnections:    5,
+	ConnectionMaxLifetime: 30 * time.Minute,
+}
+
+// apply configures the connection pool of the database
+func (o PoolOptions) apply(db *sql.DB) {
+	db.SetMaxOpenConns(o.MaxOpenConnections)
+	db.SetMaxIdleConns(o.MaxIdleConnections)
+	db.SetConnMaxLifetime(o.ConnectionMaxLifetime)
+}
+
+// preparedStatement pairs a statement field with the SQL it is prepared from
+type preparedStatement struct {
+	statement **sql.Stmt
+	query     string
+}
+
+// prepareStatements prepares every statement, closing those already prepared if any fail
+func prepareStatements(db *sql.DB, statements []preparedStatement) error {
+	for i, s := range statements {
+		prepared, err := db.Prepare(s.query)
+		if nil != err {
+			for _, done := range statements[:i] {
+				(*done.statement).Close()
+				*done.statement = nil
+			}
+
+			return fmt.Errorf("Failed to prepare %q: %s", s.query, err)
+		}
+
+		*s.statement = prepared
+	}
+
+	return nil
+}
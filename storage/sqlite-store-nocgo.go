@@ -0,0 +1,71 @@
+//go:build !cgo
+// +build !cgo
+
+package storage
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrSqliteUnavailable is returned by the SQLite store in builds without cgo, which the
+// SQLite driver requires
+var ErrSqliteUnavailable = errors.New("storage: SQLite requires a build with cgo enabled")
+
+// SqliteBackingStore stands in for the SQLite store in builds without cgo. Every method
+// fails with ErrSqliteUnavailable.
+type SqliteBackingStore struct {
+	path string
+}
+
+// Ensure we correctly implement BackingStore
+var _ BackingStore = &SqliteBackingStore{}
+
+// NewSqliteStore creates a store which fails to initialize, as SQLite is unavailable
+func NewSqliteStore(path string) BackingStore {
+	instance := SqliteBackingStore{
+		path: path,
+	}
+
+	return &instance
+}
+
+func (p *SqliteBackingStore) Init() error {
+	return ErrSqliteUnavailable
+}
+
+func (p *SqliteBackingStore) Ping() error {
+	return ErrSqliteUnavailable
+}
+
+func (p *SqliteBackingStore) Get(key string) (string, error) {
+	return "", ErrSqliteUnavailable
+}
+
+func (p *SqliteBackingStore) Set(key string, value string) error {
+	return ErrSqliteUnavailable
+}
+
+func (p *SqliteBackingStore) SetWithTTL(key string, value string, ttl time.Duration) error {
+	return ErrSqliteUnavailable
+}
+
+func (p *SqliteBackingStore) Delete(key string) error {
+	return ErrSqliteUnavailable
+}
+
+func (p *SqliteBackingStore) List(prefix string) (map[string]string, error) {
+	return nil, ErrSqliteUnavailable
+}
+
+func (p *SqliteBackingStore) CompareAndSwap(key string, previous string, next string) (bool, error) {
+	return false, ErrSqliteUnavailable
+}
+
+func (p *SqliteBackingStore) SetIfAbsent(key string, value string, ttl time.Duration) (bool, error) {
+	return false, ErrSqliteUnavailable
+}
+
+func (p *SqliteBackingStore) SetIfChanged(key string, value string) (bool, error) {
+	return false, ErrSqliteUnavailable
+}
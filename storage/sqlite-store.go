@@ -0,0 +1,297 @@
+//go:build cgo
+// +build cgo
+
+package storage
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	// DatabaseSqliteType is the SQL driver type used when opening a SQLite database file
+	DatabaseSqliteType string = "sqlite3"
+
+	// SqliteConnectionOptions are appended to the database path when opening a connection.
+	// Immediate transactions take the database write lock on BEGIN, which serializes
+	// migrations across processes sharing the same file.
+	SqliteConnectionOptions string = "_txlock=immediate&_busy_timeout=5000&_journal_mode=WAL"
+
+	// SqliteCreateTableSql creates the store table, with expiration stored in unix milliseconds
+	SqliteCreateTableSql string = `CREATE TABLE IF NOT EXISTS store (
+                                key text not null,
+                                value text not null,
+                                expires_at integer,
+                                PRIMARY KEY(key));`
+
+	// SqliteGetQuery is the SQL which looks up a value from storage given a key
+	SqliteGetQuery string = `SELECT value, expires_at FROM store WHERE key=?1
+                                AND (expires_at IS NULL OR expires_at > ?2)`
+
+	// SqliteSetStatement is the SQL which inserts a new value and expiration for the provided key
+	SqliteSetStatement string = `INSERT INTO store(key, value, expires_at) VALUES(?1, ?2, ?3)
+                                ON CONFLICT (key) DO UPDATE SET value=excluded.value, expires_at=excluded.expires_at`
+
+	// SqliteDeleteStatement is the SQL which removes the provided key
+	SqliteDeleteStatement string = "DELETE FROM store WHERE key=?1"
+
+	// SqliteListQuery is the SQL which looks up all keys and values matching a LIKE pattern
+	SqliteListQuery string = `SELECT key, value FROM store WHERE key LIKE ?1 ESCAPE '\'
+                                AND (expires_at IS NULL OR expires_at > ?2)`
+
+	// SqliteCompareAndSwapStatement is the SQL which replaces the value for a key only if it
+	// currently holds the expected value
+	SqliteCompareAndSwapStatement string = `UPDATE store SET value=?3 WHERE key=?1 AND value=?2
+                                AND (expires_at IS NULL OR expires_at > ?4)`
+
+	// SqliteSetIfAbsentQuery is the SQL which inserts a value for the provided key only if there
+	// is no live entry, returning the key if the value was stored
+	SqliteSetIfAbsentQuery string = `INSERT INTO store(key, value, expires_at) VALUES(?1, ?2, ?3)
+                                ON CONFLICT (key) DO UPDATE SET value=excluded.value, expires_at=excluded.expires_at
+                                WHERE store.expires_at IS NOT NULL AND store.expires_at <= ?4
+                                RETURNING key`
+
+	// SqliteSetIfChangedQuery is the SQL which stores a value for the provided key unless it
+	// already holds the same live value, returning the key if the value was stored
+	SqliteSetIfChangedQuery string = `INSERT INTO store(key, value) VALUES(?1, ?2)
+                                ON CONFLICT (key) DO UPDATE SET value=excluded.value, expires_at=NULL
+                                WHERE store.value <> excluded.value
+                                OR (store.expires_at IS NOT NULL AND store.expires_at <= ?3)
+                                RETURNING key`
+
+	// SqlitePurgeExpiredStatement is the SQL which removes all expired keys
+	SqlitePurgeExpiredStatement string = "DELETE FROM store WHERE expires_at <= ?1"
+)
+
+// SqliteMigrations are the ordered schema migrations for the SQLite store. Existing
+// entries must never be changed; append a new Migration instead.
+var SqliteMigrations = []Migration{
+	{
+		Version:     1,
+		Description: "create store table",
+		Statements:  []string{SqliteCreateTableSql},
+	},
+}
+
+// SqliteBackingStore is the implementation of BackingStore with a SQLite database file
+type SqliteBackingStore struct {
+	path                    string
+	db                      *sql.DB
+	getQuery                *sql.Stmt
+	setStatement            *sql.Stmt
+	deleteStatement         *sql.Stmt
+	listQuery               *sql.Stmt
+	compareAndSwapStatement *sql.Stmt
+	setIfAbsentQuery        *sql.Stmt
+	setIfChangedQuery       *sql.Stmt
+}
+
+// Ensure we correctly implement BackingStore
+var _ BackingStore = &SqliteBackingStore{}
+var _ ExpiringGetter = &SqliteBackingStore{}
+
+// NewSqliteStore creates a new BackingStore implementation using the SQLite database file
+func NewSqliteStore(path string) BackingStore {
+	instance := SqliteBackingStore{
+		path: path,
+	}
+
+	return &instance
+}
+
+// sqliteTime returns the time in the unix millisecond format used for expiration
+func sqliteTime(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// sqliteExpiry returns the expiration for a ttl, or nil if the ttl never expires
+func sqliteExpiry(ttl time.Duration) interface{} {
+	expires := expiryFor(time.Now(), ttl)
+	if expires.IsZero() {
+		return nil
+	}
+
+	return sqliteTime(expires)
+}
+
+func (p *SqliteBackingStore) Init() error {
+	separator := "?"
+	if strings.Contains(p.path, "?") {
+		separator = "&"
+	}
+
+	db, err := sql.Open(DatabaseSqliteType, p.path+separator+SqliteConnectionOptions)
+	if err != nil {
+		return err
+	}
+
+	err = p.initDatabase(db)
+	if nil != err {
+		db.Close()
+		return err
+	}
+
+	p.db = db
+	return nil
+}
+
+// initDatabase verifies the connection, migrates the schema and prepares all statements
+func (p *SqliteBackingStore) initDatabase(db *sql.DB) error {
+	if err := db.Ping(); err != nil {
+		return err
+	}
+
+	err := NewMigrator(db, "", SqliteMigrations).Migrate()
+	if nil != err {
+		return err
+	}
+
+	_, err = db.Exec(SqlitePurgeExpiredStatement, sqliteTime(time.Now()))
+	if nil != err {
+		return err
+	}
+
+	return prepareStatements(db, []preparedStatement{
+		{&p.getQuery, SqliteGetQuery},
+		{&p.setStatement, SqliteSetStatement},
+		{&p.deleteStatement, SqliteDeleteStatement},
+		{&p.listQuery, SqliteListQuery},
+		{&p.compareAndSwapStatement, SqliteCompareAndSwapStatement},
+		{&p.setIfAbsentQuery, SqliteSetIfAbsentQuery},
+		{&p.setIfChangedQuery, SqliteSetIfChangedQuery},
+	})
+}
+
+func (p *SqliteBackingStore) Ping() error {
+	if nil == p.db {
+		return ErrNotInitialized
+	}
+
+	return p.db.Ping()
+}
+
+// Close closes the database, after which every method fails
+func (p *SqliteBackingStore) Close() error {
+	if nil == p.db {
+		return nil
+	}
+
+	return p.db.Close()
+}
+
+func (p *SqliteBackingStore) Get(key string) (string, error) {
+	value, _, err := p.GetWithExpiry(key)
+	return value, err
+}
+
+func (p *SqliteBackingStore) GetWithExpiry(key string) (string, time.Time, error) {
+	if nil == p.db {
+		return "", time.Time{}, ErrNotInitialized
+	}
+
+	var value string
+	var expires sql.NullInt64
+
+	err := p.getQuery.QueryRow(key, sqliteTime(time.Now())).Scan(&value, &expires)
+	if sql.ErrNoRows == err {
+		return "", time.Time{}, ErrNotFound
+	}
+
+	if nil != err {
+		return "", time.Time{}, err
+	}
+
+	if !expires.Valid {
+		return value, time.Time{}, nil
+	}
+
+	return value, time.Unix(0, expires.Int64*int64(time.Millisecond)), nil
+}
+
+func (p *SqliteBackingStore) Set(key string, value string) error {
+	return p.SetWithTTL(key, value, 0)
+}
+
+func (p *SqliteBackingStore) SetWithTTL(key string, value string, ttl time.Duration) error {
+	if nil == p.db {
+		return ErrNotInitialized
+	}
+
+	_, err := p.setStatement.Exec(key, value, sqliteExpiry(ttl))
+	return err
+}
+
+func (p *SqliteBackingStore) Delete(key string) error {
+	if nil == p.db {
+		return ErrNotInitialized
+	}
+
+	_, err := p.deleteStatement.Exec(key)
+	return err
+}
+
+func (p *SqliteBackingStore) List(prefix string) (map[string]string, error) {
+	if nil == p.db {
+		return nil, ErrNotInitialized
+	}
+
+	rows, err := p.listQuery.Query(escapeLikePattern(prefix)+"%", sqliteTime(time.Now()))
+	if nil != err {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	result := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err = rows.Scan(&key, &value); nil != err {
+			return nil, err
+		}
+
+		// LIKE is case insensitive in SQLite, so the prefix is checked exactly here
+		if strings.HasPrefix(key, prefix) {
+			result[key] = value
+		}
+	}
+
+	return result, rows.Err()
+}
+
+func (p *SqliteBackingStore) CompareAndSwap(key string, previous string, next string) (bool, error) {
+	if nil == p.db {
+		return false, ErrNotInitialized
+	}
+
+	result, err := p.compareAndSwapStatement.Exec(key, previous, next, sqliteTime(time.Now()))
+	if nil != err {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if nil != err {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+func (p *SqliteBackingStore) SetIfAbsent(key string, value string, ttl time.Duration) (bool, error) {
+	if nil == p.db {
+		return false, ErrNotInitialized
+	}
+
+	now := sqliteTime(time.Now())
+	return isReturned(p.setIfAbsentQuery.QueryRow(key, value, sqliteExpiry(ttl), now))
+}
+
+func (p *SqliteBackingStore) SetIfChanged(key string, value string) (bool, error) {
+	if nil == p.db {
+		return false, ErrNotInitialized
+	}
+
+	return isReturned(p.setIfChangedQuery.QueryRow(key, value, sqliteTime(time.Now())))
+}
@@ -0,0 +1,48 @@
+//go:build cgo
+// +build cgo
+
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/storage"
+	"github.com/mbolt35/multi-twitch-discord-bot/storage/storagetest"
+)
+
+func TestSqliteStoreConformance(t *testing.T) {
+	dirs := &tempDirs{}
+	defer dirs.remove()
+
+	storagetest.RunConformance(t, func(t *testing.T) storage.BackingStore {
+		store := storage.NewSqliteStore(dirs.path(t, "bot.db"))
+		if err := store.Init(); nil != err {
+			t.Fatal(err)
+		}
+
+		return store
+	})
+}
+
+func TestSqliteStorePersists(t *testing.T) {
+	dirs := &tempDirs{}
+	defer dirs.remove()
+
+	path := dirs.path(t, "bot.db")
+
+	first := storage.NewSqliteStore(path)
+	if err := first.Init(); nil != err {
+		t.Fatal(err)
+	}
+	first.Set("key", "value")
+
+	// A second store initialized on the same file finds the schema already migrated
+	second := storage.NewSqliteStore(path)
+	if err := second.Init(); nil != err {
+		t.Fatal(err)
+	}
+
+	if value, err := second.Get("key"); nil != err || "value" != value {
+		t.Fatalf("expected the value to persist, got %q, %v", value, err)
+	}
+}
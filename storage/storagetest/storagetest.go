@@ -0,0 +1,329 @@
+// Package storagetest provides a conformance suite which every storage.BackingStore
+// implementation is expected to pass.
+package storagetest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/storage"
+)
+
+// Factory creates a new, initialized and empty BackingStore for a single test
+type Factory func(t *testing.T) storage.BackingStore
+
+// RunConformance runs the full BackingStore conformance suite against stores created by
+// the factory
+func RunConformance(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store storage.BackingStore)
+	}{
+		{"GetMissing", testGetMissing},
+		{"SetGet", testSetGet},
+		{"SetEmptyValue", testSetEmptyValue},
+		{"Overwrite", testOverwrite},
+		{"Delete", testDelete},
+		{"List", testList},
+		{"ListEscapesWildcards", testListEscapesWildcards},
+		{"TTL", testTTL},
+		{"SetClearsTTL", testSetClearsTTL},
+		{"CompareAndSwap", testCompareAndSwap},
+		{"SetIfAbsent", testSetIfAbsent},
+		{"SetIfAbsentExpired", testSetIfAbsentExpired},
+		{"SetIfChanged", testSetIfChanged},
+		{"ConcurrentSetIfAbsent", testConcurrentSetIfAbsent},
+		{"ConcurrentSetIfChanged", testConcurrentSetIfChanged},
+	}
+
+	for _, tc := range tests {
+		test := tc.test
+		t.Run(tc.name, func(t *testing.T) {
+			test(t, factory(t))
+		})
+	}
+}
+
+// mustSet sets a key or fails the test
+func mustSet(t *testing.T, store storage.BackingStore, key string, value string) {
+	t.Helper()
+
+	if err := store.Set(key, value); nil != err {
+		t.Fatalf("Set(%q) failed: %s", key, err)
+	}
+}
+
+// expectValue fails the test if the key does not hold the expected value
+func expectValue(t *testing.T, store storage.BackingStore, key string, expected string) {
+	t.Helper()
+
+	value, err := store.Get(key)
+	if nil != err {
+		t.Fatalf("Get(%q) failed: %s", key, err)
+	}
+
+	if value != expected {
+		t.Fatalf("Get(%q) = %q, expected %q", key, value, expected)
+	}
+}
+
+// expectNotFound fails the test if the key exists
+func expectNotFound(t *testing.T, store storage.BackingStore, key string) {
+	t.Helper()
+
+	value, err := store.Get(key)
+	if storage.ErrNotFound != err {
+		t.Fatalf("Get(%q) = %q, %v, expected ErrNotFound", key, value, err)
+	}
+}
+
+func testGetMissing(t *testing.T, store storage.BackingStore) {
+	expectNotFound(t, store, "missing")
+}
+
+func testSetGet(t *testing.T, store storage.BackingStore) {
+	mustSet(t, store, "key", "value")
+	expectValue(t, store, "key", "value")
+}
+
+func testSetEmptyValue(t *testing.T, store storage.BackingStore) {
+	mustSet(t, store, "empty", "")
+	expectValue(t, store, "empty", "")
+}
+
+func testOverwrite(t *testing.T, store storage.BackingStore) {
+	mustSet(t, store, "key", "first")
+	mustSet(t, store, "key", "second")
+	expectValue(t, store, "key", "second")
+}
+
+func testDelete(t *testing.T, store storage.BackingStore) {
+	mustSet(t, store, "key", "value")
+
+	if err := store.Delete("key"); nil != err {
+		t.Fatalf("Delete failed: %s", err)
+	}
+	expectNotFound(t, store, "key")
+
+	if err := store.Delete("key"); nil != err {
+		t.Fatalf("Delete of a missing key failed: %s", err)
+	}
+}
+
+func testList(t *testing.T, store storage.BackingStore) {
+	mustSet(t, store, "live:1", "a")
+	mustSet(t, store, "live:2", "b")
+	mustSet(t, store, "other:1", "c")
+
+	result, err := store.List("live:")
+	if nil != err {
+		t.Fatalf("List failed: %s", err)
+	}
+
+	if len(result) != 2 || result["live:1"] != "a" || result["live:2"] != "b" {
+		t.Fatalf("List(\"live:\") = %v", result)
+	}
+
+	all, err := store.List("")
+	if nil != err {
+		t.Fatalf("List failed: %s", err)
+	}
+
+	if len(all) != 3 {
+		t.Fatalf("List(\"\") returned %d entries, expected 3", len(all))
+	}
+}
+
+func testListEscapesWildcards(t *testing.T, store storage.BackingStore) {
+	mustSet(t, store, "a_b", "1")
+	mustSet(t, store, "axb", "2")
+	mustSet(t, store, "a%c", "3")
+
+	result, err := store.List("a_")
+	if nil != err {
+		t.Fatalf("List failed: %s", err)
+	}
+
+	if len(result) != 1 || result["a_b"] != "1" {
+		t.Fatalf("List(\"a_\") = %v", result)
+	}
+}
+
+func testTTL(t *testing.T, store storage.BackingStore) {
+	if err := store.SetWithTTL("short", "value", 50*time.Millisecond); nil != err {
+		t.Fatalf("SetWithTTL failed: %s", err)
+	}
+
+	if err := store.SetWithTTL("long", "value", time.Hour); nil != err {
+		t.Fatalf("SetWithTTL failed: %s", err)
+	}
+
+	expectValue(t, store, "short", "value")
+	time.Sleep(100 * time.Millisecond)
+
+	expectNotFound(t, store, "short")
+	expectValue(t, store, "long", "value")
+
+	result, err := store.List("")
+	if nil != err {
+		t.Fatalf("List failed: %s", err)
+	}
+
+	if _, ok := result["short"]; ok {
+		t.Fatalf("List returned an expired key")
+	}
+
+	swapped, err := store.CompareAndSwap("short", "value", "next")
+	if nil != err || swapped {
+		t.Fatalf("CompareAndSwap on an expired key = %v, %v", swapped, err)
+	}
+}
+
+func testSetClearsTTL(t *testing.T, store storage.BackingStore) {
+	if err := store.SetWithTTL("key", "first", 50*time.Millisecond); nil != err {
+		t.Fatalf("SetWithTTL failed: %s", err)
+	}
+
+	mustSet(t, store, "key", "second")
+	time.Sleep(100 * time.Millisecond)
+	expectValue(t, store, "key", "second")
+}
+
+func testCompareAndSwap(t *testing.T, store storage.BackingStore) {
+	swapped, err := store.CompareAndSwap("missing", "", "value")
+	if nil != err || swapped {
+		t.Fatalf("CompareAndSwap on a missing key = %v, %v", swapped, err)
+	}
+	expectNotFound(t, store, "missing")
+
+	mustSet(t, store, "key", "first")
+
+	swapped, err = store.CompareAndSwap("key", "wrong", "second")
+	if nil != err || swapped {
+		t.Fatalf("CompareAndSwap with the wrong previous value = %v, %v", swapped, err)
+	}
+	expectValue(t, store, "key", "first")
+
+	swapped, err = store.CompareAndSwap("key", "first", "second")
+	if nil != err || !swapped {
+		t.Fatalf("CompareAndSwap with the correct previous value = %v, %v", swapped, err)
+	}
+	expectValue(t, store, "key", "second")
+}
+
+func testSetIfAbsent(t *testing.T, store storage.BackingStore) {
+	stored, err := store.SetIfAbsent("key", "first", 0)
+	if nil != err || !stored {
+		t.Fatalf("SetIfAbsent on a missing key = %v, %v", stored, err)
+	}
+
+	stored, err = store.SetIfAbsent("key", "second", 0)
+	if nil != err || stored {
+		t.Fatalf("SetIfAbsent on an existing key = %v, %v", stored, err)
+	}
+	expectValue(t, store, "key", "first")
+}
+
+func testSetIfAbsentExpired(t *testing.T, store storage.BackingStore) {
+	stored, err := store.SetIfAbsent("key", "first", 50*time.Millisecond)
+	if nil != err || !stored {
+		t.Fatalf("SetIfAbsent on a missing key = %v, %v", stored, err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	stored, err = store.SetIfAbsent("key", "second", 0)
+	if nil != err || !stored {
+		t.Fatalf("SetIfAbsent on an expired key = %v, %v", stored, err)
+	}
+	expectValue(t, store, "key", "second")
+}
+
+func testSetIfChanged(t *testing.T, store storage.BackingStore) {
+	steps := []struct {
+		value    string
+		expected bool
+	}{
+		{"first", true},
+		{"first", false},
+		{"second", true},
+		{"second", false},
+		{"first", true},
+	}
+
+	for _, step := range steps {
+		changed, err := store.SetIfChanged("key", step.value)
+		if nil != err || changed != step.expected {
+			t.Fatalf("SetIfChanged(%q) = %v, %v, expected %v", step.value, changed, err, step.expected)
+		}
+		expectValue(t, store, "key", step.value)
+	}
+}
+
+// countConcurrent runs the operation from several goroutines at once, returning how many
+// of them reported success
+func countConcurrent(t *testing.T, operation func() (bool, error)) int {
+	const workers = 16
+
+	var wait sync.WaitGroup
+	results := make(chan error, workers)
+	succeeded := make(chan bool, workers)
+
+	for i := 0; i < workers; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+
+			ok, err := operation()
+			results <- err
+			succeeded <- ok
+		}()
+	}
+
+	wait.Wait()
+	close(results)
+	close(succeeded)
+
+	for err := range results {
+		if nil != err {
+			t.Fatalf("Concurrent operation failed: %s", err)
+		}
+	}
+
+	count := 0
+	for ok := range succeeded {
+		if ok {
+			count++
+		}
+	}
+
+	return count
+}
+
+func testConcurrentSetIfAbsent(t *testing.T, store storage.BackingStore) {
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("delivery:%d", i)
+		count := countConcurrent(t, func() (bool, error) {
+			return store.SetIfAbsent(key, "value", time.Hour)
+		})
+
+		if count != 1 {
+			t.Fatalf("%d concurrent SetIfAbsent calls stored %q, expected 1", count, key)
+		}
+	}
+}
+
+func testConcurrentSetIfChanged(t *testing.T, store storage.BackingStore) {
+	for i := 0; i < 5; i++ {
+		value := fmt.Sprintf("2019-01-0%dT00:00:00Z", i+1)
+		count := countConcurrent(t, func() (bool, error) {
+			return store.SetIfChanged("live", value)
+		})
+
+		if count != 1 {
+			t.Fatalf("%d concurrent SetIfChanged calls stored %q, expected 1", count, value)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+// TestUninitializedStores checks stores used before a successful Init fail with the same
+// error as Ping, ErrNotInitialized where the store is available, rather than panicking
+func TestUninitializedStores(t *testing.T) {
+	stores := map[string]BackingStore{
+		"postgres": NewPostgresStore("postgres://localhost/unused", DefaultPoolOptions),
+		"redis":    NewRedisStore("redis://localhost:6379"),
+		"sqlite":   NewSqliteStore("unused.db"),
+		"memory":   NewMemoryStore(),
+		"jsonfile": NewJsonFileStore("unused.json"),
+	}
+
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			expected := store.Ping()
+			if nil == expected {
+				t.Fatal("expected Ping to fail before Init")
+			}
+
+			checks := map[string]error{
+				"Set":    store.Set("key", "value"),
+				"Delete": store.Delete("key"),
+			}
+
+			_, checks["Get"] = store.Get("key")
+			_, checks["List"] = store.List("")
+			_, checks["CompareAndSwap"] = store.CompareAndSwap("key", "a", "b")
+			_, checks["SetIfAbsent"] = store.SetIfAbsent("key", "value", time.Minute)
+			_, checks["SetIfChanged"] = store.SetIfChanged("key", "value")
+
+			for method, err := range checks {
+				if expected != err {
+					t.Errorf("%s: expected %v, got %v", method, expected, err)
+				}
+			}
+		})
+	}
+}
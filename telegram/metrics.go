@@ -0,0 +1,7 @@
+package telegram
+
+import (
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+var requests = httputil.NewRequestMetrics("telegram", "Telegram Bot API")
@@ -0,0 +1,31 @@
+package telegram
+
+import (
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+// Options configures how a Telegram client communicates with the Telegram Bot API
+type Options struct {
+	// ApiUrl is the base url of the Telegram Bot API
+	ApiUrl string
+
+	// ClientOptions configure the http client and user agent
+	httputil.ClientOptions
+}
+
+// DefaultOptions communicate with the public Telegram Bot API
+var DefaultOptions = Options{
+	ApiUrl:        TelegramApiUrl,
+	ClientOptions: httputil.DefaultClientOptions,
+}
+
+// withDefaults returns the options with an empty url or user agent replaced by the defaults
+func (o Options) withDefaults() Options {
+	if "" == o.ApiUrl {
+		o.ApiUrl = DefaultOptions.ApiUrl
+	}
+
+	o.ClientOptions = o.ClientOptions.WithDefaults()
+
+	return o
+}
@@ -0,0 +1,218 @@
+// Package telegram announces go live events to Telegram chats and channels through the Bot
+// API, as a photo of the stream's thumbnail captioned with the announcement.
+package telegram
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/notifier"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+const (
+	// TelegramApiUrl is the base url of the public Telegram Bot API
+	TelegramApiUrl string = "https://api.telegram.org"
+
+	// SendMessageMethod sends a text message, for events without a thumbnail
+	SendMessageMethod string = "sendMessage"
+
+	// SendPhotoMethod sends a photo with a caption
+	SendPhotoMethod string = "sendPhoto"
+
+	// GetChatMethod looks up a chat
+	GetChatMethod string = "getChat"
+
+	// WatchButtonText labels the button linking to the stream
+	WatchButtonText string = "Watch on Twitch"
+
+	// MaxCaptionLength is the longest caption Telegram accepts with a photo
+	MaxCaptionLength int = 1024
+
+	// MarkdownV2ParseMode parses message text as Telegram's MarkdownV2
+	MarkdownV2ParseMode string = "MarkdownV2"
+)
+
+// markdownV2Replacer escapes every character MarkdownV2 reserves
+var markdownV2Replacer = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`)
+
+// Message is the request body of the sendMessage and sendPhoto methods. Photo is only sent
+// with sendPhoto, which takes the text as its caption.
+type Message struct {
+	ChatId      string          `json:"chat_id"`
+	Text        string          `json:"text,omitempty"`
+	Photo       string          `json:"photo,omitempty"`
+	Caption     string          `json:"caption,omitempty"`
+	ParseMode   string          `json:"parse_mode,omitempty"`
+	ReplyMarkup *InlineKeyboard `json:"reply_markup,omitempty"`
+}
+
+// InlineKeyboard is a row of buttons shown with a message
+type InlineKeyboard struct {
+	Buttons [][]InlineButton `json:"inline_keyboard"`
+}
+
+// InlineButton is a button which opens a url
+type InlineButton struct {
+	Text string `json:"text"`
+	Url  string `json:"url"`
+}
+
+// response is the body of every Bot API response
+type response struct {
+	Ok          bool   `json:"ok"`
+	Description string `json:"description"`
+}
+
+// telegram is a notifier.Notifier for a Telegram chat
+type telegram struct {
+	botToken   string
+	chatId     string
+	apiUrl     string
+	userAgent  string
+	httpClient *http.Client
+}
+
+var _ notifier.Notifier = &telegram{}
+var _ notifier.Escaper = &telegram{}
+
+// NewTelegram creates a Notifier which sends messages to the chat, which is an id or a
+// channel's @username, as the bot with the token. The bot must be a member of the chat.
+func NewTelegram(botToken string, chatId string, options Options) notifier.Notifier {
+	options = options.withDefaults()
+
+	instance := telegram{
+		botToken:   botToken,
+		chatId:     chatId,
+		apiUrl:     options.ApiUrl,
+		userAgent:  options.UserAgent,
+		httpClient: options.NewClient(),
+	}
+
+	return &instance
+}
+
+// EscapeMarkdownV2 escapes every character of s which MarkdownV2 would treat as formatting
+func EscapeMarkdownV2(s string) string {
+	return markdownV2Replacer.Replace(s)
+}
+
+// Escape leaves what templates insert into the message alone, since NewMessage escapes the
+// whole message, template text included, for MarkdownV2
+func (t *telegram) Escape(text string) string {
+	return text
+}
+
+// NewMessage returns the Bot API method and request announcing the event: a photo of the
+// thumbnail captioned with the message, or the message alone if there's no thumbnail or the
+// message is too long to be a caption. The message is shown exactly as rendered.
+func NewMessage(chatId string, message string, event notifier.Event) (string, Message) {
+	result := Message{
+		ChatId:    chatId,
+		ParseMode: MarkdownV2ParseMode,
+	}
+
+	if "" != event.Url {
+		result.ReplyMarkup = &InlineKeyboard{
+			Buttons: [][]InlineButton{{{Text: WatchButtonText, Url: event.Url}}},
+		}
+	}
+
+	thumbnail := event.Thumbnail()
+	if "" == thumbnail || len([]rune(message)) > MaxCaptionLength {
+		result.Text = EscapeMarkdownV2(message)
+		return SendMessageMethod, result
+	}
+
+	result.Photo = thumbnail
+	result.Caption = EscapeMarkdownV2(message)
+	return SendPhotoMethod, result
+}
+
+// getMethodUrl returns the url of the bot's Bot API method
+func getMethodUrl(apiUrl string, botToken string, method string) string {
+	return httputil.JoinUrl(apiUrl, "/bot"+botToken+"/"+method)
+}
+
+// Payload returns the request body announcing the event
+func (t *telegram) Payload(message string, event notifier.Event) (json.RawMessage, error) {
+	_, body := NewMessage(t.chatId, message, event)
+	return encode(body)
+}
+
+// Notify sends the photo or message announcing the event to the chat
+func (t *telegram) Notify(message string, event notifier.Event) error {
+	method, body := NewMessage(t.chatId, message, event)
+	jsonBytes, err := encode(body)
+	if nil != err {
+		return err
+	}
+
+	if err := t.call(method, bytes.NewReader(jsonBytes)); nil != err {
+		return err
+	}
+
+	logutil.Debug("Sent Telegram message", "chat_id", t.chatId, "method", method)
+	return nil
+}
+
+// Check verifies the bot token is accepted and the bot can see the chat, without sending a
+// message
+func (t *telegram) Check() error {
+	jsonBytes, err := encode(Message{ChatId: t.chatId})
+	if nil != err {
+		return err
+	}
+
+	return t.call(GetChatMethod, bytes.NewReader(jsonBytes))
+}
+
+// call calls the Bot API method, failing unless the response is ok
+func (t *telegram) call(method string, body io.Reader) error {
+	request, err := http.NewRequest(http.MethodPost, getMethodUrl(t.apiUrl, t.botToken, method), body)
+	if nil != err {
+		return err
+	}
+
+	request.Header.Set(httputil.HttpContentTypeHeader, httputil.JsonContentType)
+	request.Header.Set(httputil.HttpUserAgentHeader, t.userAgent)
+
+	resp, err := requests.Do(t.httpClient, request)
+	if nil != err {
+
+		// The url, and so the error, contains the bot token
+		return fmt.Errorf("Telegram %s failed: %s", method, logutil.Scrub(err.Error()))
+	}
+
+	defer resp.Body.Close()
+
+	var result response
+	if err := httputil.DecodeJson(resp.Body, &result); nil != err || !result.Ok {
+		if "" != result.Description {
+			return fmt.Errorf("Telegram %s returned %d: %s", method, resp.StatusCode, result.Description)
+		}
+
+		return fmt.Errorf("Telegram %s returned %s", method, resp.Status)
+	}
+
+	return nil
+}
+
+// encode encodes the request body without a trailing new line
+func encode(message Message) (json.RawMessage, error) {
+	jsonBytes, err := httputil.EncodeJson(message)
+	if nil != err {
+		return nil, err
+	}
+
+	return json.RawMessage(bytes.TrimSpace(jsonBytes)), nil
+}
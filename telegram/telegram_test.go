@@ -0,0 +1,151 @@
+package telegram_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/notifier"
+	"github.com/mbolt35/multi-twitch-discord-bot/telegram"
+)
+
+// botApi is a stand-in Bot API, recording the methods called
+type botApi struct {
+	*httptest.Server
+	lock    sync.Mutex
+	methods []string
+	bodies  []string
+}
+
+// newBotApi starts a Bot API which accepts the bot token
+func newBotApi(botToken string) *botApi {
+	instance := &botApi{}
+	instance.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+
+		if !strings.HasPrefix(request.URL.Path, "/bot"+botToken+"/") {
+			rw.WriteHeader(http.StatusUnauthorized)
+			rw.Write([]byte(`{"ok":false,"description":"Unauthorized"}`))
+			return
+		}
+
+		instance.lock.Lock()
+		instance.methods = append(instance.methods, strings.TrimPrefix(request.URL.Path, "/bot"+botToken+"/"))
+		instance.bodies = append(instance.bodies, string(body))
+		instance.lock.Unlock()
+
+		rw.Write([]byte(`{"ok":true}`))
+	}))
+
+	return instance
+}
+
+// Call returns the method called and its request body
+func (b *botApi) Call(i int) (string, string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.methods[i], b.bodies[i]
+}
+
+// options communicate with the Bot API
+func (b *botApi) options() telegram.Options {
+	options := telegram.DefaultOptions
+	options.ApiUrl = b.URL
+
+	return options
+}
+
+func TestNewMessage(t *testing.T) {
+	event := notifier.Event{
+		ThumbnailUrl: "https://static-cdn.jtvnw.net/previews-ttv/live_user_ab-{width}x{height}.jpg",
+		Url:          "http://twitch.tv/ab",
+	}
+
+	method, message := telegram.NewMessage("@channel", "live", event)
+	if telegram.SendPhotoMethod != method || "live" != message.Caption || "" != message.Text {
+		t.Fatalf("expected a captioned photo, got %s %+v", method, message)
+	}
+
+	if "https://static-cdn.jtvnw.net/previews-ttv/live_user_ab-1280x720.jpg" != message.Photo {
+		t.Errorf("got photo %q", message.Photo)
+	}
+
+	if button := message.ReplyMarkup.Buttons[0][0]; telegram.WatchButtonText != button.Text || event.Url != button.Url {
+		t.Errorf("got button %+v", button)
+	}
+
+	// Too long to be a caption
+	long := strings.Repeat("é", telegram.MaxCaptionLength+1)
+	if method, message := telegram.NewMessage("@channel", long, event); telegram.SendMessageMethod != method || long != message.Text {
+		t.Fatalf("expected a text message, got %s", method)
+	}
+
+	if method, message := telegram.NewMessage("@channel", "live", notifier.Event{}); telegram.SendMessageMethod != method || nil != message.ReplyMarkup {
+		t.Fatalf("expected a text message without a button, got %s %+v", method, message)
+	}
+}
+
+func TestNewMessageEscapesMarkdownV2(t *testing.T) {
+	method, message := telegram.NewMessage("@channel", "A_B *is* now live! http://twitch.tv/a_b", notifier.Event{})
+	if telegram.SendMessageMethod != method || telegram.MarkdownV2ParseMode != message.ParseMode {
+		t.Fatalf("expected a MarkdownV2 text message, got %s %+v", method, message)
+	}
+
+	if expected := `A\_B \*is\* now live\! http://twitch\.tv/a\_b`; expected != message.Text {
+		t.Fatalf("expected %q, got %q", expected, message.Text)
+	}
+
+	// The caption's length is what's shown, not what's escaped
+	event := notifier.Event{ThumbnailUrl: "https://static-cdn.jtvnw.net/previews-ttv/live_user_ab-{width}x{height}.jpg"}
+	caption := strings.Repeat(".", telegram.MaxCaptionLength)
+	if method, _ := telegram.NewMessage("@channel", caption, event); telegram.SendPhotoMethod != method {
+		t.Fatalf("expected a captioned photo, got %s", method)
+	}
+}
+
+func TestNotify(t *testing.T) {
+	server := newBotApi("token")
+	defer server.Close()
+
+	client := telegram.NewTelegram("token", "@channel", server.options())
+	event := notifier.Event{Url: "http://twitch.tv/ab"}
+	if err := client.Notify("live", event); nil != err {
+		t.Fatal(err)
+	}
+
+	method, body := server.Call(0)
+	payload, _ := client.Payload("live", event)
+	if telegram.SendMessageMethod != method || string(payload) != body {
+		t.Fatalf("expected the payload to be sent with %s, got %s %s", telegram.SendMessageMethod, method, body)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	server := newBotApi("token")
+	defer server.Close()
+
+	if err := telegram.NewTelegram("token", "@channel", server.options()).Check(); nil != err {
+		t.Fatal(err)
+	}
+
+	if method, body := server.Call(0); telegram.GetChatMethod != method || `{"chat_id":"@channel"}` != body {
+		t.Fatalf("expected the chat to be looked up, got %s %s", method, body)
+	}
+
+	err := telegram.NewTelegram("wrong", "@channel", server.options()).Check()
+	if nil == err || !strings.Contains(err.Error(), "Unauthorized") {
+		t.Fatalf("expected the Bot API's description to be reported, got %v", err)
+	}
+
+	// The url in network errors contains the bot token
+	options := telegram.DefaultOptions
+	options.ApiUrl = "http://127.0.0.1:1"
+	err = telegram.NewTelegram("123456:secret-token", "@channel", options).Check()
+	if nil == err || strings.Contains(err.Error(), "secret-token") {
+		t.Fatalf("expected the bot token to be scrubbed, got %v", err)
+	}
+}
@@ -0,0 +1,36 @@
+package twitch
+
+import (
+	"github.com/mbolt35/multi-twitch-discord-bot/metrics"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+const (
+	// usersEndPoint labels metrics for the user lookup API
+	usersEndPoint string = "users"
+
+	// gamesEndPoint labels metrics for the game lookup API
+	gamesEndPoint string = "games"
+
+	// webhooksEndPoint labels metrics for the web hook hub API
+	webhooksEndPoint string = "webhooks_hub"
+)
+
+// requests counts and times every request sent to the Twitch APIs
+var requests = httputil.NewRequestMetrics("twitch", "Twitch API")
+
+var apiRequests = metrics.NewCounter(
+	"twitch_api_requests_total",
+	"Requests made to the Twitch API, by end point and result.",
+	"endpoint", "result")
+
+// recordApiRequest counts a request to the Twitch API end point
+func recordApiRequest(endPoint string, err error) {
+	if nil != err {
+		apiRequests.Inc(endPoint, "error")
+		return
+	}
+
+	apiRequests.Inc(endPoint, "success")
+}
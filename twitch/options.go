@@ -0,0 +1,34 @@
+package twitch
+
+import (
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+// Options configures how a TwitchClient communicates with the Twitch APIs
+type Options struct {
+	// ApiUrl is the base url of the Twitch APIs
+	ApiUrl string
+
+	// ClientOptions configure the http client and user agent
+	httputil.ClientOptions
+
+	// Secret is sent with subscribe requests, so the hub signs the deliveries it sends with it
+	Secret string
+}
+
+// DefaultOptions communicate with the public Twitch APIs
+var DefaultOptions = Options{
+	ApiUrl:        TwitchApiUrl,
+	ClientOptions: httputil.DefaultClientOptions,
+}
+
+// withDefaults returns the options with any empty urls or user agent replaced by the defaults
+func (o Options) withDefaults() Options {
+	if "" == o.ApiUrl {
+		o.ApiUrl = DefaultOptions.ApiUrl
+	}
+
+	o.ClientOptions = o.ClientOptions.WithDefaults()
+
+	return o
+}
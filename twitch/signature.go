@@ -0,0 +1,53 @@
+package twitch
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// TwitchSignaturePrefix prefixes the hex encoded HMAC in the signature header
+	TwitchSignaturePrefix string = "sha256="
+
+	// secretBytes is the number of random bytes in a generated secret
+	secretBytes int = 32
+)
+
+// NewSecret generates a random secret for signing deliveries
+func NewSecret() (string, error) {
+	secret := make([]byte, secretBytes)
+	if _, err := rand.Read(secret); nil != err {
+		return "", err
+	}
+
+	return hex.EncodeToString(secret), nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the body keyed with the secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature determines whether the signature header value is the HMAC-SHA256 of the
+// body keyed with the secret, comparing them in constant time
+func VerifySignature(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, TwitchSignaturePrefix) {
+		return false
+	}
+
+	actual, err := hex.DecodeString(strings.TrimPrefix(signature, TwitchSignaturePrefix))
+	if nil != err {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hmac.Equal(actual, mac.Sum(nil))
+}
@@ -0,0 +1,57 @@
+package twitch_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+)
+
+func TestSign(t *testing.T) {
+	// printf '{"data": []}' | openssl dgst -sha256 -hmac secret
+	expected := "fd3d7a934e48a3b210e0a129548d079924a11c2528ad9699218966aed1fe2288"
+	if actual := twitch.Sign("secret", []byte(`{"data": []}`)); expected != actual {
+		t.Fatalf("expected %s, got %s", expected, actual)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"data": []}`)
+	digest := twitch.Sign("secret", body)
+
+	cases := map[string]bool{
+		"sha256=" + digest:                     true,
+		"":                                     false,
+		digest:                                 false,
+		"sha256=" + twitch.Sign("other", body): false,
+		"sha1=" + digest:                       false,
+		"sha256=" + digest[2:]:                 false,
+		"sha256=zz":                            false,
+	}
+
+	for header, expected := range cases {
+		if actual := twitch.VerifySignature("secret", body, header); expected != actual {
+			t.Errorf("VerifySignature(%q) = %v, expected %v", header, actual, expected)
+		}
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	first, err := twitch.NewSecret()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	second, err := twitch.NewSecret()
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if !regexp.MustCompile(`^[0-9a-f]{64}$`).MatchString(first) || first == second {
+		t.Fatalf("expected unique random secrets, got %q and %q", first, second)
+	}
+
+	if len(first) >= twitch.TwitchMaxSecretBytes {
+		t.Fatalf("expected the hub to accept the secret, got %d bytes", len(first))
+	}
+}
@@ -0,0 +1,249 @@
+package twitch
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// SubscriptionPending has been requested, but not yet verified by Twitch
+	SubscriptionPending string = "pending"
+
+	// SubscriptionVerified has been verified by Twitch and is receiving notifications
+	SubscriptionVerified string = "verified"
+
+	// SubscriptionDenied was refused by Twitch
+	SubscriptionDenied string = "denied"
+
+	// SubscriptionFailed could not be requested
+	SubscriptionFailed string = "failed"
+
+	// SubscriptionExpired was verified, but its lease has run out
+	SubscriptionExpired string = "expired"
+
+	// SubscriptionUnsubscribing has been asked to stop, but Twitch has not yet confirmed
+	SubscriptionUnsubscribing string = "unsubscribing"
+)
+
+// SubscriptionStates lists every state a subscription may be in
+var SubscriptionStates = []string{
+	SubscriptionPending,
+	SubscriptionVerified,
+	SubscriptionDenied,
+	SubscriptionFailed,
+	SubscriptionExpired,
+	SubscriptionUnsubscribing,
+}
+
+// Subscription is the known state of the go live web hook subscription for one user
+type Subscription struct {
+	UserId      string    `json:"user_id"`
+	Topic       string    `json:"topic"`
+	State       string    `json:"state"`
+	Reason      string    `json:"reason,omitempty"`
+	RequestedAt time.Time `json:"requested_at"`
+	VerifiedAt  time.Time `json:"verified_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// Subscriptions tracks the state of the web hook subscriptions requested from Twitch, from
+// the request through the hub's verification of the callback
+type Subscriptions struct {
+	lock          sync.RWMutex
+	subscriptions map[string]*Subscription
+}
+
+// NewSubscriptions creates an empty subscription registry
+func NewSubscriptions() *Subscriptions {
+	instance := Subscriptions{
+		subscriptions: make(map[string]*Subscription),
+	}
+
+	return &instance
+}
+
+// UserIdFromTopic returns the user id a stream topic url is for
+func UserIdFromTopic(topic string) string {
+	u, err := url.Parse(topic)
+	if nil != err {
+		return ""
+	}
+
+	return u.Query().Get(TwitchUserIdQueryParameter)
+}
+
+// Requested records that a subscribe or unsubscribe request is being sent for the user's topic
+func (s *Subscriptions) Requested(userId string, topic string, mode string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	subscription := s.subscription(userId, topic)
+	subscription.RequestedAt = time.Now()
+	subscription.Reason = ""
+
+	if TwitchModeUnsubscribe == mode {
+		subscription.State = SubscriptionUnsubscribing
+	} else {
+		subscription.State = SubscriptionPending
+	}
+}
+
+// Failed records that the request for the user's topic could not be sent
+func (s *Subscriptions) Failed(userId string, topic string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	subscription := s.subscription(userId, topic)
+	subscription.State = SubscriptionFailed
+	subscription.Reason = err.Error()
+}
+
+// Verified records the hub's verification of a request for the topic. Verified unsubscribe
+// requests remove the subscription.
+func (s *Subscriptions) Verified(topic string, mode string, leaseSeconds int) {
+	userId := UserIdFromTopic(topic)
+	if "" == userId {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if TwitchModeUnsubscribe == mode {
+		delete(s.subscriptions, userId)
+		return
+	}
+
+	subscription := s.subscription(userId, topic)
+	subscription.State = SubscriptionVerified
+	subscription.Reason = ""
+	subscription.VerifiedAt = time.Now()
+	subscription.ExpiresAt = subscription.VerifiedAt.Add(time.Duration(leaseSeconds) * time.Second)
+}
+
+// Denied records the hub's refusal of the subscription for the topic
+func (s *Subscriptions) Denied(topic string, reason string) {
+	userId := UserIdFromTopic(topic)
+	if "" == userId {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	subscription := s.subscription(userId, topic)
+	subscription.State = SubscriptionDenied
+	subscription.Reason = reason
+}
+
+// subscription returns the subscription for the user, creating it if necessary, and records
+// its topic. The lock must be held.
+func (s *Subscriptions) subscription(userId string, topic string) *Subscription {
+	subscription, ok := s.subscriptions[userId]
+	if !ok {
+		subscription = &Subscription{
+			UserId: userId,
+		}
+		s.subscriptions[userId] = subscription
+	}
+
+	subscription.Topic = topic
+	return subscription
+}
+
+// Get returns the subscription for the user, with expired leases reported as expired
+func (s *Subscriptions) Get(userId string) (Subscription, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	subscription, ok := s.subscriptions[userId]
+	if !ok {
+		return Subscription{}, false
+	}
+
+	return current(subscription, time.Now()), true
+}
+
+// All returns every subscription, ordered by user id
+func (s *Subscriptions) All() []Subscription {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	now := time.Now()
+	result := []Subscription{}
+	for _, subscription := range s.subscriptions {
+		result = append(result, current(subscription, now))
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].UserId < result[j].UserId
+	})
+
+	return result
+}
+
+// CountByState returns the number of subscriptions in each state
+func (s *Subscriptions) CountByState() map[string]int {
+	counts := make(map[string]int)
+	for _, state := range SubscriptionStates {
+		counts[state] = 0
+	}
+
+	for _, subscription := range s.All() {
+		counts[subscription.State]++
+	}
+
+	return counts
+}
+
+// NextExpiry returns the earliest lease expiry of the verified subscriptions, and false if
+// there are none
+func (s *Subscriptions) NextExpiry() (time.Time, bool) {
+	var next time.Time
+	found := false
+
+	for _, subscription := range s.All() {
+		if SubscriptionVerified != subscription.State {
+			continue
+		}
+
+		if !found || subscription.ExpiresAt.Before(next) {
+			next = subscription.ExpiresAt
+			found = true
+		}
+	}
+
+	return next, found
+}
+
+// current returns a copy of the subscription, marking verified subscriptions whose lease
+// has run out as expired
+func current(subscription *Subscription, now time.Time) Subscription {
+	result := *subscription
+	if SubscriptionVerified == result.State && !result.ExpiresAt.After(now) {
+		result.State = SubscriptionExpired
+	}
+
+	return result
+}
+
+// TopicFromLinkHeader returns the topic of a notification delivery from its Link header,
+// which lists the hub and the topic (rel="self") urls
+func TopicFromLinkHeader(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		target := strings.Trim(strings.TrimSpace(parts[0]), "<>")
+
+		for _, param := range parts[1:] {
+			param = strings.Replace(strings.TrimSpace(param), `"`, "", -1)
+			if "rel=self" == param {
+				return target
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,111 @@
+package twitch_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+)
+
+const testTopic = "https://api.twitch.tv/helix/streams?user_id=42"
+
+func TestSubscriptionLifecycle(t *testing.T) {
+	subscriptions := twitch.NewSubscriptions()
+
+	if _, ok := subscriptions.Get("42"); ok {
+		t.Fatal("expected no subscription")
+	}
+
+	subscriptions.Requested("42", testTopic, twitch.TwitchModeSubscribe)
+	expectState(t, subscriptions, twitch.SubscriptionPending, "")
+
+	subscriptions.Verified(testTopic, twitch.TwitchModeSubscribe, 3600)
+	expectState(t, subscriptions, twitch.SubscriptionVerified, "")
+
+	subscription, _ := subscriptions.Get("42")
+	if lease := subscription.ExpiresAt.Sub(subscription.VerifiedAt); time.Hour != lease {
+		t.Fatalf("expected a one hour lease, got %v", lease)
+	}
+
+	subscriptions.Requested("42", testTopic, twitch.TwitchModeUnsubscribe)
+	expectState(t, subscriptions, twitch.SubscriptionUnsubscribing, "")
+
+	subscriptions.Verified(testTopic, twitch.TwitchModeUnsubscribe, 0)
+	if _, ok := subscriptions.Get("42"); ok {
+		t.Fatal("expected a verified unsubscribe to remove the subscription")
+	}
+}
+
+func TestSubscriptionDeniedAndFailed(t *testing.T) {
+	subscriptions := twitch.NewSubscriptions()
+
+	subscriptions.Requested("42", testTopic, twitch.TwitchModeSubscribe)
+	subscriptions.Denied(testTopic, "banned")
+	expectState(t, subscriptions, twitch.SubscriptionDenied, "banned")
+
+	// Requesting again clears the reason
+	subscriptions.Requested("42", testTopic, twitch.TwitchModeSubscribe)
+	expectState(t, subscriptions, twitch.SubscriptionPending, "")
+
+	subscriptions.Failed("42", testTopic, errors.New("connection refused"))
+	expectState(t, subscriptions, twitch.SubscriptionFailed, "connection refused")
+
+	// Callbacks for topics without a user are ignored
+	subscriptions.Denied("https://api.twitch.tv/helix/streams", "banned")
+	if 1 != len(subscriptions.All()) {
+		t.Fatalf("got %v", subscriptions.All())
+	}
+}
+
+func TestExpiredSubscriptions(t *testing.T) {
+	subscriptions := twitch.NewSubscriptions()
+
+	subscriptions.Verified(testTopic, twitch.TwitchModeSubscribe, 0)
+	subscriptions.Verified("https://api.twitch.tv/helix/streams?user_id=7", twitch.TwitchModeSubscribe, 60)
+	subscriptions.Requested("9", "https://api.twitch.tv/helix/streams?user_id=9", twitch.TwitchModeSubscribe)
+
+	expectState(t, subscriptions, twitch.SubscriptionExpired, "")
+
+	counts := subscriptions.CountByState()
+	if 1 != counts[twitch.SubscriptionExpired] || 1 != counts[twitch.SubscriptionVerified] || 1 != counts[twitch.SubscriptionPending] || 0 != counts[twitch.SubscriptionDenied] {
+		t.Fatalf("got %v", counts)
+	}
+
+	next, ok := subscriptions.NextExpiry()
+	if !ok || time.Until(next) > time.Minute || time.Until(next) < 50*time.Second {
+		t.Fatalf("expected the verified lease to expire in a minute, got %v, %v", next, ok)
+	}
+
+	all := subscriptions.All()
+	if 3 != len(all) || "42" != all[0].UserId || "7" != all[1].UserId || "9" != all[2].UserId {
+		t.Fatalf("expected subscriptions ordered by user id, got %v", all)
+	}
+}
+
+func TestTopics(t *testing.T) {
+	if "42" != twitch.UserIdFromTopic(testTopic) {
+		t.Errorf("got %q", twitch.UserIdFromTopic(testTopic))
+	}
+
+	if "" != twitch.UserIdFromTopic("://") {
+		t.Error("expected no user for an invalid topic")
+	}
+
+	header := `<https://api.twitch.tv/helix/webhooks/hub>; rel="hub", <` + testTopic + `>; rel="self"`
+	if testTopic != twitch.TopicFromLinkHeader(header) {
+		t.Errorf("got %q", twitch.TopicFromLinkHeader(header))
+	}
+
+	if "" != twitch.TopicFromLinkHeader("") {
+		t.Error("expected no topic without a Link header")
+	}
+}
+
+// expectState fails unless the subscription for user 42 is in the state, with the reason
+func expectState(t *testing.T, subscriptions *twitch.Subscriptions, state string, reason string) {
+	subscription, ok := subscriptions.Get("42")
+	if !ok || state != subscription.State || reason != subscription.Reason {
+		t.Fatalf("expected %s (%q), got %+v", state, reason, subscription)
+	}
+}
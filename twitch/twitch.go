@@ -4,26 +4,45 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"log"
+	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
+	"time"
 
 	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
 )
 
 const (
 	// TwitchUrl is the base url for Twitch
 	TwitchUrl string = "http://twitch.tv"
 
+	// TwitchApiUrl is the base url for the Twitch APIs
+	TwitchApiUrl string = "https://api.twitch.tv"
+
+	// TwitchUsersPath is the API path for Twitch User Id Lookup
+	TwitchUsersPath string = "/kraken/users"
+
+	// TwitchWebhookHubPath is the API path for web hook subscriptions
+	TwitchWebhookHubPath string = "/helix/webhooks/hub"
+
+	// TwitchStreamsPath is the API path of the stream topic
+	TwitchStreamsPath string = "/helix/streams"
+
+	// TwitchGamesPath is the API path for Twitch Game Lookup
+	TwitchGamesPath string = "/helix/games"
+
 	// TwitchUserNameToUserIdUrl is the API url for Twitch User Id Lookup
-	TwitchUserNameToUserIdUrl string = "https://api.twitch.tv/kraken/users"
+	TwitchUserNameToUserIdUrl string = TwitchApiUrl + TwitchUsersPath
 
 	// TwitchWebhookUrl is the webhook subscription api Twitch WebHooks Url
-	TwitchWebhookUrl string = "https://api.twitch.tv/helix/webhooks/hub"
+	TwitchWebhookUrl string = TwitchApiUrl + TwitchWebhookHubPath
 
 	// TwitchStreamsTopicUrl Twitch WebHook Topic Url
-	TwitchStreamsTopicUrl string = "https://api.twitch.tv/helix/streams"
+	TwitchStreamsTopicUrl string = TwitchApiUrl + TwitchStreamsPath
 
 	// TwitchV5 Twitch V5 API type
 	TwitchV5 string = "application/vnd.twitchtv.v5+json"
@@ -43,6 +62,15 @@ const (
 	// TwitchHubReasonQueryParameter Webhook Reason Query Parameter
 	TwitchHubReasonQueryParameter string = "hub.reason"
 
+	// TwitchNotificationIdHeader Unique Message Id Header for a Notification Delivery
+	TwitchNotificationIdHeader string = "Twitch-Notification-Id"
+
+	// TwitchLinkHeader Header Listing the Hub and Topic Urls of a Notification Delivery
+	TwitchLinkHeader string = "Link"
+
+	// TwitchSignatureHeader Header Carrying the HMAC of a Notification Delivery's Body
+	TwitchSignatureHeader string = "X-Hub-Signature"
+
 	// TwitchModeDenied Twitch Subscribe Request denied
 	TwitchModeDenied string = "denied"
 
@@ -61,8 +89,17 @@ const (
 	// TwitchUserNameToUserIdQueryParameter User Name to User Id Query Parameter
 	TwitchUserNameToUserIdQueryParameter string = "login"
 
+	// TwitchGameIdQueryParameter Game Id Query Parameter
+	TwitchGameIdQueryParameter string = "id"
+
+	// TwitchCredentialCheckLogin is the user looked up to check the client id is accepted
+	TwitchCredentialCheckLogin string = "twitch"
+
 	// TwitchMaxLeaseSeconds Maximum Lease Time for Subscriptions
 	TwitchMaxLeaseSeconds int = 864000
+
+	// TwitchMaxSecretBytes The hub accepts secrets shorter than this
+	TwitchMaxSecretBytes int = 200
 )
 
 // Request Payload from Client to Twitch Requesting Notifications
@@ -95,6 +132,37 @@ type TwitchNotificationPayload struct {
 	Notifications []TwitchNotification `json:"data"`
 }
 
+// Validate checks the payload has the fields needed to handle it. An empty list of
+// notifications is valid, and means the stream went offline.
+func (p *TwitchNotificationPayload) Validate() error {
+	if nil == p.Notifications {
+		return errors.New("data: required")
+	}
+
+	problems := []string{}
+	for i, notification := range p.Notifications {
+		field := fmt.Sprintf("data[%d]", i)
+
+		if "" == notification.UserId {
+			problems = append(problems, field+".user_id: required")
+		}
+
+		if "" == notification.Type {
+			problems = append(problems, field+".type: required")
+		}
+
+		if _, err := time.Parse(time.RFC3339, notification.StartedAt); nil != err {
+			problems = append(problems, fmt.Sprintf("%s.started_at: %q is not an RFC 3339 time", field, notification.StartedAt))
+		}
+	}
+
+	if len(problems) > 0 {
+		return errors.New("Invalid notification payload: " + strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
 // TwitchUser representation from Querying user info endpoint
 type TwitchUser struct {
 	UserId      string `json:"_id"`
@@ -113,23 +181,61 @@ type TwitchUsersPayload struct {
 	Users []TwitchUser `json:"users"`
 }
 
+// TwitchGame representation from Querying game info endpoint
+type TwitchGame struct {
+	Id        string `json:"id"`
+	Name      string `json:"name"`
+	BoxArtUrl string `json:"box_art_url"`
+}
+
+// Twitch game endpoint payload
+type TwitchGamesPayload struct {
+	Data []TwitchGame `json:"data"`
+}
+
 type twitch struct {
+	cacheLock     sync.RWMutex
 	userNameCache map[string]string
+	gameNameCache map[string]string
 	clientId      string
+	apiUrl        string
+	userAgent     string
+	secret        string
+	httpClient    *http.Client
+	subscriptions *Subscriptions
 }
 
 // TwitchClient is the interface used to represent a client capable of communicating with twitch.tv apis.
 type TwitchClient interface {
 	FromUserId(userId string) string
 	UserIdsFor(userNames []string) ([]string, error)
-	SubscribeToStreams(notifyEndPoint string, userIds []string)
+	UsersFor(userNames []string) ([]TwitchUser, error)
+	GameName(gameId string) (string, error)
+	SubscribeToStreams(notifyEndPoint string, userIds []string) error
+	UnsubscribeFromStreams(notifyEndPoint string, userIds []string) error
+	Subscriptions() *Subscriptions
+	CheckCredentials() error
 }
 
-// NewTwitch creates a new TwitchClient implementation and returns it
+// NewTwitch creates a new TwitchClient implementation using the default options and returns it
 func NewTwitch(clientId string) TwitchClient {
+	return NewTwitchWithOptions(clientId, DefaultOptions)
+}
+
+// NewTwitchWithOptions creates a new TwitchClient implementation which communicates with the
+// Twitch APIs as configured by the options
+func NewTwitchWithOptions(clientId string, options Options) TwitchClient {
+	options = options.withDefaults()
+
 	instance := twitch{
 		userNameCache: make(map[string]string),
+		gameNameCache: make(map[string]string),
 		clientId:      clientId,
+		apiUrl:        options.ApiUrl,
+		userAgent:     options.UserAgent,
+		secret:        options.Secret,
+		httpClient:    options.NewClient(),
+		subscriptions: NewSubscriptions(),
 	}
 
 	return &instance
@@ -142,90 +248,244 @@ func UserStreamUrl(userName string) string {
 
 // FromUserId looks up a single user id from internal cache
 func (t *twitch) FromUserId(userId string) string {
+	t.cacheLock.RLock()
+	defer t.cacheLock.RUnlock()
+
 	return t.userNameCache[userId]
 }
 
+// Subscriptions returns the state of the web hook subscriptions requested by the client
+func (t *twitch) Subscriptions() *Subscriptions {
+	return t.subscriptions
+}
+
+// CheckCredentials makes a lightweight request to verify Twitch accepts the client id
+func (t *twitch) CheckCredentials() error {
+	_, err := t.requestUsers([]string{TwitchCredentialCheckLogin})
+	recordApiRequest(usersEndPoint, err)
+	return err
+}
+
 // UserIdsFor converts user names into a comma delimited string of user ids
 func (t *twitch) UserIdsFor(userNames []string) ([]string, error) {
 	userIds := []string{}
 
+	users, err := t.UsersFor(userNames)
+	if nil != err {
+		return userIds, err
+	}
+
+	for _, twitchUser := range users {
+		userIds = append(userIds, twitchUser.UserId)
+	}
+
+	return userIds, nil
+}
+
+// UsersFor looks up the Twitch users with the provided user names
+func (t *twitch) UsersFor(userNames []string) ([]TwitchUser, error) {
 	if len(userNames) == 0 {
-		return userIds, errors.New("UserNames is Length: 0")
+		return nil, errors.New("UserNames is Length: 0")
 	}
 
-	request, err := http.NewRequest(http.MethodGet, getUserConversionUrl(userNames), nil)
+	users, err := t.requestUsers(userNames)
+	recordApiRequest(usersEndPoint, err)
 	if nil != err {
-		return userIds, err
+		return nil, err
+	}
+
+	logutil.Debug("Looked up Twitch users", "requested", len(userNames), "found", len(users))
+
+	t.cacheLock.Lock()
+	defer t.cacheLock.Unlock()
+
+	for _, twitchUser := range users {
+		// Cache Display Name for User Id
+		t.userNameCache[twitchUser.UserId] = twitchUser.DisplayName
+	}
+
+	return users, nil
+}
+
+// requestUsers requests the Twitch users with the provided user names
+func (t *twitch) requestUsers(userNames []string) ([]TwitchUser, error) {
+	request, err := t.newRequest(http.MethodGet, getUserConversionUrl(t.apiUrl, userNames), nil)
+	if nil != err {
+		return nil, err
 	}
 
 	request.Header.Set(httputil.HttpAcceptHeader, TwitchV5)
-	request.Header.Set(httputil.HttpClientIdHeader, t.clientId)
 
-	httpClient := &http.Client{}
-	resp, err := httpClient.Do(request)
+	resp, err := requests.Do(t.httpClient, request)
 	if nil != err {
-		return userIds, err
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("Twitch users lookup returned %s", resp.Status)
 	}
 
 	var payload TwitchUsersPayload
 	e := httputil.DecodeJson(resp.Body, &payload)
 	if nil != e {
-		return userIds, e
+		return nil, e
 	}
 
-	for _, twitchUser := range payload.Users {
-		userIds = append(userIds, twitchUser.UserId)
+	return payload.Users, nil
+}
 
-		// Cache Display Name for User Id
-		t.userNameCache[twitchUser.UserId] = twitchUser.DisplayName
+// GameName looks up the name of the game with the id, which is cached since games aren't
+// renamed
+func (t *twitch) GameName(gameId string) (string, error) {
+	t.cacheLock.RLock()
+	name, ok := t.gameNameCache[gameId]
+	t.cacheLock.RUnlock()
+
+	if ok {
+		return name, nil
 	}
 
-	return userIds, nil
+	games, err := t.requestGames([]string{gameId})
+	recordApiRequest(gamesEndPoint, err)
+	if nil != err {
+		return "", err
+	}
+
+	if len(games) == 0 {
+		return "", fmt.Errorf("No Twitch game with id %s", gameId)
+	}
+
+	t.cacheLock.Lock()
+	defer t.cacheLock.Unlock()
+
+	t.gameNameCache[gameId] = games[0].Name
+	return games[0].Name, nil
 }
 
-// Sends a Subscribe Request for Go Live Events for the Provided Users
-func (t *twitch) SubscribeToStreams(notifyEndPoint string, userIds []string) {
-	if len(userIds) == 0 {
-		return
+// requestGames requests the Twitch games with the provided ids
+func (t *twitch) requestGames(gameIds []string) ([]TwitchGame, error) {
+	request, err := t.newRequest(http.MethodGet, getGamesUrl(t.apiUrl, gameIds), nil)
+	if nil != err {
+		return nil, err
 	}
 
-	for _, userId := range userIds {
-		topicUrl := getStreamTopicUrl(userId)
+	resp, err := requests.Do(t.httpClient, request)
+	if nil != err {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		return nil, fmt.Errorf("Twitch games lookup returned %s", resp.Status)
+	}
+
+	var payload TwitchGamesPayload
+	if err := httputil.DecodeJson(resp.Body, &payload); nil != err {
+		return nil, err
+	}
+
+	return payload.Data, nil
+}
+
+// SubscribeToStreams Sends a Subscribe Request for Go Live Events for the Provided Users
+func (t *twitch) SubscribeToStreams(notifyEndPoint string, userIds []string) error {
+	return t.sendSubscriptions(notifyEndPoint, userIds, TwitchModeSubscribe, TwitchMaxLeaseSeconds)
+}
 
+// UnsubscribeFromStreams Sends an Unsubscribe Request for Go Live Events for the Provided Users
+func (t *twitch) UnsubscribeFromStreams(notifyEndPoint string, userIds []string) error {
+	return t.sendSubscriptions(notifyEndPoint, userIds, TwitchModeUnsubscribe, 0)
+}
+
+// sendSubscriptions sends a web hook hub request with the mode for each of the users,
+// continuing past failures and returning the first error
+func (t *twitch) sendSubscriptions(notifyEndPoint string, userIds []string, mode string, leaseSeconds int) error {
+	var firstErr error
+
+	for _, userId := range userIds {
+		topic := getStreamTopicUrl(t.apiUrl, userId)
 		payload := TwitchWebhookPayload{
 			CallbackUrl:  notifyEndPoint,
-			Mode:         TwitchModeSubscribe,
-			Topic:        topicUrl,
-			LeaseSeconds: TwitchMaxLeaseSeconds,
+			Mode:         mode,
+			Topic:        topic,
+			LeaseSeconds: leaseSeconds,
 		}
 
-		jsonBytes, err := httputil.EncodeJson(payload)
-		if err != nil {
-			log.Fatalln(err)
+		// The hub signs every delivery for the subscription with its secret
+		if TwitchModeSubscribe == mode {
+			payload.Secret = t.secret
 		}
 
-		request, err := http.NewRequest(http.MethodPost, TwitchWebhookUrl, bytes.NewBuffer(jsonBytes))
-		if err != nil {
-			log.Fatalln(err)
+		// The hub may verify the callback before the request returns, so the request is
+		// recorded first
+		t.subscriptions.Requested(userId, topic, mode)
+
+		err := t.sendWebhookRequest(payload)
+		recordApiRequest(webhooksEndPoint, err)
+		if nil == err {
+			logutil.Debug("Sent subscription request", "mode", mode, "user_id", userId, "lease_seconds", leaseSeconds)
+		} else {
+			t.subscriptions.Failed(userId, topic, err)
+			logutil.Error("Failed to send subscription request", "mode", mode, "user_id", userId, logutil.ErrorKey, err)
+			if nil == firstErr {
+				firstErr = err
+			}
 		}
+	}
 
-		request.Header.Set(httputil.HttpContentTypeHeader, httputil.JsonContentType)
-		request.Header.Set(httputil.HttpClientIdHeader, t.clientId)
+	return firstErr
+}
 
-		httpClient := &http.Client{}
-		resp, err := httpClient.Do(request)
-		if err != nil {
-			log.Fatalln(err)
-		}
+// sendWebhookRequest posts a single web hook hub request
+func (t *twitch) sendWebhookRequest(payload TwitchWebhookPayload) error {
+	jsonBytes, err := httputil.EncodeJson(payload)
+	if err != nil {
+		return err
+	}
 
+	request, err := t.newRequest(http.MethodPost, httputil.JoinUrl(t.apiUrl, TwitchWebhookHubPath), bytes.NewBuffer(jsonBytes))
+	if err != nil {
+		return err
+	}
+
+	request.Header.Set(httputil.HttpContentTypeHeader, httputil.JsonContentType)
+
+	resp, err := requests.Do(t.httpClient, request)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	// The hub accepts requests with 202 Accepted, then verifies them asynchronously
+	if resp.StatusCode >= http.StatusBadRequest {
 		var result map[string]interface{}
 		json.NewDecoder(resp.Body).Decode(&result)
+		return fmt.Errorf("Twitch hub returned %s: %v", resp.Status, result)
 	}
+
+	return nil
+}
+
+// newRequest creates a request to the Twitch APIs with the client id and user agent set
+func (t *twitch) newRequest(method string, requestUrl string, body io.Reader) (*http.Request, error) {
+	request, err := http.NewRequest(method, requestUrl, body)
+	if nil != err {
+		return nil, err
+	}
+
+	request.Header.Set(httputil.HttpClientIdHeader, t.clientId)
+	request.Header.Set(httputil.HttpUserAgentHeader, t.userAgent)
+
+	return request, nil
 }
 
 // Gets the Stream Topic URL
-func getStreamTopicUrl(userId string) string {
-	u, _ := url.Parse(TwitchStreamsTopicUrl)
+func getStreamTopicUrl(apiUrl string, userId string) string {
+	u, _ := url.Parse(httputil.JoinUrl(apiUrl, TwitchStreamsPath))
 	q := u.Query()
 	q.Add(TwitchUserIdQueryParameter, userId)
 	u.RawQuery = q.Encode()
@@ -234,13 +494,25 @@ func getStreamTopicUrl(userId string) string {
 }
 
 // Gets the user name to user id conversion url
-func getUserConversionUrl(userNames []string) string {
+func getUserConversionUrl(apiUrl string, userNames []string) string {
 	users := strings.Join(userNames, ",")
 
-	u, _ := url.Parse(TwitchUserNameToUserIdUrl)
+	u, _ := url.Parse(httputil.JoinUrl(apiUrl, TwitchUsersPath))
 	q := u.Query()
 	q.Add(TwitchUserNameToUserIdQueryParameter, users)
 	u.RawQuery = q.Encode()
 
 	return u.String()
 }
+
+// Gets the game lookup url
+func getGamesUrl(apiUrl string, gameIds []string) string {
+	u, _ := url.Parse(httputil.JoinUrl(apiUrl, TwitchGamesPath))
+	q := u.Query()
+	for _, gameId := range gameIds {
+		q.Add(TwitchGameIdQueryParameter, gameId)
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
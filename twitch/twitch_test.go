@@ -0,0 +1,208 @@
+package twitch_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch/twitchtest"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+// recordingTransport sends requests with the default transport, or fails them when offline,
+// recording each of them
+type recordingTransport struct {
+	lock     sync.Mutex
+	requests []*http.Request
+	offline  bool
+}
+
+func (r *recordingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	r.lock.Lock()
+	r.requests = append(r.requests, request)
+	r.lock.Unlock()
+
+	if r.offline {
+		return nil, errors.New("offline")
+	}
+
+	return http.DefaultTransport.RoundTrip(request)
+}
+
+func TestUsersFor(t *testing.T) {
+	server := twitchtest.NewServer()
+	defer server.Close()
+
+	server.AddUser("42", "streamer", "Streamer")
+	server.AddUser("7", "other", "Other")
+
+	client := twitch.NewTwitchWithOptions("client-id", server.Options())
+
+	users, err := client.UsersFor([]string{"Streamer", "missing"})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if 1 != len(users) || "42" != users[0].UserId || "streamer" != users[0].UserName {
+		t.Fatalf("got %+v", users)
+	}
+
+	if "Streamer" != client.FromUserId("42") || "" != client.FromUserId("7") {
+		t.Fatalf("expected only the looked up user's display name to be cached")
+	}
+
+	userIds, err := client.UserIdsFor([]string{"streamer", "other"})
+	if nil != err || "42,7" != strings.Join(userIds, ",") {
+		t.Fatalf("got %v, %v", userIds, err)
+	}
+
+	if _, err := client.UsersFor(nil); nil == err {
+		t.Fatal("expected looking up no users to fail")
+	}
+}
+
+func TestGameName(t *testing.T) {
+	server := twitchtest.NewServer()
+	defer server.Close()
+
+	server.AddGame("509658", "Just Chatting")
+
+	transport := &recordingTransport{}
+	options := server.Options()
+	options.Transport = transport
+
+	client := twitch.NewTwitchWithOptions("client-id", options)
+
+	for i := 0; i < 2; i++ {
+		name, err := client.GameName("509658")
+		if nil != err || "Just Chatting" != name {
+			t.Fatalf("got %q, %v", name, err)
+		}
+	}
+
+	// Games aren't renamed, so the name is only looked up once
+	if 1 != len(transport.requests) {
+		t.Fatalf("expected the name to be cached, got %d requests", len(transport.requests))
+	}
+
+	if twitch.TwitchGamesPath != transport.requests[0].URL.Path || "509658" != transport.requests[0].URL.Query().Get("id") {
+		t.Fatalf("got %s", transport.requests[0].URL)
+	}
+
+	if _, err := client.GameName("missing"); nil == err {
+		t.Fatal("expected an unknown game to fail")
+	}
+}
+
+func TestOptions(t *testing.T) {
+	server := twitchtest.NewServer()
+	defer server.Close()
+
+	transport := &recordingTransport{}
+	options := server.Options()
+	options.Transport = transport
+	options.UserAgent = "test-agent"
+
+	client := twitch.NewTwitchWithOptions("client-id", options)
+	if err := client.CheckCredentials(); nil != err {
+		t.Fatal(err)
+	}
+
+	if 1 != len(transport.requests) {
+		t.Fatalf("expected the request to be sent with the transport, got %d requests", len(transport.requests))
+	}
+
+	request := transport.requests[0]
+	if !strings.HasPrefix(request.URL.String(), server.Url()+twitch.TwitchUsersPath) {
+		t.Errorf("expected the request to be sent to the api url, got %s", request.URL)
+	}
+
+	if "client-id" != request.Header.Get("Client-ID") || "test-agent" != request.Header.Get("User-Agent") {
+		t.Errorf("got headers %v", request.Header)
+	}
+}
+
+func TestDefaultOptions(t *testing.T) {
+	transport := &recordingTransport{offline: true}
+	client := twitch.NewTwitchWithOptions("client-id", twitch.Options{ClientOptions: httputil.ClientOptions{Transport: transport}})
+
+	// The request fails, but is still addressed and identified using the defaults
+	if err := client.CheckCredentials(); nil == err {
+		t.Fatal("expected the request to fail")
+	}
+
+	if 1 != len(transport.requests) {
+		t.Fatalf("got %d requests", len(transport.requests))
+	}
+
+	request := transport.requests[0]
+	if !strings.HasPrefix(request.URL.String(), twitch.TwitchUserNameToUserIdUrl) || "multi-twitch-discord-bot" != request.Header.Get("User-Agent") {
+		t.Errorf("got %s with headers %v", request.URL, request.Header)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	release := make(chan bool)
+	slow := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	defer close(release)
+
+	options := twitch.DefaultOptions
+	options.ApiUrl = slow.URL
+	options.Timeout = 50 * time.Millisecond
+
+	started := time.Now()
+	if err := twitch.NewTwitchWithOptions("client-id", options).CheckCredentials(); nil == err {
+		t.Fatal("expected the request to time out")
+	}
+
+	if time.Since(started) > time.Second {
+		t.Fatalf("expected the request to time out quickly, took %s", time.Since(started))
+	}
+}
+
+func TestSubscribeToStreams(t *testing.T) {
+	server := twitchtest.NewServer()
+	defer server.Close()
+
+	// Answer the hub's verification the way the bot does
+	callback := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		rw.Write([]byte(request.URL.Query().Get(twitch.TwitchHubChallengeQueryParameter)))
+	}))
+	defer callback.Close()
+
+	options := server.Options()
+	options.Secret = "secret"
+	client := twitch.NewTwitchWithOptions("client-id", options)
+
+	if err := client.SubscribeToStreams(callback.URL+"/notify", []string{"42"}); nil != err {
+		t.Fatal(err)
+	}
+	server.WaitForCallbacks()
+
+	subscription, ok := server.Subscription("42")
+	if !ok {
+		t.Fatal("expected the subscription to be verified")
+	}
+
+	if callback.URL+"/notify" != subscription.CallbackUrl || "secret" != subscription.Secret || twitch.TwitchMaxLeaseSeconds != subscription.LeaseSeconds {
+		t.Fatalf("got %+v", subscription)
+	}
+
+	if err := client.UnsubscribeFromStreams(callback.URL+"/notify", []string{"42"}); nil != err {
+		t.Fatal(err)
+	}
+	server.WaitForCallbacks()
+
+	if _, ok := server.Subscription("42"); ok {
+		t.Fatal("expected the subscription to be removed")
+	}
+}
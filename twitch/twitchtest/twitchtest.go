@@ -0,0 +1,420 @@
+// Package twitchtest provides an in-process stand-in for the Twitch APIs used by
+// twitch.TwitchClient: the users and games lookups, and a web hook hub which verifies subscription
+// callbacks and then delivers signed notifications to them.
+package twitchtest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+const (
+	// CallbackTimeout limits how long the hub waits on the bot's callback
+	CallbackTimeout time.Duration = 5 * time.Second
+)
+
+// Subscription is a subscription the hub has verified
+type Subscription struct {
+	UserId       string
+	Topic        string
+	CallbackUrl  string
+	Secret       string
+	LeaseSeconds int
+}
+
+// Server is an in-process Twitch API listening on a local port
+type Server struct {
+	server        *httptest.Server
+	client        *http.Client
+	lock          sync.Mutex
+	users         map[string]twitch.TwitchUser
+	games         map[string]twitch.TwitchGame
+	gameLookups   int
+	refuseGames   bool
+	denied        map[string]string
+	subscriptions map[string]Subscription
+	callbacks     sync.WaitGroup
+	nextId        int
+}
+
+// NewServer starts a new Server on a random local port
+func NewServer() *Server {
+	instance := &Server{
+		client:        &http.Client{Timeout: CallbackTimeout},
+		users:         make(map[string]twitch.TwitchUser),
+		games:         make(map[string]twitch.TwitchGame),
+		denied:        make(map[string]string),
+		subscriptions: make(map[string]Subscription),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(twitch.TwitchUsersPath, instance.onUsers)
+	mux.HandleFunc(twitch.TwitchGamesPath, instance.onGames)
+	mux.HandleFunc(twitch.TwitchWebhookHubPath, instance.onHub)
+	instance.server = httptest.NewServer(mux)
+
+	return instance
+}
+
+// Url returns the base url of the server, in place of twitch.TwitchApiUrl
+func (s *Server) Url() string {
+	return s.server.URL
+}
+
+// Options returns the options for a twitch.TwitchClient which communicates with the server
+func (s *Server) Options() twitch.Options {
+	options := twitch.DefaultOptions
+	options.ApiUrl = s.Url()
+
+	return options
+}
+
+// Close waits for callbacks in progress, then stops the server
+func (s *Server) Close() {
+	s.callbacks.Wait()
+	s.server.Close()
+}
+
+// AddUser makes a user available to the users lookup
+func (s *Server) AddUser(userId string, login string, displayName string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.users[strings.ToLower(login)] = twitch.TwitchUser{
+		UserId:      userId,
+		UserName:    strings.ToLower(login),
+		DisplayName: displayName,
+		Type:        "user",
+	}
+}
+
+// AddGame makes a game available to the games lookup
+func (s *Server) AddGame(gameId string, name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.games[gameId] = twitch.TwitchGame{Id: gameId, Name: name}
+}
+
+// RefuseGameLookups makes every games lookup fail with 500 Internal Server Error
+func (s *Server) RefuseGameLookups() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.refuseGames = true
+}
+
+// GameLookups returns the number of games lookups received
+func (s *Server) GameLookups() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.gameLookups
+}
+
+// Deny makes the hub deny subscriptions for the user with the reason
+func (s *Server) Deny(userId string, reason string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.denied[userId] = reason
+}
+
+// WaitForCallbacks waits until the hub has finished calling back every subscription request
+// received so far
+func (s *Server) WaitForCallbacks() {
+	s.callbacks.Wait()
+}
+
+// Subscription returns the verified subscription for the user, and false if there is none
+func (s *Server) Subscription(userId string) (Subscription, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	subscription, ok := s.subscriptions[userId]
+	return subscription, ok
+}
+
+// Subscriptions returns every verified subscription, ordered by user id
+func (s *Server) Subscriptions() []Subscription {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	result := []Subscription{}
+	for _, subscription := range s.subscriptions {
+		result = append(result, subscription)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].UserId < result[j].UserId
+	})
+
+	return result
+}
+
+// GoLive delivers a notification that the user's stream is live, returning the status code
+// the bot responded with
+func (s *Server) GoLive(notification twitch.TwitchNotification) (int, error) {
+	return s.Deliver(notification.UserId, s.NewMessageId(), []twitch.TwitchNotification{notification})
+}
+
+// GoOffline delivers an empty notification, meaning the user's stream has ended
+func (s *Server) GoOffline(userId string) (int, error) {
+	return s.Deliver(userId, s.NewMessageId(), []twitch.TwitchNotification{})
+}
+
+// NewMessageId returns a unique notification id, for deliveries made with Deliver
+func (s *Server) NewMessageId() string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.nextId++
+	return "notification-" + strconv.Itoa(s.nextId)
+}
+
+// Deliver posts the notifications to the callback of the user's verified subscription as the
+// message id, so a delivery can be repeated the way Twitch retries it. Returns the status
+// code the bot responded with.
+func (s *Server) Deliver(userId string, messageId string, notifications []twitch.TwitchNotification) (int, error) {
+	subscription, ok := s.Subscription(userId)
+	if !ok {
+		return 0, fmt.Errorf("No verified subscription for user %s", userId)
+	}
+
+	if nil == notifications {
+		notifications = []twitch.TwitchNotification{}
+	}
+
+	body, err := httputil.EncodeJson(twitch.TwitchNotificationPayload{Notifications: notifications})
+	if nil != err {
+		return 0, err
+	}
+
+	request, err := http.NewRequest(http.MethodPost, subscription.CallbackUrl, strings.NewReader(string(body)))
+	if nil != err {
+		return 0, err
+	}
+
+	request.Header.Set(httputil.HttpContentTypeHeader, httputil.JsonContentType)
+	request.Header.Set(twitch.TwitchNotificationIdHeader, messageId)
+	request.Header.Set(twitch.TwitchLinkHeader, fmt.Sprintf(`<%s>; rel="hub", <%s>; rel="self"`,
+		httputil.JoinUrl(s.Url(), twitch.TwitchWebhookHubPath), subscription.Topic))
+
+	if "" != subscription.Secret {
+		request.Header.Set(twitch.TwitchSignatureHeader, twitch.TwitchSignaturePrefix+twitch.Sign(subscription.Secret, body))
+	}
+
+	resp, err := s.client.Do(request)
+	if nil != err {
+		return 0, err
+	}
+
+	defer resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// onUsers looks up the users with the requested logins
+func (s *Server) onUsers(rw http.ResponseWriter, request *http.Request) {
+	if "" == request.Header.Get(httputil.HttpClientIdHeader) {
+		http.Error(rw, "Missing "+httputil.HttpClientIdHeader, http.StatusBadRequest)
+		return
+	}
+
+	payload := twitch.TwitchUsersPayload{
+		Users: []twitch.TwitchUser{},
+	}
+
+	s.lock.Lock()
+	logins := request.URL.Query().Get(twitch.TwitchUserNameToUserIdQueryParameter)
+	for _, login := range strings.Split(logins, ",") {
+		if user, ok := s.users[strings.ToLower(strings.TrimSpace(login))]; ok {
+			payload.Users = append(payload.Users, user)
+		}
+	}
+	s.lock.Unlock()
+
+	payload.Total = len(payload.Users)
+	writeJson(rw, http.StatusOK, payload)
+}
+
+// onGames looks up the games with the requested ids
+func (s *Server) onGames(rw http.ResponseWriter, request *http.Request) {
+	if "" == request.Header.Get(httputil.HttpClientIdHeader) {
+		http.Error(rw, "Missing "+httputil.HttpClientIdHeader, http.StatusBadRequest)
+		return
+	}
+
+	s.lock.Lock()
+	s.gameLookups++
+	refused := s.refuseGames
+	s.lock.Unlock()
+
+	if refused {
+		http.Error(rw, "Games lookups are refused", http.StatusInternalServerError)
+		return
+	}
+
+	payload := twitch.TwitchGamesPayload{
+		Data: []twitch.TwitchGame{},
+	}
+
+	s.lock.Lock()
+	for _, gameId := range request.URL.Query()[twitch.TwitchGameIdQueryParameter] {
+		if game, ok := s.games[gameId]; ok {
+			payload.Data = append(payload.Data, game)
+		}
+	}
+	s.lock.Unlock()
+
+	writeJson(rw, http.StatusOK, payload)
+}
+
+// onHub accepts a subscription request, then verifies it with the callback in the background
+func (s *Server) onHub(rw http.ResponseWriter, request *http.Request) {
+	if http.MethodPost != request.Method {
+		http.Error(rw, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	if "" == request.Header.Get(httputil.HttpClientIdHeader) {
+		http.Error(rw, "Missing "+httputil.HttpClientIdHeader, http.StatusBadRequest)
+		return
+	}
+
+	var payload twitch.TwitchWebhookPayload
+	if err := json.NewDecoder(request.Body).Decode(&payload); nil != err {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userId := twitch.UserIdFromTopic(payload.Topic)
+	switch {
+	case "" == payload.CallbackUrl:
+		http.Error(rw, "Missing hub.callback", http.StatusBadRequest)
+		return
+
+	case "" == userId:
+		http.Error(rw, "Invalid hub.topic", http.StatusBadRequest)
+		return
+
+	case twitch.TwitchModeSubscribe != payload.Mode && twitch.TwitchModeUnsubscribe != payload.Mode:
+		http.Error(rw, "Invalid hub.mode", http.StatusBadRequest)
+		return
+	}
+
+	s.callbacks.Add(1)
+	go func() {
+		defer s.callbacks.Done()
+		s.verify(userId, payload)
+	}()
+
+	rw.WriteHeader(http.StatusAccepted)
+}
+
+// verify calls back the subscriber, recording the subscription if the callback echoes the
+// challenge, or tells the subscriber the subscription was denied
+func (s *Server) verify(userId string, payload twitch.TwitchWebhookPayload) {
+	s.lock.Lock()
+	reason, denied := s.denied[userId]
+	s.lock.Unlock()
+
+	query := url.Values{}
+	query.Set(twitch.TwitchHubTopicQueryParameter, payload.Topic)
+
+	if denied && twitch.TwitchModeSubscribe == payload.Mode {
+		query.Set(twitch.TwitchHubModeQueryParameter, twitch.TwitchModeDenied)
+		query.Set(twitch.TwitchHubReasonQueryParameter, reason)
+		s.callback(payload.CallbackUrl, query)
+		return
+	}
+
+	challenge := newChallenge()
+	query.Set(twitch.TwitchHubModeQueryParameter, payload.Mode)
+	query.Set(twitch.TwitchHubChallengeQueryParameter, challenge)
+	query.Set(twitch.TwitchHubLeaseQueryParameter, strconv.Itoa(payload.LeaseSeconds))
+
+	if body, ok := s.callback(payload.CallbackUrl, query); !ok || challenge != body {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if twitch.TwitchModeUnsubscribe == payload.Mode {
+		delete(s.subscriptions, userId)
+		return
+	}
+
+	s.subscriptions[userId] = Subscription{
+		UserId:       userId,
+		Topic:        payload.Topic,
+		CallbackUrl:  payload.CallbackUrl,
+		Secret:       payload.Secret,
+		LeaseSeconds: payload.LeaseSeconds,
+	}
+}
+
+// callback sends a verification request to the callback url, returning the response body
+// and whether the callback responded 2xx
+func (s *Server) callback(callbackUrl string, query url.Values) (string, bool) {
+	u, err := url.Parse(callbackUrl)
+	if nil != err {
+		return "", false
+	}
+
+	params := u.Query()
+	for key, values := range query {
+		params[key] = values
+	}
+	u.RawQuery = params.Encode()
+
+	resp, err := s.client.Get(u.String())
+	if nil != err {
+		return "", false
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if nil != err {
+		return "", false
+	}
+
+	return string(body), resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices
+}
+
+// newChallenge returns a random hub challenge
+func newChallenge() string {
+	buffer := make([]byte, 16)
+	rand.Read(buffer)
+
+	return hex.EncodeToString(buffer)
+}
+
+// writeJson writes the value as a JSON response with the status code
+func writeJson(rw http.ResponseWriter, statusCode int, value interface{}) {
+	body, err := httputil.EncodeJson(value)
+	if nil != err {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rw.Header().Set(httputil.HttpContentTypeHeader, httputil.JsonContentType)
+	rw.WriteHeader(statusCode)
+	rw.Write(body)
+}
@@ -0,0 +1,84 @@
+package httputil
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/metrics"
+)
+
+// ClientOptions configures how a notifier's client sends requests. Each notifier's options
+// embed them.
+type ClientOptions struct {
+	// Client sends the requests, or a new client if nil. The client is copied, not modified.
+	Client *http.Client
+
+	// Transport replaces the transport of the client, if set
+	Transport http.RoundTripper
+
+	// Timeout limits how long each request may take, or the client's timeout if 0
+	Timeout time.Duration
+
+	// UserAgent is sent with every request
+	UserAgent string
+}
+
+// DefaultClientOptions are used by clients created without options
+var DefaultClientOptions = ClientOptions{
+	Timeout:   DefaultTimeout,
+	UserAgent: DefaultUserAgent,
+}
+
+// WithDefaults returns the options with an empty user agent replaced by the default
+func (o ClientOptions) WithDefaults() ClientOptions {
+	if "" == o.UserAgent {
+		o.UserAgent = DefaultClientOptions.UserAgent
+	}
+
+	return o
+}
+
+// NewClient returns the http.Client configured by the options
+func (o ClientOptions) NewClient() *http.Client {
+	return NewClient(o.Client, o.Transport, o.Timeout)
+}
+
+// RequestMetrics counts and times the requests a notifier sends
+type RequestMetrics struct {
+	requests *metrics.Counter
+	duration *metrics.Histogram
+}
+
+// NewRequestMetrics registers the <prefix>_requests_total counter, by response status code
+// or "error" when no response was received, and the <prefix>_request_duration_seconds
+// histogram for requests to the named API
+func NewRequestMetrics(prefix string, api string) *RequestMetrics {
+	instance := RequestMetrics{
+		requests: metrics.NewCounter(
+			prefix+"_requests_total",
+			api+" requests, by response status code, or \"error\" when no response was received.",
+			"code"),
+		duration: metrics.NewHistogram(
+			prefix+"_request_duration_seconds",
+			api+" request latency.",
+			metrics.DefaultBuckets),
+	}
+
+	return &instance
+}
+
+// Do sends the request with the client, recording how long it took and its status code
+func (m *RequestMetrics) Do(client *http.Client, request *http.Request) (*http.Response, error) {
+	started := time.Now()
+	resp, err := client.Do(request)
+	m.duration.Observe(time.Since(started).Seconds())
+
+	if nil != err {
+		m.requests.Inc("error")
+		return nil, err
+	}
+
+	m.requests.Inc(strconv.Itoa(resp.StatusCode))
+	return resp, nil
+}
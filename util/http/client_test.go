@@ -0,0 +1,88 @@
+package httputil_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/metrics"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+// failingTransport fails every request
+type failingTransport struct{}
+
+func (failingTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	return nil, errors.New("offline")
+}
+
+// scrape returns the lines of the Default registry's exposition for the metric family
+func scrape(name string) []string {
+	rec := httptest.NewRecorder()
+	metrics.Default.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	lines := []string{}
+	for _, line := range strings.Split(rec.Body.String(), "\n") {
+		if strings.HasPrefix(line, name) || strings.HasPrefix(line, "# HELP "+name+" ") || strings.HasPrefix(line, "# TYPE "+name+" ") {
+			lines = append(lines, line)
+		}
+	}
+
+	return lines
+}
+
+func TestClientOptions(t *testing.T) {
+	if "" == httputil.DefaultClientOptions.UserAgent || httputil.DefaultTimeout != httputil.DefaultClientOptions.Timeout {
+		t.Fatalf("got %+v", httputil.DefaultClientOptions)
+	}
+
+	options := httputil.ClientOptions{Timeout: time.Second}.WithDefaults()
+	if httputil.DefaultUserAgent != options.UserAgent || time.Second != options.Timeout {
+		t.Fatalf("expected only the user agent to be defaulted, got %+v", options)
+	}
+
+	transport := failingTransport{}
+	client := httputil.ClientOptions{Transport: transport, Timeout: time.Second}.NewClient()
+	if transport != client.Transport || time.Second != client.Timeout {
+		t.Fatalf("expected the transport and timeout to be applied, got %+v", client)
+	}
+}
+
+func TestRequestMetrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		rw.WriteHeader(http.StatusTeapot)
+	}))
+	defer server.Close()
+
+	requests := httputil.NewRequestMetrics("test_sink", "Test sink")
+
+	request, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := requests.Do(http.DefaultClient, request)
+	if nil != err {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if _, err := requests.Do(&http.Client{Transport: failingTransport{}}, request); nil == err {
+		t.Fatal("expected the request to fail")
+	}
+
+	expected := []string{
+		`# HELP test_sink_requests_total Test sink requests, by response status code, or "error" when no response was received.`,
+		`# TYPE test_sink_requests_total counter`,
+		`test_sink_requests_total{code="418"} 1`,
+		`test_sink_requests_total{code="error"} 1`,
+	}
+
+	if lines := scrape("test_sink_requests_total"); strings.Join(expected, "\n") != strings.Join(lines, "\n") {
+		t.Fatalf("expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(lines, "\n"))
+	}
+
+	if lines := scrape("test_sink_request_duration_seconds_count"); 1 != len(lines) || !strings.HasSuffix(lines[0], " 2") {
+		t.Fatalf("expected both requests to be timed, got %v", lines)
+	}
+}
@@ -4,6 +4,10 @@ import (
 	"bytes"
 	"encoding/json"
 	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
 )
 
 const (
@@ -16,10 +20,44 @@ const (
 	// HttpAcceptHeader Accept Request Header Key
 	HttpAcceptHeader string = "Accept"
 
+	// HttpUserAgentHeader User Agent Request Header Key
+	HttpUserAgentHeader string = "User-Agent"
+
 	// JsonContentType JSON Content-Type
 	JsonContentType string = "application/json"
+
+	// DefaultUserAgent identifies the bot to the APIs it calls
+	DefaultUserAgent string = "multi-twitch-discord-bot"
+
+	// DefaultTimeout limits how long any single API request may take
+	DefaultTimeout time.Duration = 10 * time.Second
 )
 
+// NewClient returns the http.Client API requests are sent with. A provided client is copied
+// rather than modified. The transport and timeout are applied when set.
+func NewClient(client *http.Client, transport http.RoundTripper, timeout time.Duration) *http.Client {
+	result := &http.Client{}
+	if nil != client {
+		copied := *client
+		result = &copied
+	}
+
+	if nil != transport {
+		result.Transport = transport
+	}
+
+	if timeout > 0 {
+		result.Timeout = timeout
+	}
+
+	return result
+}
+
+// JoinUrl joins the base url and path, without doubling or dropping the slash between them
+func JoinUrl(baseUrl string, path string) string {
+	return strings.TrimRight(baseUrl, "/") + "/" + strings.TrimLeft(path, "/")
+}
+
 // EncodeJson Encodes JSON from the provided interface and escapes html
 func EncodeJson(obj interface{}) ([]byte, error) {
 	buffer := &bytes.Buffer{}
@@ -36,3 +74,16 @@ func DecodeJson(r io.Reader, obj interface{}) error {
 	err := decoder.Decode(obj)
 	return err
 }
+
+// IsJsonContentType determines whether the Content-Type header value is JSON, ignoring any
+// parameters such as the charset
+func IsJsonContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return nil == err && JsonContentType == mediaType
+}
+
+// IsBodyTooLarge determines whether the error was returned by a reader created with
+// http.MaxBytesReader because the limit was exceeded
+func IsBodyTooLarge(err error) bool {
+	return nil != err && strings.Contains(err.Error(), "request body too large")
+}
@@ -0,0 +1,90 @@
+package httputil_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+func TestNewClient(t *testing.T) {
+	if client := httputil.NewClient(nil, nil, 0); nil == client || nil != client.Transport || 0 != client.Timeout {
+		t.Fatalf("expected a new default client, got %+v", client)
+	}
+
+	original := &http.Client{Timeout: time.Minute}
+	transport := &http.Transport{}
+
+	client := httputil.NewClient(original, transport, time.Second)
+	if original == client || transport != client.Transport || time.Second != client.Timeout {
+		t.Fatalf("expected a copy with the transport and timeout, got %+v", client)
+	}
+
+	if nil != original.Transport || time.Minute != original.Timeout {
+		t.Fatalf("expected the original client to be left alone, got %+v", original)
+	}
+
+	if kept := httputil.NewClient(original, nil, 0); time.Minute != kept.Timeout {
+		t.Fatalf("expected the client's timeout to be kept, got %s", kept.Timeout)
+	}
+}
+
+func TestJoinUrl(t *testing.T) {
+	cases := [][3]string{
+		{"https://api.twitch.tv", "/helix/streams", "https://api.twitch.tv/helix/streams"},
+		{"https://api.twitch.tv/", "/helix/streams", "https://api.twitch.tv/helix/streams"},
+		{"http://localhost:1234/api", "webhooks", "http://localhost:1234/api/webhooks"},
+	}
+
+	for _, c := range cases {
+		if joined := httputil.JoinUrl(c[0], c[1]); c[2] != joined {
+			t.Errorf("JoinUrl(%q, %q) = %q, expected %q", c[0], c[1], joined, c[2])
+		}
+	}
+}
+
+func TestEncodeJson(t *testing.T) {
+	encoded, err := httputil.EncodeJson(map[string]string{"content": "<b>live</b> & well"})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if "{\"content\":\"<b>live</b> & well\"}\n" != string(encoded) {
+		t.Fatalf("expected html to be left unescaped, got %q", encoded)
+	}
+}
+
+func TestIsJsonContentType(t *testing.T) {
+	cases := map[string]bool{
+		"application/json":                true,
+		"application/json; charset=utf-8": true,
+		"Application/JSON":                true,
+		"text/plain":                      false,
+		"application/jsonp":               false,
+		"":                                false,
+	}
+
+	for contentType, expected := range cases {
+		if actual := httputil.IsJsonContentType(contentType); expected != actual {
+			t.Errorf("IsJsonContentType(%q) = %v, expected %v", contentType, actual, expected)
+		}
+	}
+}
+
+func TestIsBodyTooLarge(t *testing.T) {
+	rec := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("too long"))
+
+	_, err := ioutil.ReadAll(http.MaxBytesReader(rec, request.Body, 3))
+	if !httputil.IsBodyTooLarge(err) {
+		t.Fatalf("expected the error to be recognized, got %v", err)
+	}
+
+	if httputil.IsBodyTooLarge(nil) {
+		t.Fatal("expected no error not to be recognized")
+	}
+}
@@ -0,0 +1,392 @@
+package log
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is the severity of a log entry
+type Level int
+
+const (
+	// LevelDebug is for detail only useful when diagnosing problems
+	LevelDebug Level = iota
+
+	// LevelInfo is for normal operation
+	LevelInfo
+
+	// LevelWarn is for problems the bot recovered from
+	LevelWarn
+
+	// LevelError is for failures
+	LevelError
+)
+
+const (
+	// FormatLogfmt writes each entry as space separated key=value pairs
+	FormatLogfmt string = "logfmt"
+
+	// FormatJson writes each entry as a JSON object on a single line
+	FormatJson string = "json"
+
+	// TimeKey is the key of each entry's timestamp
+	TimeKey string = "time"
+
+	// LevelKey is the key of each entry's level
+	LevelKey string = "level"
+
+	// MessageKey is the key of each entry's message
+	MessageKey string = "msg"
+
+	// ErrorKey is the conventional key for errors
+	ErrorKey string = "error"
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+// String returns the lower case name of the level
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+
+	return levelNames[l]
+}
+
+// ParseLevel converts a level name into a Level
+func ParseLevel(name string) (Level, error) {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	if "warning" == normalized {
+		normalized = "warn"
+	}
+
+	for i, levelName := range levelNames {
+		if levelName == normalized {
+			return Level(i), nil
+		}
+	}
+
+	return LevelInfo, fmt.Errorf("Unknown log level %q, expected one of: %s", name, strings.Join(levelNames, ", "))
+}
+
+// IsFormat determines whether the format is supported
+func IsFormat(format string) bool {
+	return FormatLogfmt == format || FormatJson == format
+}
+
+// Entry is a single log entry, as passed to hooks
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  []interface{}
+}
+
+// Field returns the value of the entry's field with the key, or nil if there is none
+func (e Entry) Field(key string) interface{} {
+	for i := 0; i+1 < len(e.Fields); i += 2 {
+		if key == fmt.Sprint(e.Fields[i]) {
+			return e.Fields[i+1]
+		}
+	}
+
+	return nil
+}
+
+// hook is a function called with every entry at or above its level
+type hook struct {
+	level Level
+	fn    func(Entry)
+}
+
+// output is the destination shared by a Logger and every Logger derived from it
+type output struct {
+	lock   sync.Mutex
+	writer io.Writer
+	level  Level
+	format string
+	hooks  []hook
+}
+
+// Logger writes leveled, structured log entries. Each entry carries the logger's fields,
+// followed by the key value pairs passed when logging.
+type Logger struct {
+	out    *output
+	fields []interface{}
+}
+
+// NewLogger creates a Logger writing entries at or above the level to the writer
+func NewLogger(writer io.Writer, level Level, format string) *Logger {
+	instance := Logger{
+		out: &output{
+			writer: writer,
+			level:  level,
+			format: format,
+		},
+	}
+
+	return &instance
+}
+
+// std is the logger used by the package level functions
+var std = NewLogger(NewScrubbingWriter(os.Stderr), LevelInfo, FormatLogfmt)
+
+// Default returns the logger used by the package level functions
+func Default() *Logger {
+	return std
+}
+
+// Configure sets the level and format of the default logger, and every logger derived from it
+func Configure(level Level, format string) {
+	std.Configure(level, format)
+}
+
+// Configure sets the level and format of the logger, and every logger derived from it
+func (l *Logger) Configure(level Level, format string) {
+	l.out.lock.Lock()
+	defer l.out.lock.Unlock()
+
+	l.out.level = level
+	l.out.format = format
+}
+
+// AddHook calls the function with every entry at or above the level, whether or not the
+// entry is written. Hooks are called synchronously, so they should be quick.
+func (l *Logger) AddHook(level Level, fn func(Entry)) {
+	l.out.lock.Lock()
+	defer l.out.lock.Unlock()
+
+	l.out.hooks = append(l.out.hooks, hook{level: level, fn: fn})
+}
+
+// Enabled determines whether entries at the level are written
+func (l *Logger) Enabled(level Level) bool {
+	l.out.lock.Lock()
+	defer l.out.lock.Unlock()
+
+	return level >= l.out.level
+}
+
+// With returns a Logger which adds the key value pairs to each entry
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(fields, l.fields...)
+	fields = append(fields, keyvals...)
+
+	instance := Logger{
+		out:    l.out,
+		fields: fields,
+	}
+
+	return &instance
+}
+
+// Debug writes an entry at LevelDebug
+func (l *Logger) Debug(message string, keyvals ...interface{}) {
+	l.write(LevelDebug, message, keyvals)
+}
+
+// Info writes an entry at LevelInfo
+func (l *Logger) Info(message string, keyvals ...interface{}) {
+	l.write(LevelInfo, message, keyvals)
+}
+
+// Warn writes an entry at LevelWarn
+func (l *Logger) Warn(message string, keyvals ...interface{}) {
+	l.write(LevelWarn, message, keyvals)
+}
+
+// Error writes an entry at LevelError
+func (l *Logger) Error(message string, keyvals ...interface{}) {
+	l.write(LevelError, message, keyvals)
+}
+
+// Fatal writes an entry at LevelError, then exits
+func (l *Logger) Fatal(message string, keyvals ...interface{}) {
+	l.write(LevelError, message, keyvals)
+	os.Exit(1)
+}
+
+// write formats and writes a single entry, if the level is enabled, then passes it to any
+// hooks interested in the level
+func (l *Logger) write(level Level, message string, keyvals []interface{}) {
+	now := time.Now().UTC()
+	pairs := append(append([]interface{}{}, l.fields...), keyvals...)
+
+	l.out.lock.Lock()
+	hooks := []func(Entry){}
+	for _, h := range l.out.hooks {
+		if level >= h.level {
+			hooks = append(hooks, h.fn)
+		}
+	}
+
+	if level >= l.out.level {
+		keys := []string{TimeKey, LevelKey, MessageKey}
+		values := []interface{}{now.Format(time.RFC3339Nano), level.String(), message}
+
+		for i := 0; i < len(pairs); i += 2 {
+			key := fmt.Sprint(pairs[i])
+
+			var value interface{} = "(MISSING)"
+			if i+1 < len(pairs) {
+				value = pairs[i+1]
+			}
+
+			keys = append(keys, key)
+			values = append(values, value)
+		}
+
+		var line []byte
+		if FormatJson == l.out.format {
+			line = formatJson(keys, values)
+		} else {
+			line = formatLogfmt(keys, values)
+		}
+
+		l.out.writer.Write(line)
+	}
+	l.out.lock.Unlock()
+
+	// Hooks run without the lock held, so they may log
+	if len(hooks) > 0 {
+		entry := Entry{
+			Time:    now,
+			Level:   level,
+			Message: message,
+			Fields:  pairs,
+		}
+
+		for _, hook := range hooks {
+			hook(entry)
+		}
+	}
+}
+
+// formatLogfmt writes the entry as key=value pairs, quoting values where required
+func formatLogfmt(keys []string, values []interface{}) []byte {
+	var buffer bytes.Buffer
+	for i, key := range keys {
+		if i > 0 {
+			buffer.WriteByte(' ')
+		}
+
+		buffer.WriteString(key)
+		buffer.WriteByte('=')
+
+		value := valueString(values[i])
+		if "" == value || strings.ContainsAny(value, " =\"\t\r\n\\") {
+			value = strconv.Quote(value)
+		}
+
+		buffer.WriteString(value)
+	}
+
+	buffer.WriteByte('\n')
+	return buffer.Bytes()
+}
+
+// formatJson writes the entry as a JSON object, keeping the keys in order
+func formatJson(keys []string, values []interface{}) []byte {
+	var buffer bytes.Buffer
+	buffer.WriteByte('{')
+	for i, key := range keys {
+		if i > 0 {
+			buffer.WriteByte(',')
+		}
+
+		keyBytes, _ := json.Marshal(key)
+		buffer.Write(keyBytes)
+		buffer.WriteByte(':')
+
+		value := values[i]
+		switch value.(type) {
+		case error, fmt.Stringer, time.Duration:
+			value = valueString(value)
+		}
+
+		valueBytes, err := json.Marshal(value)
+		if nil != err {
+			valueBytes, _ = json.Marshal(valueString(value))
+		}
+
+		buffer.Write(valueBytes)
+	}
+
+	buffer.WriteString("}\n")
+	return buffer.Bytes()
+}
+
+// valueString converts a value into its logged text
+func valueString(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return v
+	case error:
+		return v.Error()
+	case fmt.Stringer:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// AddHook calls the function with every entry logged through the default logger at or
+// above the level
+func AddHook(level Level, fn func(Entry)) {
+	std.AddHook(level, fn)
+}
+
+// With returns a Logger derived from the default logger which adds the key value pairs to
+// each entry
+func With(keyvals ...interface{}) *Logger {
+	return std.With(keyvals...)
+}
+
+// Debug writes an entry at LevelDebug to the default logger
+func Debug(message string, keyvals ...interface{}) {
+	std.write(LevelDebug, message, keyvals)
+}
+
+// Info writes an entry at LevelInfo to the default logger
+func Info(message string, keyvals ...interface{}) {
+	std.write(LevelInfo, message, keyvals)
+}
+
+// Warn writes an entry at LevelWarn to the default logger
+func Warn(message string, keyvals ...interface{}) {
+	std.write(LevelWarn, message, keyvals)
+}
+
+// Error writes an entry at LevelError to the default logger
+func Error(message string, keyvals ...interface{}) {
+	std.write(LevelError, message, keyvals)
+}
+
+// Fatal writes an entry at LevelError to the default logger, then exits
+func Fatal(message string, keyvals ...interface{}) {
+	std.write(LevelError, message, keyvals)
+	os.Exit(1)
+}
+
+// NewCorrelationId returns a random id for following a single event through the logs
+func NewCorrelationId() string {
+	idBytes := make([]byte, 8)
+	_, err := rand.Read(idBytes)
+	if nil != err {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+
+	return hex.EncodeToString(idBytes)
+}
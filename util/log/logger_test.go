@@ -0,0 +1,169 @@
+package log_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+// timePattern matches the timestamp of a logged entry
+var timePattern = regexp.MustCompile(`time=\S+ `)
+
+func TestParseLevel(t *testing.T) {
+	cases := map[string]logutil.Level{
+		"debug":   logutil.LevelDebug,
+		"INFO":    logutil.LevelInfo,
+		" warn ":  logutil.LevelWarn,
+		"Warning": logutil.LevelWarn,
+		"error":   logutil.LevelError,
+	}
+
+	for name, expected := range cases {
+		level, err := logutil.ParseLevel(name)
+		if nil != err || expected != level {
+			t.Errorf("ParseLevel(%q) = %v, %v, expected %v", name, level, err, expected)
+		}
+	}
+
+	if _, err := logutil.ParseLevel("verbose"); nil == err {
+		t.Error("expected an unknown level to be rejected")
+	}
+}
+
+func TestLogfmt(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	logger := logutil.NewLogger(buffer, logutil.LevelInfo, logutil.FormatLogfmt)
+
+	logger.With("correlation_id", "abc").Info("Received notification",
+		"title", `Say "hi"`,
+		"viewers", 3,
+		"empty", "",
+		logutil.ErrorKey, errors.New("boom"),
+		"dangling")
+
+	expected := `level=info msg="Received notification" correlation_id=abc title="Say \"hi\"" viewers=3 empty="" error=boom dangling=(MISSING)` + "\n"
+	if line := timePattern.ReplaceAllString(buffer.String(), ""); expected != line {
+		t.Fatalf("expected %q, got %q", expected, line)
+	}
+}
+
+func TestJson(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	logger := logutil.NewLogger(buffer, logutil.LevelInfo, logutil.FormatJson)
+
+	logger.Warn("Retrying", "attempt", 2, "delay", 1500*time.Millisecond, logutil.ErrorKey, errors.New("timeout"))
+
+	if !strings.HasSuffix(buffer.String(), "}\n") || 1 != strings.Count(buffer.String(), "\n") {
+		t.Fatalf("expected a single line, got %q", buffer.String())
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buffer.Bytes(), &entry); nil != err {
+		t.Fatal(err)
+	}
+
+	if _, err := time.Parse(time.RFC3339Nano, entry[logutil.TimeKey].(string)); nil != err {
+		t.Errorf("expected an RFC 3339 time, got %v", entry[logutil.TimeKey])
+	}
+
+	expected := map[string]interface{}{
+		logutil.LevelKey:   "warn",
+		logutil.MessageKey: "Retrying",
+		"attempt":          float64(2),
+		"delay":            "1.5s",
+		logutil.ErrorKey:   "timeout",
+	}
+
+	for key, value := range expected {
+		if value != entry[key] {
+			t.Errorf("%s = %#v, expected %#v", key, entry[key], value)
+		}
+	}
+}
+
+func TestLevels(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	logger := logutil.NewLogger(buffer, logutil.LevelWarn, logutil.FormatLogfmt)
+
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Warn("warn")
+	logger.Error("error")
+
+	if "warn,error" != strings.Join(messages(buffer), ",") {
+		t.Fatalf("got %v", messages(buffer))
+	}
+
+	if logger.Enabled(logutil.LevelInfo) || !logger.Enabled(logutil.LevelWarn) {
+		t.Fatal("expected only warn and above to be enabled")
+	}
+
+	// Configuring a logger configures every logger derived from it
+	buffer.Reset()
+	derived := logger.With("key", "value")
+	logger.Configure(logutil.LevelDebug, logutil.FormatLogfmt)
+	derived.Debug("debug")
+
+	if "debug" != strings.Join(messages(buffer), ",") {
+		t.Fatalf("got %v", messages(buffer))
+	}
+}
+
+func TestHooks(t *testing.T) {
+	buffer := &bytes.Buffer{}
+	logger := logutil.NewLogger(buffer, logutil.LevelError, logutil.FormatLogfmt)
+
+	entries := []logutil.Entry{}
+	logger.AddHook(logutil.LevelWarn, func(entry logutil.Entry) {
+		entries = append(entries, entry)
+	})
+
+	logger.With("user_id", "42").Info("ignored")
+	logger.With("user_id", "42").Warn("hooked but not written", logutil.ErrorKey, "boom")
+
+	if 0 != buffer.Len() {
+		t.Fatalf("expected nothing to be written, got %q", buffer.String())
+	}
+
+	if 1 != len(entries) {
+		t.Fatalf("expected one hooked entry, got %v", entries)
+	}
+
+	entry := entries[0]
+	if logutil.LevelWarn != entry.Level || "hooked but not written" != entry.Message {
+		t.Fatalf("got %+v", entry)
+	}
+
+	if "42" != entry.Field("user_id") || "boom" != entry.Field(logutil.ErrorKey) || nil != entry.Field("missing") {
+		t.Fatalf("got fields %v", entry.Fields)
+	}
+}
+
+func TestNewCorrelationId(t *testing.T) {
+	first := logutil.NewCorrelationId()
+	second := logutil.NewCorrelationId()
+
+	if !regexp.MustCompile(`^[0-9a-f]{16}$`).MatchString(first) {
+		t.Fatalf("got %q", first)
+	}
+
+	if first == second {
+		t.Fatal("expected correlation ids to be unique")
+	}
+}
+
+// messages returns the message of each logfmt entry written to the buffer
+func messages(buffer *bytes.Buffer) []string {
+	result := []string{}
+	for _, match := range regexp.MustCompile(`msg=(\S+)`).FindAllStringSubmatch(buffer.String(), -1) {
+		result = append(result, match[1])
+	}
+
+	return result
+}
@@ -0,0 +1,60 @@
+package log
+
+import (
+	"io"
+	"regexp"
+)
+
+const (
+	// Redacted replaces secrets removed from log output
+	Redacted string = "[REDACTED]"
+)
+
+var (
+	// webHookPattern matches the token of Discord web hook urls, stopping at quotes and the
+	// backslashes escaping them
+	webHookPattern = regexp.MustCompile(`(?i)(/api(?:/v\d+)?/webhooks/[^/\s"'\\]+/)[^/?#:\s"'\\]+`)
+
+	// slackWebHookPattern matches the secret of Slack incoming web hook urls
+	slackWebHookPattern = regexp.MustCompile(`(?i)(/services/[^/\s"'\\]+/[^/\s"'\\]+/)[^/?#\s"'\\]+`)
+
+	// telegramBotPattern matches the secret half of Telegram bot tokens in Bot API urls
+	telegramBotPattern = regexp.MustCompile(`(/bot\d+:)[^/?#\s"'\\]+`)
+
+	// credentialsPattern matches the password of urls with credentials
+	credentialsPattern = regexp.MustCompile(`([a-zA-Z][a-zA-Z0-9+.-]*://[^:/@\s"'\\]*:)[^@/\s"'\\]+@`)
+)
+
+// Scrub removes web hook tokens and url passwords from a log message
+func Scrub(message string) string {
+	message = webHookPattern.ReplaceAllString(message, "${1}"+Redacted)
+	message = slackWebHookPattern.ReplaceAllString(message, "${1}"+Redacted)
+	message = telegramBotPattern.ReplaceAllString(message, "${1}"+Redacted)
+	return credentialsPattern.ReplaceAllString(message, "${1}"+Redacted+"@")
+}
+
+// scrubbingWriter scrubs secrets from everything written before passing it on
+type scrubbingWriter struct {
+	writer io.Writer
+}
+
+// NewScrubbingWriter creates an io.Writer which scrubs secrets from each write before
+// writing to the provided writer. It's intended to be used with log.SetOutput, which
+// writes each log entry with a single call.
+func NewScrubbingWriter(writer io.Writer) io.Writer {
+	instance := scrubbingWriter{
+		writer: writer,
+	}
+
+	return &instance
+}
+
+// Write scrubs the bytes, then writes them to the underlying writer
+func (w *scrubbingWriter) Write(p []byte) (int, error) {
+	_, err := w.writer.Write([]byte(Scrub(string(p))))
+	if nil != err {
+		return 0, err
+	}
+
+	return len(p), nil
+}
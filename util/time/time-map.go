@@ -1,7 +1,6 @@
 package time
 
 import (
-	"errors"
 	"time"
 
 	"github.com/mbolt35/multi-twitch-discord-bot/storage"
@@ -25,8 +24,8 @@ func NewTimeMap(backingStore storage.BackingStore, timeFormat string) *TimeMap {
 
 // Exists returns true if the key exists in storage
 func (tm *TimeMap) Exists(key string) bool {
-	result, err := tm.backingStore.Get(key)
-	return "" != result && nil == err
+	_, err := tm.backingStore.Get(key)
+	return nil == err
 }
 
 // Get returns the time.Time value for the key in storage.
@@ -36,13 +35,10 @@ func (tm *TimeMap) Get(key string) (time.Time, error) {
 		return time.Time{}, err
 	}
 
-	if "" == result {
-		return time.Time{}, errors.New("No entry for key")
-	}
-
 	return time.Parse(tm.timeFormat, result)
 }
 
+// Set stores the time for the key, which must be in the TimeMap's time format
 func (tm *TimeMap) Set(key string, t string) error {
 	_, err := time.Parse(tm.timeFormat, t)
 	if nil != err {
@@ -51,3 +47,14 @@ func (tm *TimeMap) Set(key string, t string) error {
 
 	return tm.backingStore.Set(key, t)
 }
+
+// SetIfChanged atomically stores the time for the key unless it already holds the same
+// time, returning true if the time was stored
+func (tm *TimeMap) SetIfChanged(key string, t string) (bool, error) {
+	parsed, err := time.Parse(tm.timeFormat, t)
+	if nil != err {
+		return false, err
+	}
+
+	return tm.backingStore.SetIfChanged(key, parsed.UTC().Format(tm.timeFormat))
+}
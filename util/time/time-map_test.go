@@ -0,0 +1,131 @@
+package time_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/storage"
+
+	timeutil "github.com/mbolt35/multi-twitch-discord-bot/util/time"
+)
+
+func newTimeMap(t *testing.T) (*timeutil.TimeMap, storage.BackingStore) {
+	store := storage.NewMemoryStore()
+	if err := store.Init(); nil != err {
+		t.Fatal(err)
+	}
+
+	return timeutil.NewTimeMap(store, time.RFC3339), store
+}
+
+func TestTimeMapSetAndGet(t *testing.T) {
+	times, _ := newTimeMap(t)
+
+	if times.Exists("42") {
+		t.Fatal("expected an empty map")
+	}
+
+	if err := times.Set("42", "2020-01-01T00:00:00Z"); nil != err {
+		t.Fatal(err)
+	}
+
+	if !times.Exists("42") {
+		t.Fatal("expected the key to exist")
+	}
+
+	got, err := times.Get("42")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if !got.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestTimeMapRejectsMalformedTimes(t *testing.T) {
+	times, store := newTimeMap(t)
+
+	if err := times.Set("42", "yesterday"); nil == err {
+		t.Fatal("expected Set to reject a malformed time")
+	}
+
+	if _, err := times.SetIfChanged("42", "yesterday"); nil == err {
+		t.Fatal("expected SetIfChanged to reject a malformed time")
+	}
+
+	if _, err := store.Get("42"); storage.ErrNotFound != err {
+		t.Fatalf("expected nothing to be stored, got %v", err)
+	}
+}
+
+func TestTimeMapSetIfChanged(t *testing.T) {
+	times, _ := newTimeMap(t)
+
+	steps := []struct {
+		value   string
+		changed bool
+	}{
+		{"2020-01-01T00:00:00Z", true},
+		{"2020-01-01T00:00:00Z", false},
+
+		// The same instant in another zone is the same start time
+		{"2020-01-01T01:00:00+01:00", false},
+		{"2020-01-02T00:00:00Z", true},
+		{"2020-01-01T00:00:00Z", true},
+	}
+
+	for _, step := range steps {
+		changed, err := times.SetIfChanged("42", step.value)
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		if step.changed != changed {
+			t.Fatalf("SetIfChanged(%q) = %v, expected %v", step.value, changed, step.changed)
+		}
+	}
+
+	got, err := times.Get("42")
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	if !got.Equal(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("got %v", got)
+	}
+}
+
+func TestTimeMapSetIfChangedOnlyOnceInParallel(t *testing.T) {
+	times, _ := newTimeMap(t)
+
+	var wg sync.WaitGroup
+	var lock sync.Mutex
+	changes := 0
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			changed, err := times.SetIfChanged("42", "2020-01-01T00:00:00Z")
+			if nil != err {
+				t.Error(err)
+				return
+			}
+
+			if changed {
+				lock.Lock()
+				changes++
+				lock.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if 1 != changes {
+		t.Fatalf("expected exactly one change, got %d", changes)
+	}
+}
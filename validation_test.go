@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/twitch"
+)
+
+// postNotification delivers the body to the bot's notify end point, signed as the hub signs
+// it, returning the status code
+func postNotification(t *testing.T, bot *testBot, contentType string, body []byte) int {
+	return postSignedNotification(t, bot.twitch.NewMessageId(), contentType, body, twitch.TwitchSignaturePrefix+twitch.Sign(webhookSecret, body))
+}
+
+// postSignedNotification delivers the body with the message id and signature to the bot's
+// notify end point, returning the status code
+func postSignedNotification(t *testing.T, messageId string, contentType string, body []byte, signature string) int {
+	request, err := http.NewRequest(http.MethodPost, notifyUrl(), bytes.NewReader(body))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set(twitch.TwitchNotificationIdHeader, messageId)
+	if "" != signature {
+		request.Header.Set(twitch.TwitchSignatureHeader, signature)
+	}
+
+	resp, err := http.DefaultClient.Do(request)
+	if nil != err {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode
+}
+
+func TestNotificationValidation(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	cases := map[string]struct {
+		contentType string
+		body        []byte
+		code        int
+	}{
+		"valid":                {"application/json; charset=utf-8", []byte(`{"data": []}`), http.StatusAccepted},
+		"unsupported type":     {"text/plain", []byte(`{"data": []}`), http.StatusUnsupportedMediaType},
+		"malformed":            {"application/json", []byte(`{"data": [`), http.StatusBadRequest},
+		"missing data":         {"application/json", []byte(`{}`), http.StatusUnprocessableEntity},
+		"invalid start time":   {"application/json", []byte(`{"data": [{"user_id": "42", "type": "live", "started_at": "yesterday"}]}`), http.StatusUnprocessableEntity},
+		"too large":            {"application/json", bytes.Repeat([]byte(" "), int(MaxNotificationBodySize)+1), http.StatusRequestEntityTooLarge},
+		"missing notification": {"application/json", []byte(`{"data": [{}]}`), http.StatusUnprocessableEntity},
+	}
+
+	for name, c := range cases {
+		if code := postNotification(t, bot, c.contentType, c.body); c.code != code {
+			t.Errorf("%s: expected %d, got %d", name, c.code, code)
+		}
+	}
+}
+
+func TestNotificationSignature(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	body := []byte(`{"data": []}`)
+	cases := map[string]struct {
+		signature string
+		code      int
+	}{
+		"signed":           {"sha256=" + twitch.Sign("secret", body), http.StatusAccepted},
+		"unsigned":         {"", http.StatusForbidden},
+		"wrong secret":     {"sha256=" + twitch.Sign("guess", body), http.StatusForbidden},
+		"other body":       {"sha256=" + twitch.Sign("secret", []byte(`{"data": [ ]}`)), http.StatusForbidden},
+		"other algorithm":  {"sha1=" + twitch.Sign("secret", body), http.StatusForbidden},
+		"malformed digest": {"sha256=not-hex", http.StatusForbidden},
+	}
+
+	for name, c := range cases {
+		if code := postSignedNotification(t, bot.twitch.NewMessageId(), "application/json", body, c.signature); c.code != code {
+			t.Errorf("%s: expected %d, got %d", name, c.code, code)
+		}
+	}
+
+	// Forged deliveries are refused before they're recorded, so they can't suppress the real one
+	notifications := []twitch.TwitchNotification{{Id: "1", UserId: "42", Type: "live", StartedAt: "2020-01-01T00:00:00Z"}}
+	forged, err := json.Marshal(twitch.TwitchNotificationPayload{Notifications: notifications})
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	messageId := bot.twitch.NewMessageId()
+	if code := postSignedNotification(t, messageId, "application/json", forged, "sha256="+twitch.Sign("guess", forged)); http.StatusForbidden != code {
+		t.Fatalf("expected the forged delivery to be refused, got %d", code)
+	}
+
+	if code, err := bot.twitch.Deliver("42", messageId, notifications); nil != err || http.StatusAccepted != code {
+		t.Fatalf("expected the real delivery to be accepted, got %d, %v", code, err)
+	}
+
+	if _, ok := bot.discord.WaitForMessages(1, time.Second); !ok {
+		t.Fatal("expected the real delivery to be announced")
+	}
+}
+
+func TestSubscriptionsAreMadeWithTheSecret(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	subscription, ok := bot.twitch.Subscription("42")
+	if !ok || "secret" != subscription.Secret {
+		t.Fatalf("expected the subscription to have the secret, got %+v", subscription)
+	}
+}
+
+func TestSubscriptionVerification(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	cases := map[string]struct {
+		query url.Values
+		code  int
+		body  string
+	}{
+		"subscribe": {
+			url.Values{"hub.mode": {"subscribe"}, "hub.topic": {"topic"}, "hub.challenge": {"challenge"}, "hub.lease_seconds": {"100"}},
+			http.StatusOK, "challenge",
+		},
+		"unsubscribe": {
+			url.Values{"hub.mode": {"unsubscribe"}, "hub.topic": {"topic"}, "hub.challenge": {"challenge"}},
+			http.StatusOK, "challenge",
+		},
+		"denied": {
+			url.Values{"hub.mode": {"denied"}, "hub.topic": {"topic"}, "hub.reason": {"unauthorized"}},
+			http.StatusOK, "",
+		},
+		"missing challenge": {
+			url.Values{"hub.mode": {"subscribe"}, "hub.topic": {"topic"}, "hub.lease_seconds": {"100"}},
+			http.StatusBadRequest, "Missing hub.challenge\n",
+		},
+		"invalid lease": {
+			url.Values{"hub.mode": {"subscribe"}, "hub.topic": {"topic"}, "hub.challenge": {"challenge"}, "hub.lease_seconds": {"-1"}},
+			http.StatusBadRequest, "Invalid hub.lease_seconds\n",
+		},
+		"invalid mode": {
+			url.Values{"hub.mode": {"publish"}, "hub.topic": {"topic"}},
+			http.StatusBadRequest, "Invalid hub.mode\n",
+		},
+	}
+
+	for name, c := range cases {
+		resp, err := http.Get(notifyUrl() + "?" + c.query.Encode())
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if nil != err {
+			t.Fatal(err)
+		}
+
+		if c.code != resp.StatusCode || c.body != string(body) {
+			t.Errorf("%s: expected %d %q, got %d %q", name, c.code, c.body, resp.StatusCode, body)
+		}
+	}
+}
+
+func TestNotifyRejectsOtherMethods(t *testing.T) {
+	bot := startTestBot(t, nil)
+	defer bot.Close()
+
+	request, err := http.NewRequest(http.MethodPut, notifyUrl(), strings.NewReader(`{"data": []}`))
+	if nil != err {
+		t.Fatal(err)
+	}
+
+	resp, err := http.DefaultClient.Do(request)
+	if nil != err {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if http.StatusMethodNotAllowed != resp.StatusCode || "GET, POST" != resp.Header.Get("Allow") {
+		t.Fatalf("got %d, Allow: %q", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+}
+
+func TestRecover(t *testing.T) {
+	handler := Recover(http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if http.StatusInternalServerError != rec.Code {
+		t.Fatalf("expected 500, got %d", rec.Code)
+	}
+
+	defer func() {
+		if http.ErrAbortHandler != recover() {
+			t.Fatal("expected ErrAbortHandler to be passed through")
+		}
+	}()
+
+	Recover(http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		panic(http.ErrAbortHandler)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
@@ -0,0 +1,15 @@
+package webhook
+
+import (
+	"github.com/mbolt35/multi-twitch-discord-bot/metrics"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+var (
+	requests = httputil.NewRequestMetrics("webhook", "Outgoing web hook")
+
+	retries = metrics.NewCounter(
+		"webhook_retries_total",
+		"Outgoing web hook requests retried after a failed attempt.")
+)
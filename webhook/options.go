@@ -0,0 +1,73 @@
+package webhook
+
+import (
+	"time"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+)
+
+const (
+	// DefaultAttempts is the number of attempts made to deliver each event
+	DefaultAttempts int = 3
+
+	// DefaultInitialRetryDelay is the delay before the first retry
+	DefaultInitialRetryDelay time.Duration = time.Second
+
+	// DefaultMaxRetryDelay caps the delay between retries
+	DefaultMaxRetryDelay time.Duration = 4 * time.Second
+
+	// DefaultMaxDeliveryTime caps the time spent delivering each event, including retries,
+	// since the streamer's other announcements wait for it
+	DefaultMaxDeliveryTime time.Duration = 10 * time.Second
+)
+
+// Options configures how a web hook client delivers events
+type Options struct {
+	// ClientOptions configure the http client and user agent
+	httputil.ClientOptions
+
+	// Attempts is the number of attempts made to deliver each event
+	Attempts int
+
+	// InitialRetryDelay is the delay before the first retry, doubling with each retry
+	InitialRetryDelay time.Duration
+
+	// MaxRetryDelay caps the delay between retries
+	MaxRetryDelay time.Duration
+
+	// MaxDeliveryTime caps the time spent delivering each event, including every attempt and
+	// the delays between them
+	MaxDeliveryTime time.Duration
+}
+
+// DefaultOptions are used by clients created without options
+var DefaultOptions = Options{
+	ClientOptions:     httputil.DefaultClientOptions,
+	Attempts:          DefaultAttempts,
+	InitialRetryDelay: DefaultInitialRetryDelay,
+	MaxRetryDelay:     DefaultMaxRetryDelay,
+	MaxDeliveryTime:   DefaultMaxDeliveryTime,
+}
+
+// withDefaults returns the options with unset fields replaced by the defaults
+func (o Options) withDefaults() Options {
+	o.ClientOptions = o.ClientOptions.WithDefaults()
+
+	if o.Attempts < 1 {
+		o.Attempts = DefaultOptions.Attempts
+	}
+
+	if o.InitialRetryDelay <= 0 {
+		o.InitialRetryDelay = DefaultOptions.InitialRetryDelay
+	}
+
+	if o.MaxRetryDelay < o.InitialRetryDelay {
+		o.MaxRetryDelay = o.InitialRetryDelay
+	}
+
+	if o.MaxDeliveryTime <= 0 {
+		o.MaxDeliveryTime = DefaultOptions.MaxDeliveryTime
+	}
+
+	return o
+}
@@ -0,0 +1,282 @@
+// Package webhook delivers go live events to any HTTP end point as signed JSON, in a
+// versioned schema which is only ever extended within a version.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/notifier"
+
+	httputil "github.com/mbolt35/multi-twitch-discord-bot/util/http"
+	logutil "github.com/mbolt35/multi-twitch-discord-bot/util/log"
+)
+
+const (
+	// SchemaVersion is the version of the payload schema. Fields may be added within a
+	// version, but are never removed or changed.
+	SchemaVersion int = 1
+
+	// StreamOnlineEvent is the type of go live events
+	StreamOnlineEvent string = "stream.online"
+
+	// PingEvent is the type of the events sent to check the end point, which receivers
+	// should accept without doing anything
+	PingEvent string = "ping"
+
+	// EventHeader carries the type of the event
+	EventHeader string = "X-Webhook-Event"
+
+	// DeliveryHeader carries a unique id for each event, which is the same for every attempt
+	// to deliver it
+	DeliveryHeader string = "X-Webhook-Delivery"
+
+	// TimestampHeader carries the unix time in seconds the attempt was made, which is signed
+	// with the body so receivers can refuse old requests replayed to them
+	TimestampHeader string = "X-Webhook-Timestamp"
+
+	// SignatureHeader carries "sha256=" and the hex encoded HMAC-SHA256 of the timestamp, a
+	// "." and the body, keyed with the destination's secret. It's omitted when the
+	// destination has no secret.
+	SignatureHeader string = "X-Webhook-Signature"
+
+	// SignaturePrefix prefixes the HMAC in the signature header
+	SignaturePrefix string = "sha256="
+
+	// DefaultTolerance is how old a request's timestamp may be before Verify refuses it
+	DefaultTolerance time.Duration = 5 * time.Minute
+)
+
+// Payload is the body posted for every event
+type Payload struct {
+	Version int     `json:"version"`
+	Type    string  `json:"type"`
+	Message string  `json:"message,omitempty"`
+	Stream  *Stream `json:"stream,omitempty"`
+}
+
+// Stream is the stream which went live
+type Stream struct {
+	UserId       string `json:"user_id"`
+	Login        string `json:"login"`
+	DisplayName  string `json:"display_name"`
+	Title        string `json:"title"`
+	GameId       string `json:"game_id"`
+	GameName     string `json:"game_name"`
+	Language     string `json:"language"`
+	StartedAt    string `json:"started_at"`
+	ViewerCount  int    `json:"viewer_count"`
+	ThumbnailUrl string `json:"thumbnail_url"`
+	Url          string `json:"url"`
+}
+
+// webhook is a notifier.Notifier for a generic HTTP end point
+type webhook struct {
+	url        string
+	secret     string
+	options    Options
+	httpClient *http.Client
+}
+
+var _ notifier.Notifier = &webhook{}
+
+// NewWebHook creates a Notifier which posts events to the url, signed with the secret
+// unless it's empty
+func NewWebHook(url string, secret string, options Options) notifier.Notifier {
+	options = options.withDefaults()
+
+	instance := webhook{
+		url:        url,
+		secret:     secret,
+		options:    options,
+		httpClient: options.NewClient(),
+	}
+
+	return &instance
+}
+
+// NewPayload returns the payload announcing the event, with the message rendered from the
+// streamer's template
+func NewPayload(message string, event notifier.Event) Payload {
+	return Payload{
+		Version: SchemaVersion,
+		Type:    StreamOnlineEvent,
+		Message: message,
+		Stream: &Stream{
+			UserId:       event.UserId,
+			Login:        event.Login,
+			DisplayName:  event.DisplayName,
+			Title:        event.Title,
+			GameId:       event.GameId,
+			GameName:     event.GameName,
+			Language:     event.Language,
+			StartedAt:    event.StartedAt,
+			ViewerCount:  event.ViewerCount,
+			ThumbnailUrl: event.Thumbnail(),
+			Url:          event.Url,
+		},
+	}
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the timestamp, a "." and the body with the
+// secret
+func Sign(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify determines whether the signature header value is the signature of the timestamp
+// and body with the secret, and the timestamp is within the tolerance of now, for receivers
+// written in Go
+func Verify(secret string, timestamp string, body []byte, signature string, tolerance time.Duration) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if nil != err {
+		return false
+	}
+
+	age := time.Since(time.Unix(seconds, 0))
+	if age > tolerance || age < -tolerance {
+		return false
+	}
+
+	return hmac.Equal([]byte(SignaturePrefix+Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Payload returns the versioned JSON announcing the event
+func (w *webhook) Payload(message string, event notifier.Event) (json.RawMessage, error) {
+	return encode(NewPayload(message, event))
+}
+
+// Notify posts the event, retrying network errors, 429 Too Many Requests and 5xx responses
+// until the delivery time is used up
+func (w *webhook) Notify(message string, event notifier.Event) error {
+	body, err := w.Payload(message, event)
+	if nil != err {
+		return err
+	}
+
+	return w.deliver(StreamOnlineEvent, body, w.options.Attempts)
+}
+
+// Check posts a ping event once, which the end point must accept. Readiness checks never
+// call it, since the receiver acts on every request.
+func (w *webhook) Check() error {
+	body, err := encode(Payload{Version: SchemaVersion, Type: PingEvent})
+	if nil != err {
+		return err
+	}
+
+	return w.deliver(PingEvent, body, 1)
+}
+
+// deliver posts the body until it's accepted, a response means retrying is pointless, every
+// attempt has been made or the delivery time is used up, with exponential backoff between
+// attempts
+func (w *webhook) deliver(eventType string, body []byte, attempts int) error {
+	deliveryId := logutil.NewCorrelationId()
+	logger := logutil.With("delivery_id", deliveryId, "event", eventType)
+	delay := w.options.InitialRetryDelay
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.options.MaxDeliveryTime)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		retry, retryAfter, postErr := w.post(ctx, logger, deliveryId, eventType, body)
+		err = postErr
+		if nil == err {
+			return nil
+		}
+
+		if !retry || attempt == attempts {
+			break
+		}
+
+		wait := delay
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if wait > w.options.MaxRetryDelay {
+			wait = w.options.MaxRetryDelay
+		}
+
+		if time.Now().Add(wait).After(deadline) {
+			logger.Warn("Web hook delivery failed, out of time to retry", "attempt", attempt, "attempts", attempts, logutil.ErrorKey, err)
+			break
+		}
+
+		logger.Warn("Web hook delivery failed, retrying", "attempt", attempt, "attempts", attempts, "delay", wait, logutil.ErrorKey, err)
+		retries.Inc()
+		time.Sleep(wait)
+
+		delay *= 2
+	}
+
+	return err
+}
+
+// post makes a single attempt to deliver the body. Returns whether a failure may succeed if
+// retried, and how long the end point asked to wait first.
+func (w *webhook) post(ctx context.Context, logger *logutil.Logger, deliveryId string, eventType string, body []byte) (bool, time.Duration, error) {
+	request, err := http.NewRequest(http.MethodPost, w.url, bytes.NewReader(body))
+	if nil != err {
+		return false, 0, err
+	}
+	request = request.WithContext(ctx)
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	request.Header.Set(httputil.HttpContentTypeHeader, httputil.JsonContentType)
+	request.Header.Set(httputil.HttpUserAgentHeader, w.options.UserAgent)
+	request.Header.Set(EventHeader, eventType)
+	request.Header.Set(DeliveryHeader, deliveryId)
+	request.Header.Set(TimestampHeader, timestamp)
+	if "" != w.secret {
+		request.Header.Set(SignatureHeader, SignaturePrefix+Sign(w.secret, timestamp, body))
+	}
+
+	resp, err := requests.Do(w.httpClient, request)
+	if nil != err {
+		return true, 0, err
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < http.StatusMultipleChoices {
+		logger.Debug("Delivered web hook event", "status", resp.StatusCode)
+		return false, 0, nil
+	}
+
+	err = fmt.Errorf("Web hook returned %s", resp.Status)
+	if http.StatusTooManyRequests == resp.StatusCode {
+		seconds, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return true, time.Duration(seconds) * time.Second, err
+	}
+
+	return resp.StatusCode >= http.StatusInternalServerError, 0, err
+}
+
+// encode encodes the payload without a trailing new line, so its signature matches the body
+func encode(payload Payload) (json.RawMessage, error) {
+	jsonBytes, err := httputil.EncodeJson(payload)
+	if nil != err {
+		return nil, err
+	}
+
+	return json.RawMessage(bytes.TrimSpace(jsonBytes)), nil
+}
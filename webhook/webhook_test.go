@@ -0,0 +1,237 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mbolt35/multi-twitch-discord-bot/notifier"
+	"github.com/mbolt35/multi-twitch-discord-bot/webhook"
+)
+
+// receiver is a stand-in end point, responding to each attempt with the next status code
+// and recording the requests
+type receiver struct {
+	*httptest.Server
+	lock     sync.Mutex
+	statuses []int
+	headers  []http.Header
+	bodies   [][]byte
+}
+
+// newReceiver starts an end point which responds with the status codes in turn, then 200
+func newReceiver(statuses ...int) *receiver {
+	instance := &receiver{statuses: statuses}
+	instance.Server = httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, request *http.Request) {
+		body, _ := ioutil.ReadAll(request.Body)
+
+		instance.lock.Lock()
+		instance.headers = append(instance.headers, request.Header)
+		instance.bodies = append(instance.bodies, body)
+		status := http.StatusOK
+		if len(instance.statuses) > 0 {
+			status, instance.statuses = instance.statuses[0], instance.statuses[1:]
+		}
+		instance.lock.Unlock()
+
+		if http.StatusTooManyRequests == status {
+			rw.Header().Set("Retry-After", "1")
+		}
+		rw.WriteHeader(status)
+	}))
+
+	return instance
+}
+
+// Attempts returns the number of requests received
+func (r *receiver) Attempts() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return len(r.headers)
+}
+
+// Request returns the headers and body of the attempt
+func (r *receiver) Request(attempt int) (http.Header, []byte) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.headers[attempt], r.bodies[attempt]
+}
+
+// fastOptions retries without waiting long, so tests run quickly
+func fastOptions() webhook.Options {
+	options := webhook.DefaultOptions
+	options.InitialRetryDelay = 10 * time.Millisecond
+	options.MaxRetryDelay = 20 * time.Millisecond
+
+	return options
+}
+
+func TestSign(t *testing.T) {
+	// printf '1600000000.{"version":1}' | openssl dgst -sha256 -hmac secret
+	expected := "d73ff940c8446b31d18dbd590ba2bb926d94f4ca9c81006e7668ed39b0bd1431"
+	if signature := webhook.Sign("secret", "1600000000", []byte(`{"version":1}`)); expected != signature {
+		t.Fatalf("expected %s, got %s", expected, signature)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"version":1}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	signature := webhook.SignaturePrefix + webhook.Sign("secret", now, body)
+
+	if !webhook.Verify("secret", now, body, signature, webhook.DefaultTolerance) {
+		t.Fatal("expected the signature to be verified")
+	}
+
+	old := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	cases := map[string][]string{
+		"wrong secret":     {"other", now, string(body), signature},
+		"changed body":     {"secret", now, `{"version":2}`, signature},
+		"changed time":     {"secret", old, string(body), signature},
+		"replayed request": {"secret", old, string(body), webhook.SignaturePrefix + webhook.Sign("secret", old, body)},
+		"bad timestamp":    {"secret", "yesterday", string(body), signature},
+		"missing prefix":   {"secret", now, string(body), webhook.Sign("secret", now, body)},
+	}
+
+	for name, args := range cases {
+		if webhook.Verify(args[0], args[1], []byte(args[2]), args[3], webhook.DefaultTolerance) {
+			t.Errorf("%s: expected the signature to be refused", name)
+		}
+	}
+}
+
+func TestNotify(t *testing.T) {
+	server := newReceiver()
+	defer server.Close()
+
+	client := webhook.NewWebHook(server.URL, "secret", fastOptions())
+	event := notifier.Event{UserId: "42", GameId: "509658", GameName: "Just Chatting", Url: "http://twitch.tv/streamer"}
+	if err := client.Notify("live", event); nil != err {
+		t.Fatal(err)
+	}
+
+	if 1 != server.Attempts() {
+		t.Fatalf("expected 1 attempt, got %d", server.Attempts())
+	}
+
+	headers, body := server.Request(0)
+	if webhook.StreamOnlineEvent != headers.Get(webhook.EventHeader) || "" == headers.Get(webhook.DeliveryHeader) {
+		t.Fatalf("got headers %v", headers)
+	}
+
+	timestamp := headers.Get(webhook.TimestampHeader)
+	if !webhook.Verify("secret", timestamp, body, headers.Get(webhook.SignatureHeader), webhook.DefaultTolerance) {
+		t.Fatalf("expected the request to be signed with its timestamp, got headers %v", headers)
+	}
+
+	var payload webhook.Payload
+	if err := json.Unmarshal(body, &payload); nil != err {
+		t.Fatal(err)
+	}
+
+	if webhook.SchemaVersion != payload.Version || "live" != payload.Message || "Just Chatting" != payload.Stream.GameName {
+		t.Fatalf("got %+v", payload)
+	}
+}
+
+func TestNotifyWithoutSecret(t *testing.T) {
+	server := newReceiver()
+	defer server.Close()
+
+	if err := webhook.NewWebHook(server.URL, "", fastOptions()).Notify("live", notifier.Event{}); nil != err {
+		t.Fatal(err)
+	}
+
+	headers, _ := server.Request(0)
+	if "" != headers.Get(webhook.SignatureHeader) || "" == headers.Get(webhook.TimestampHeader) {
+		t.Fatalf("expected only the timestamp without a secret, got %v", headers)
+	}
+}
+
+func TestNotifyRetries(t *testing.T) {
+	server := newReceiver(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+	defer server.Close()
+
+	if err := webhook.NewWebHook(server.URL, "secret", fastOptions()).Notify("live", notifier.Event{}); nil != err {
+		t.Fatal(err)
+	}
+
+	if 3 != server.Attempts() {
+		t.Fatalf("expected 3 attempts, got %d", server.Attempts())
+	}
+
+	// Every attempt is the same delivery
+	first, _ := server.Request(0)
+	last, _ := server.Request(2)
+	if first.Get(webhook.DeliveryHeader) != last.Get(webhook.DeliveryHeader) {
+		t.Fatal("expected the delivery id to be the same for every attempt")
+	}
+}
+
+func TestNotifyGivesUp(t *testing.T) {
+	refused := newReceiver(http.StatusBadRequest)
+	defer refused.Close()
+
+	if err := webhook.NewWebHook(refused.URL, "", fastOptions()).Notify("live", notifier.Event{}); nil == err || 1 != refused.Attempts() {
+		t.Fatalf("expected a 4xx not to be retried, got %v after %d attempts", err, refused.Attempts())
+	}
+
+	failing := newReceiver(http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+	defer failing.Close()
+
+	if err := webhook.NewWebHook(failing.URL, "", fastOptions()).Notify("live", notifier.Event{}); nil == err || webhook.DefaultAttempts != failing.Attempts() {
+		t.Fatalf("expected %d attempts, got %v after %d attempts", webhook.DefaultAttempts, err, failing.Attempts())
+	}
+}
+
+func TestNotifyIsBoundedByTheDeliveryTime(t *testing.T) {
+	statuses := []int{}
+	for i := 0; i < 100; i++ {
+		statuses = append(statuses, http.StatusServiceUnavailable)
+	}
+
+	server := newReceiver(statuses...)
+	defer server.Close()
+
+	options := fastOptions()
+	options.Attempts = 100
+	options.MaxDeliveryTime = 100 * time.Millisecond
+
+	started := time.Now()
+	if err := webhook.NewWebHook(server.URL, "", options).Notify("live", notifier.Event{}); nil == err {
+		t.Fatal("expected the delivery to fail")
+	}
+
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Fatalf("expected to give up after the delivery time, took %s", elapsed)
+	}
+
+	if attempts := server.Attempts(); attempts < 2 || attempts >= 100 {
+		t.Fatalf("expected a few attempts, got %d", attempts)
+	}
+}
+
+func TestCheckSendsOnePing(t *testing.T) {
+	server := newReceiver(http.StatusServiceUnavailable)
+	defer server.Close()
+
+	client := webhook.NewWebHook(server.URL, "", fastOptions())
+	if err := client.Check(); nil == err || 1 != server.Attempts() {
+		t.Fatalf("expected a single failed ping, got %v after %d attempts", err, server.Attempts())
+	}
+
+	if err := client.Check(); nil != err {
+		t.Fatal(err)
+	}
+
+	if headers, _ := server.Request(1); webhook.PingEvent != headers.Get(webhook.EventHeader) {
+		t.Fatalf("got headers %v", headers)
+	}
+}